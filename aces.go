@@ -0,0 +1,212 @@
+package exr
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+)
+
+// The ACES image container (SMPTE ST 2065-4) is a profile of exr images
+// to exchange ACES (SMPTE ST 2065-1) images. An ACES image container is
+// a single part scanline image that
+//
+// 	has acesImageContainerFlag attribute of value 1,
+// 	has chromaticities of ACES AP0 primaries and white point,
+// 	is compressed with NONE, PIZ or B44A compression, and
+// 	has only R, G, B and optional A channels of HALF type.
+
+// ACESViolation describes a way an exr image violates the ACES image container profile.
+type ACESViolation struct {
+	// Attribute is name of the attribute that violates the profile.
+	// It is empty when the violation isn't about an attribute, such as a tiled image.
+	Attribute string
+
+	// Reason describes the violation.
+	Reason string
+}
+
+func (v ACESViolation) Error() string {
+	if v.Attribute == "" {
+		return "exr: not an ACES image container: " + v.Reason
+	}
+	return "exr: not an ACES image container: " + v.Attribute + ": " + v.Reason
+}
+
+// acesRequiredAttributes are attributes that an ACES image container should have,
+// besides the ACES specific ones.
+var acesRequiredAttributes = []string{
+	"channels",
+	"compression",
+	"dataWindow",
+	"displayWindow",
+	"lineOrder",
+	"pixelAspectRatio",
+	"screenWindowCenter",
+	"screenWindowWidth",
+}
+
+// ValidateACES checks the exr image in the file against the ACES image container profile.
+// It returns every violation it found, or nil if the image follows the profile.
+// The error is non-nil when the file couldn't be read.
+func ValidateACES(path string) ([]ACESViolation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	vf, err := readVersion(r)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := readHeaders(r, vf, nil)
+	if err != nil {
+		return nil, err
+	}
+	var vs []ACESViolation
+	if vf.multiPart || len(headers) != 1 {
+		vs = append(vs, ACESViolation{Reason: "multi-part image"})
+	}
+	if vf.tiled {
+		vs = append(vs, ACESViolation{Reason: "tiled image"})
+	}
+	if vf.deep {
+		vs = append(vs, ACESViolation{Reason: "deep image"})
+	}
+	return append(vs, headers[0].ValidateACES()...), nil
+}
+
+// ValidateACES checks the header against the ACES image container profile.
+// It returns every violation it found, or nil if the header follows the profile.
+func (h Header) ValidateACES() []ACESViolation {
+	var vs []ACESViolation
+	violate := func(name, format string, a ...interface{}) {
+		vs = append(vs, ACESViolation{Attribute: name, Reason: fmt.Sprintf(format, a...)})
+	}
+	// attr returns the named attribute, if it has the type and the size.
+	// Otherwise, it reports the violation.
+	attr := func(name, typ string, size int) (attribute, bool) {
+		a, ok := h[name]
+		if !ok {
+			violate(name, "missing attribute")
+			return attribute{}, false
+		}
+		if a.typ != typ {
+			violate(name, "type is %s, want %s", a.typ, typ)
+			return attribute{}, false
+		}
+		if size >= 0 && len(a.value) != size {
+			violate(name, "invalid size of value: %d", len(a.value))
+			return attribute{}, false
+		}
+		return a, true
+	}
+
+	if a, ok := attr("acesImageContainerFlag", "int", 4); ok {
+		if v, _ := intFromBytes(a.value); v != 1 {
+			violate(a.name, "value is %d, want 1", v)
+		}
+	}
+	if a, ok := attr("chromaticities", "chromaticities", 32); ok {
+		if c, _ := chromaticitiesFromBytes(a.value); !nearChromaticities(c, ACESChromaticities) {
+			violate(a.name, "not ACES AP0 primaries and white point: %v", c)
+		}
+	}
+	for _, name := range acesRequiredAttributes {
+		if _, ok := h[name]; !ok {
+			violate(name, "missing attribute")
+		}
+	}
+	if a, ok := h["compression"]; ok && a.typ == "compression" && len(a.value) == 1 {
+		switch c, _ := compressionFromBytes(a.value); c {
+		case NO_COMPRESSION, PIZ_COMPRESSION, B44A_COMPRESSION:
+		default:
+			violate(a.name, "%v is not allowed", c)
+		}
+	}
+	if a, ok := h["lineOrder"]; ok && a.typ == "lineOrder" && len(a.value) == 1 {
+		if o, _ := lineOrderFromBytes(a.value); o != INCREASING_Y && o != DECREASING_Y {
+			violate(a.name, "%v is not allowed", o)
+		}
+	}
+	if a, ok := h["channels"]; ok && a.typ == "chlist" {
+		has := make(map[string]bool)
+		chans, err := chlistFromBytes(a.value)
+		if err != nil {
+			violate(a.name, "%v", err)
+		}
+		for _, ch := range chans {
+			has[ch.name] = true
+			switch ch.name {
+			case "R", "G", "B", "A":
+			default:
+				violate(a.name, "channel %q is not allowed", ch.name)
+				continue
+			}
+			if ch.pixelType != HALF {
+				violate(a.name, "channel %q has %v type, want HALF", ch.name, ch.pixelType)
+			}
+			if ch.xSampling != 1 || ch.ySampling != 1 {
+				violate(a.name, "channel %q is subsampled", ch.name)
+			}
+		}
+		for _, name := range []string{"R", "G", "B"} {
+			if !has[name] {
+				violate(a.name, "missing channel %q", name)
+			}
+		}
+	}
+	return vs
+}
+
+// nearChromaticities reports whether chromaticities a and b are the same,
+// with tolerance of rounding errors.
+func nearChromaticities(a, b Chromaticities) bool {
+	av := []float32{a.RedX, a.RedY, a.GreenX, a.GreenY, a.BlueX, a.BlueY, a.WhiteX, a.WhiteY}
+	bv := []float32{b.RedX, b.RedY, b.GreenX, b.GreenY, b.BlueX, b.BlueY, b.WhiteX, b.WhiteY}
+	for i := range av {
+		if math.Abs(float64(av[i]-bv[i])) > 1e-4 {
+			return false
+		}
+	}
+	return true
+}
+
+// toACES returns an image that follows the ACES image container profile,
+// converted from m. Colors are converted to ACES AP0 primaries and white point,
+// and color channels are converted to HALF type.
+// The header of the returned image is a copy of m's, with the ACES specific attributes.
+//
+// It returns an error when m has channels other than color channels.
+func toACES(m *Image) (*Image, error) {
+	m = m.ConvertChromaticities(ACESChromaticities)
+	u := &Image{
+		Header: m.Header.copy(),
+		Rect:   m.Rect,
+	}
+	u.Header.SetChromaticities(ACESChromaticities)
+	u.Header.SetInt("acesImageContainerFlag", 1)
+	for _, c := range m.Channels {
+		switch c.Name {
+		case "R", "G", "B", "A":
+		default:
+			return nil, ACESViolation{Attribute: "channels", Reason: fmt.Sprintf("channel %q is not allowed", c.Name)}
+		}
+		c = c.Upsample(m.Rect)
+		if c.Type != HALF {
+			h := newChannel(channel{name: c.Name, pixelType: HALF, xSampling: 1, ySampling: 1}, m.Rect)
+			h.PLinear = c.PLinear
+			for i := range h.Float {
+				if c.Uint != nil {
+					h.Float[i] = float32(c.Uint[i])
+				} else {
+					h.Float[i] = c.Float[i]
+				}
+			}
+			c = h
+		}
+		u.Channels = append(u.Channels, c)
+	}
+	return u, nil
+}
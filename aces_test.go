@@ -0,0 +1,113 @@
+package exr
+
+import (
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeACES(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 5)
+	}
+	path := encodeTemp(t, src, &Options{ACES: true})
+	defer os.RemoveAll(filepath.Dir(path))
+	vs, err := ValidateACES(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 0 {
+		t.Fatalf("encoded image violates ACES profile: %v", vs)
+	}
+	m, err := Decode(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range m.(*Image).Channels {
+		if c.Type != HALF {
+			t.Fatalf("channel %q: got %v type, want HALF", c.Name, c.Type)
+		}
+	}
+
+	extra := &Image{
+		Header: make(Header),
+		Rect:   image.Rect(0, 0, 1, 1),
+		Channels: []*Channel{
+			{Name: "R", Type: HALF, Rect: image.Rect(0, 0, 1, 1), Float: []float32{1}},
+			{Name: "Z", Type: FLOAT, Rect: image.Rect(0, 0, 1, 1), Float: []float32{1}},
+		},
+	}
+	err = Encode(ioutil.Discard, extra, &Options{ACES: true})
+	if _, ok := err.(ACESViolation); !ok {
+		t.Fatalf("encode image that has Z channel: got error %v, want ACESViolation", err)
+	}
+	err = Encode(ioutil.Discard, src, &Options{ACES: true, LuminanceChroma: true})
+	if _, ok := err.(ACESViolation); !ok {
+		t.Fatalf("encode luminance/chroma image: got error %v, want ACESViolation", err)
+	}
+	err = Encode(ioutil.Discard, src, &Options{ACES: true, LineOrder: RANDOM_Y})
+	if v, ok := err.(ACESViolation); !ok || v.Attribute != "lineOrder" {
+		t.Fatalf("encode RANDOM_Y line order: got error %v, want ACESViolation of lineOrder", err)
+	}
+	path = encodeTemp(t, src, &Options{ACES: true, LineOrder: DECREASING_Y})
+	defer os.RemoveAll(filepath.Dir(path))
+	if vs, err := ValidateACES(path); err != nil || len(vs) != 0 {
+		t.Fatalf("DECREASING_Y line order: got violations (%v, %v)", vs, err)
+	}
+}
+
+func TestValidateACES(t *testing.T) {
+	h := make(Header)
+	h.SetChromaticities(Rec709Chromaticities)
+	h.SetInt("acesImageContainerFlag", 2)
+	h.SetAttribute("compression", "compression", []byte{byte(ZIP_COMPRESSION)})
+	h.SetAttribute("lineOrder", "lineOrder", []byte{byte(RANDOM_Y)})
+	h.SetAttribute("channels", "chlist", chlistToBytes(chlist{
+		{name: "G", pixelType: HALF, xSampling: 1, ySampling: 1},
+		{name: "R", pixelType: FLOAT, xSampling: 1, ySampling: 1},
+		{name: "Z", pixelType: FLOAT, xSampling: 1, ySampling: 1},
+	}))
+	h.SetAttribute("dataWindow", "box2i", box2iToBytes(box2i{0, 0, 1, 1}))
+	h.SetAttribute("displayWindow", "box2i", box2iToBytes(box2i{0, 0, 1, 1}))
+	h.SetFloat("pixelAspectRatio", 1)
+	h.SetAttribute("screenWindowCenter", "v2f", v2fToBytes(v2f{0, 0}))
+
+	want := map[ACESViolation]bool{
+		{"acesImageContainerFlag", "value is 2, want 1"}:                                                    true,
+		{"chromaticities", fmt.Sprintf("not ACES AP0 primaries and white point: %v", Rec709Chromaticities)}: true,
+		{"screenWindowWidth", "missing attribute"}:                                                          true,
+		{"compression", "ZIP_COMPRESSION is not allowed"}:                                                   true,
+		{"lineOrder", "RANDOM_Y is not allowed"}:                                                            true,
+		{"channels", `channel "R" has FLOAT type, want HALF`}:                                               true,
+		{"channels", `channel "Z" is not allowed`}:                                                          true,
+		{"channels", `missing channel "B"`}:                                                                 true,
+	}
+	got := h.ValidateACES()
+	for _, v := range got {
+		if !want[v] {
+			t.Fatalf("unexpected violation: %v", v)
+		}
+		delete(want, v)
+	}
+	for v := range want {
+		t.Fatalf("violation not reported: %v", v)
+	}
+
+	vs, err := ValidateACES("image/scanline.exr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, v := range vs {
+		if v.Attribute == "acesImageContainerFlag" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("missing acesImageContainerFlag not reported: %v", vs)
+	}
+}
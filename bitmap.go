@@ -14,17 +14,17 @@ type bitmap []byte
 
 // newBitmap returns a new bitmap that can hold up to n - 1.
 // If n % 8 != 0, it will round up to nearest multiple of 8.
-// When n is greater than DATA_RANGE, it will panic.
-func newBitmap(n int) bitmap {
-	if n > DATA_RANGE {
-		panic(fmt.Sprintf("bitmap could not hold more than %d\n", DATA_RANGE))
+// When n is negative or greater than DATA_RANGE, it returns an error.
+func newBitmap(n int) (bitmap, error) {
+	if n < 0 || n > DATA_RANGE {
+		return nil, fmt.Errorf("bitmap could not hold %d numbers, the maximum is %d", n, DATA_RANGE)
 	}
 	nbyte := n / 8
 	if n%8 != 0 {
 		nbyte++
 	}
 	b := make([]byte, nbyte)
-	return b
+	return b, nil
 }
 
 func (b bitmap) Set(i uint16) {
@@ -62,7 +62,7 @@ func (b bitmap) MaxByteIndex() int {
 
 // forwardLutFromBitmap returns a lut and it's max value.
 // The lut maps a data number to a incremental number.
-func forwardLutFromBitmap(b bitmap) []uint16 {
+func forwardLutFromBitmap(b bitmap) ([]uint16, uint16) {
 	lut := make([]uint16, DATA_RANGE)
 	k := 0
 	for d := range lut {
@@ -73,12 +73,12 @@ func forwardLutFromBitmap(b bitmap) []uint16 {
 			lut[d] = 0
 		}
 	}
-	return lut
+	return lut, uint16(k - 1)
 }
 
 // reverseLutFromBitmap returns a reverse lut and it's max index.
 // The lut restores a data number from a incremental number.
-func reverseLutFromBitmap(b bitmap) []uint16 {
+func reverseLutFromBitmap(b bitmap) ([]uint16, uint16) {
 	lut := make([]uint16, DATA_RANGE)
 	k := 0
 	for d := range lut {
@@ -87,5 +87,5 @@ func reverseLutFromBitmap(b bitmap) []uint16 {
 			k++
 		}
 	}
-	return lut
+	return lut, uint16(k - 1)
 }
@@ -24,7 +24,10 @@ func TestBitmap(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		got := newBitmap(c.n)
+		got, err := newBitmap(c.n)
+		if err != nil {
+			t.Fatalf("newBitmap[%d]: %v", i, err)
+		}
 		if len(got) != c.nbyte {
 			t.Fatalf("nbyte[%d]: initialzed with length %d, want %d", i, len(got), c.nbyte)
 		}
@@ -43,4 +46,7 @@ func TestBitmap(t *testing.T) {
 			t.Fatalf("want[%d]: got %d, want %d", i, got, c.want)
 		}
 	}
+	if _, err := newBitmap(DATA_RANGE + 1); err == nil {
+		t.Fatalf("newBitmap(%d): want an error", DATA_RANGE+1)
+	}
 }
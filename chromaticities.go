@@ -0,0 +1,247 @@
+package exr
+
+// Rec709Chromaticities are chromaticities of ITU-R BT.709 primaries
+// and D65 white point. Images without the chromaticities attribute
+// are considered to have them.
+var Rec709Chromaticities = Chromaticities{
+	RedX:   0.6400,
+	RedY:   0.3300,
+	GreenX: 0.3000,
+	GreenY: 0.6000,
+	BlueX:  0.1500,
+	BlueY:  0.0600,
+	WhiteX: 0.3127,
+	WhiteY: 0.3290,
+}
+
+// ACESChromaticities are chromaticities of ACES AP0 primaries and white point,
+// that are used in ACES image containers (SMPTE ST 2065-4).
+var ACESChromaticities = Chromaticities{
+	RedX:   0.73470,
+	RedY:   0.26530,
+	GreenX: 0.00000,
+	GreenY: 1.00000,
+	BlueX:  0.00010,
+	BlueY:  -0.07700,
+	WhiteX: 0.32168,
+	WhiteY: 0.33767,
+}
+
+// Chromaticities returns chromaticities of the header.
+// When the header doesn't have the attribute, it returns Rec709Chromaticities.
+func (h Header) Chromaticities() Chromaticities {
+	attr, ok := h["chromaticities"]
+	if !ok || attr.typ != "chromaticities" {
+		return Rec709Chromaticities
+	}
+	c, err := chromaticitiesFromBytes(attr.value)
+	if err != nil {
+		return Rec709Chromaticities
+	}
+	return c
+}
+
+// SetChromaticities sets the chromaticities attribute of the header.
+func (h Header) SetChromaticities(c Chromaticities) {
+	h.SetAttribute("chromaticities", "chromaticities", chromaticitiesToBytes(c))
+}
+
+// Matrix3 is a 3x3 matrix that transforms column vectors,
+// such as RGB or CIE XYZ colors.
+type Matrix3 [3][3]float64
+
+// Mul returns the matrix product m * n.
+// The result transforms a vector by n first, then by m.
+func (m Matrix3) Mul(n Matrix3) Matrix3 {
+	var o Matrix3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				o[i][j] += m[i][k] * n[k][j]
+			}
+		}
+	}
+	return o
+}
+
+// Apply transforms the vector v by m.
+func (m Matrix3) Apply(v [3]float64) [3]float64 {
+	return [3]float64{
+		m[0][0]*v[0] + m[0][1]*v[1] + m[0][2]*v[2],
+		m[1][0]*v[0] + m[1][1]*v[1] + m[1][2]*v[2],
+		m[2][0]*v[0] + m[2][1]*v[1] + m[2][2]*v[2],
+	}
+}
+
+// Inverse returns the inverse matrix of m.
+func (m Matrix3) Inverse() Matrix3 {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	return Matrix3{
+		{
+			(m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det,
+			(m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det,
+			(m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det,
+		},
+		{
+			(m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det,
+			(m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det,
+			(m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det,
+		},
+		{
+			(m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det,
+			(m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det,
+			(m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det,
+		},
+	}
+}
+
+// diag returns a diagonal matrix those diagonal elements are v.
+func diag(v [3]float64) Matrix3 {
+	return Matrix3{
+		{v[0], 0, 0},
+		{0, v[1], 0},
+		{0, 0, v[2]},
+	}
+}
+
+// xyz returns XYZ of a chromaticity (x, y), those luminance (Y) is 1.
+func xyz(x, y float32) [3]float64 {
+	return [3]float64{float64(x) / float64(y), 1, float64(1-x-y) / float64(y)}
+}
+
+// white returns XYZ of the white point, those luminance (Y) is 1.
+func (c Chromaticities) white() [3]float64 {
+	return xyz(c.WhiteX, c.WhiteY)
+}
+
+// RGBToXYZ returns a matrix that converts RGB colors to CIE XYZ.
+// RGB (1, 1, 1) is converted to the white point, those luminance is 1.
+func (c Chromaticities) RGBToXYZ() Matrix3 {
+	r := xyz(c.RedX, c.RedY)
+	g := xyz(c.GreenX, c.GreenY)
+	b := xyz(c.BlueX, c.BlueY)
+	p := Matrix3{
+		{r[0], g[0], b[0]},
+		{r[1], g[1], b[1]},
+		{r[2], g[2], b[2]},
+	}
+	// scale each primary, so they sum up to the white point.
+	s := p.Inverse().Apply(c.white())
+	return p.Mul(diag(s))
+}
+
+// XYZToRGB returns a matrix that converts CIE XYZ colors to RGB.
+// It is the inverse of RGBToXYZ.
+func (c Chromaticities) XYZToRGB() Matrix3 {
+	return c.RGBToXYZ().Inverse()
+}
+
+// bradford converts CIE XYZ to the cone response domain of the Bradford transform.
+var bradford = Matrix3{
+	{0.8951, 0.2664, -0.1614},
+	{-0.7502, 1.7135, 0.0367},
+	{0.0389, -0.0685, 1.0296},
+}
+
+// chromaticAdaptation returns a matrix that adapts CIE XYZ colors
+// seen under the white point src to the white point dst,
+// with the Bradford transform.
+func chromaticAdaptation(src, dst [3]float64) Matrix3 {
+	s := bradford.Apply(src)
+	d := bradford.Apply(dst)
+	scale := diag([3]float64{d[0] / s[0], d[1] / s[1], d[2] / s[2]})
+	return bradford.Inverse().Mul(scale).Mul(bradford)
+}
+
+// ConversionMatrix returns a matrix that converts RGB colors in the color space of src
+// to the color space of dst. When the white points differ,
+// colors are adapted to dst's white point with the Bradford transform.
+func ConversionMatrix(src, dst Chromaticities) Matrix3 {
+	m := src.RGBToXYZ()
+	if src.WhiteX != dst.WhiteX || src.WhiteY != dst.WhiteY {
+		m = chromaticAdaptation(src.white(), dst.white()).Mul(m)
+	}
+	return dst.XYZToRGB().Mul(m)
+}
+
+// luminanceWeights returns weights of R, G, B to compute luminance (Y).
+func luminanceWeights(c Chromaticities) [3]float32 {
+	m := c.RGBToXYZ()
+	sum := m[1][0] + m[1][1] + m[1][2]
+	return [3]float32{
+		float32(m[1][0] / sum),
+		float32(m[1][1] / sum),
+		float32(m[1][2] / sum),
+	}
+}
+
+// ConvertChromaticities returns an image those R, G and B channels are converted
+// from the color space of m's chromaticities to the color space of dst.
+// The header of the returned image is a copy of m's, with chromaticities set to dst.
+//
+// Colors of a luminance/chroma image are converted to R, G and B channels.
+// Subsampled color channels are upsampled, and missing color channels are considered as 0.
+// Other channels, such as A, are shared with m.
+// When m doesn't have color channels, it returns m itself.
+func (m *Image) ConvertChromaticities(dst Chromaticities) *Image {
+	m = m.ToRGB()
+	rc, gc, bc := m.Channel("R"), m.Channel("G"), m.Channel("B")
+	if rc == nil && gc == nil && bc == nil {
+		return m
+	}
+	typ := FLOAT
+	for _, c := range []*Channel{rc, gc, bc} {
+		if c != nil {
+			if c.Type != UINT {
+				typ = c.Type
+			}
+			break
+		}
+	}
+	conv := ConversionMatrix(m.Header.Chromaticities(), dst)
+	header := m.Header.copy()
+	header.SetChromaticities(dst)
+
+	planes := [3]*Channel{rc, gc, bc}
+	u := &Image{
+		Header: header,
+		Rect:   m.Rect,
+	}
+	for _, c := range m.Channels {
+		if c.Name != "R" && c.Name != "G" && c.Name != "B" {
+			u.Channels = append(u.Channels, c)
+		}
+	}
+	var out [3]*Channel
+	for i, name := range []string{"R", "G", "B"} {
+		out[i] = newChannel(channel{name: name, pixelType: typ, xSampling: 1, ySampling: 1}, m.Rect)
+		if planes[i] != nil {
+			out[i].PLinear = planes[i].PLinear
+			planes[i] = planes[i].Upsample(m.Rect)
+		}
+	}
+	u.Channels = append(u.Channels, out[0], out[1], out[2])
+	sortChannels(u.Channels)
+
+	n := m.Rect.Dx() * m.Rect.Dy()
+	for i := 0; i < n; i++ {
+		var v [3]float64
+		for j, c := range planes {
+			if c == nil {
+				continue
+			}
+			if c.Uint != nil {
+				v[j] = float64(c.Uint[i])
+			} else {
+				v[j] = float64(c.Float[i])
+			}
+		}
+		v = conv.Apply(v)
+		for j := range out {
+			out[j].Float[i] = float32(v[j])
+		}
+	}
+	return u
+}
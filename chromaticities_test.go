@@ -0,0 +1,112 @@
+package exr
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func matrixNear(a, b Matrix3, eps float64) bool {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if math.Abs(a[i][j]-b[i][j]) > eps {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestConversionMatrix(t *testing.T) {
+	cases := []struct {
+		name string
+		got  Matrix3
+		want Matrix3
+	}{
+		{
+			name: "Rec.709 RGB to XYZ",
+			got:  Rec709Chromaticities.RGBToXYZ(),
+			want: Matrix3{
+				{0.4124, 0.3576, 0.1805},
+				{0.2126, 0.7152, 0.0722},
+				{0.0193, 0.1192, 0.9505},
+			},
+		},
+		{
+			name: "ACES AP0 to Rec.709",
+			got:  ConversionMatrix(ACESChromaticities, Rec709Chromaticities),
+			want: Matrix3{
+				{2.5217, -1.1341, -0.3876},
+				{-0.2765, 1.3727, -0.0962},
+				{-0.0154, -0.1530, 1.1684},
+			},
+		},
+		{
+			name: "Rec.709 to Rec.709",
+			got:  ConversionMatrix(Rec709Chromaticities, Rec709Chromaticities),
+			want: diag([3]float64{1, 1, 1}),
+		},
+		{
+			name: "inverse",
+			got:  Rec709Chromaticities.XYZToRGB().Mul(Rec709Chromaticities.RGBToXYZ()),
+			want: diag([3]float64{1, 1, 1}),
+		},
+	}
+	for _, c := range cases {
+		if !matrixNear(c.got, c.want, 1e-3) {
+			t.Fatalf("%s: got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestHeaderChromaticities(t *testing.T) {
+	h := make(Header)
+	if got := h.Chromaticities(); got != Rec709Chromaticities {
+		t.Fatalf("default chromaticities: got %v, want %v", got, Rec709Chromaticities)
+	}
+	h.SetChromaticities(ACESChromaticities)
+	if got := h.Chromaticities(); got != ACESChromaticities {
+		t.Fatalf("chromaticities: got %v, want %v", got, ACESChromaticities)
+	}
+}
+
+func TestConvertChromaticities(t *testing.T) {
+	rect := image.Rect(0, 0, 2, 1)
+	h := make(Header)
+	h.SetChromaticities(ACESChromaticities)
+	m := &Image{
+		Header: h,
+		Rect:   rect,
+		Channels: []*Channel{
+			{Name: "A", Type: HALF, Rect: rect, Float: []float32{1, 0.5}},
+			{Name: "B", Type: HALF, Rect: rect, Float: []float32{1, 0}},
+			{Name: "G", Type: HALF, Rect: rect, Float: []float32{1, 0}},
+			{Name: "R", Type: HALF, Rect: rect, Float: []float32{1, 1}},
+		},
+	}
+	got := m.ConvertChromaticities(Rec709Chromaticities)
+	if c := got.Header.Chromaticities(); c != Rec709Chromaticities {
+		t.Fatalf("chromaticities: got %v, want %v", c, Rec709Chromaticities)
+	}
+	if m.Header.Chromaticities() != ACESChromaticities {
+		t.Fatal("header of the source image is modified")
+	}
+	want := map[string][]float32{
+		// White stays white, and AP0 red is out of Rec.709 gamut.
+		"R": {1, 2.5217},
+		"G": {1, -0.2765},
+		"B": {1, -0.0154},
+		"A": {1, 0.5},
+	}
+	for name, vs := range want {
+		c := got.Channel(name)
+		if c == nil {
+			t.Fatalf("channel %q not found", name)
+		}
+		for i, v := range vs {
+			if math.Abs(float64(c.Float[i]-v)) > 1e-3 {
+				t.Fatalf("channel %q at %d: got %v, want %v", name, i, c.Float[i], v)
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Command exrstdattr sets attributes in headers of an exr image.
+//
+// It rewrites only the headers. Compressed pixel data is copied untouched.
+//
+// Usage:
+//
+// 	exrstdattr [flags] infile outfile
+//
+// infile and outfile could be the same file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/coldmine/exr"
+)
+
+// attrFlag is a flag that could be set multiple times
+// with "name=value" formed arguments.
+type attrFlag []string
+
+func (f *attrFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *attrFlag) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return fmt.Errorf("want name=value, got %q", v)
+	}
+	*f = append(*f, v)
+	return nil
+}
+
+// each calls fn with name and value of each argument.
+func (f attrFlag) each(fn func(name, value string) error) error {
+	for _, v := range f {
+		i := strings.Index(v, "=")
+		if err := fn(v[:i], v[i+1:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	var (
+		part     = flag.Int("part", -1, "index of the part to modify, -1 modifies all parts")
+		owner    = flag.String("owner", "", "set owner of the image")
+		comments = flag.String("comments", "", "set comments of the image")
+		capDate  = flag.String("capDate", "", "set capture date of the image, \"YYYY:MM:DD hh:mm:ss\"")
+		timeCode = flag.String("timeCode", "", "set time code of the image, \"hh:mm:ss:ff\"")
+		strs     attrFlag
+		ints     attrFlag
+		floats   attrFlag
+	)
+	flag.Var(&strs, "string", "set a string attribute, name=value")
+	flag.Var(&ints, "int", "set an int attribute, name=value")
+	flag.Var(&floats, "float", "set a float attribute, name=value")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: exrstdattr [flags] infile outfile\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	infile, outfile := flag.Arg(0), flag.Arg(1)
+
+	edit := func(i int, h exr.Header) error {
+		if *part >= 0 && i != *part {
+			return nil
+		}
+		if *owner != "" {
+			h.SetOwner(*owner)
+		}
+		if *comments != "" {
+			h.SetComments(*comments)
+		}
+		if *capDate != "" {
+			if err := h.SetCapDate(*capDate); err != nil {
+				return err
+			}
+		}
+		if *timeCode != "" {
+			tc, err := exr.ParseTimecode(*timeCode)
+			if err != nil {
+				return err
+			}
+			if err := h.SetTimeCode(tc); err != nil {
+				return err
+			}
+		}
+		err := strs.each(func(name, value string) error {
+			h.SetString(name, value)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = ints.each(func(name, value string) error {
+			v, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid int attribute %q: %v", name, err)
+			}
+			h.SetInt(name, int32(v))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return floats.each(func(name, value string) error {
+			v, err := strconv.ParseFloat(value, 32)
+			if err != nil {
+				return fmt.Errorf("invalid float attribute %q: %v", name, err)
+			}
+			h.SetFloat(name, float32(v))
+			return nil
+		})
+	}
+	if err := rewrite(infile, outfile, edit); err != nil {
+		fmt.Fprintln(os.Stderr, "exrstdattr:", err)
+		os.Exit(1)
+	}
+}
+
+// rewrite rewrites infile to outfile with edited headers.
+// It writes to a temporary file first, so infile and outfile could be the same.
+func rewrite(infile, outfile string, edit func(int, exr.Header) error) error {
+	src, err := os.Open(infile)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp, err := ioutil.TempFile(filepath.Dir(outfile), ".exrstdattr")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := exr.RewriteHeaders(tmp, src, edit); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), outfile)
+}
@@ -0,0 +1,821 @@
+package exr
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"sort"
+	"sync"
+)
+
+// decoder reads parts of an exr image from r.
+type decoder struct {
+	r       io.ReaderAt
+	size    int64 // size of the file
+	vf      VersionField
+	headers []Header
+
+	// offsets are offset tables of each part.
+	offsets [][]uint64
+
+	// chunkStart is the offset of the first chunk, right after the offset tables.
+	chunkStart uint64
+
+	// limits are checked before allocations for the image.
+	limits *Limits
+
+	// tableSize is the total size of the offset tables in bytes.
+	tableSize int64
+}
+
+// ErrMissingChunk reports that a chunk is missing in a file,
+// because it's offset is invalid or the file is truncated.
+var ErrMissingChunk = errors.New("exr: missing chunk")
+
+// A ChunkError reports a chunk that couldn't be decoded.
+type ChunkError struct {
+	// Part is index of the part that has the chunk.
+	Part int
+
+	// Index is index of the chunk in the offset table.
+	// It is -1 for a chunk that is broken before it's coordinates are read,
+	// so it's block is unknown.
+	Index int
+
+	// Lines are the lines the chunk has, from Lines[0] to Lines[1] (exclusive).
+	// For a tile, they are the lines the tile covers.
+	// They are zeros when Index is -1.
+	Lines [2]int
+
+	// Offset is the position of the chunk in the file, when Index is -1.
+	Offset uint64
+
+	// Err is the reason.
+	Err error
+}
+
+func (e *ChunkError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("exr: chunk at offset %d of part %d: %v", e.Offset, e.Part, e.Err)
+	}
+	return fmt.Sprintf("exr: chunk %d (lines %d to %d) of part %d: %v", e.Index, e.Lines[0], e.Lines[1]-1, e.Part, e.Err)
+}
+
+// An IncompleteError reports that some chunks of an image couldn't be decoded,
+// such as in a file of an interrupted render. The image decoded with the error
+// has pixel values of the other chunks. Pixels in the lines of the failed chunks
+// are 0, or DecodeOptions.Fill in the tolerant mode.
+type IncompleteError struct {
+	// Chunks are the failed chunks, in the order of their indices,
+	// followed by the chunks those blocks are unknown, in the order of their offsets.
+	Chunks []*ChunkError
+}
+
+func (e *IncompleteError) Error() string {
+	if len(e.Chunks) == 1 {
+		return e.Chunks[0].Error()
+	}
+	return fmt.Sprintf("exr: %d chunks couldn't be decoded: first one is %v", len(e.Chunks), e.Chunks[0])
+}
+
+// newDecoder reads headers and offset tables of an exr image, that has size bytes.
+//
+// When an offset table has invalid offsets, such as zeros left by an incomplete render,
+// it tries to reconstruct the table by scanning the chunks sequentially.
+//
+// The image is checked with l before allocations. A nil l is the same with DefaultLimits.
+func newDecoder(r io.ReaderAt, size int64, l *Limits) (*decoder, error) {
+	l = limitsOrDefault(l)
+	br := bufio.NewReader(io.NewSectionReader(r, 0, size))
+	vf, err := readVersion(br)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := readHeaders(br, vf, l)
+	if err != nil {
+		return nil, err
+	}
+	offsets, tableSize, err := readOffsetTables(br, vf, headers, size, l)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{
+		r:          r,
+		size:       size,
+		vf:         vf,
+		headers:    headers,
+		offsets:    offsets,
+		chunkStart: uint64(8+len(headersToBytes(vf, headers))) + uint64(tableSize),
+		limits:     l,
+		tableSize:  tableSize,
+	}
+	for _, offs := range offsets {
+		for _, o := range offs {
+			if !d.validOffset(o) {
+				d.reconstructOffsets()
+				return d, nil
+			}
+		}
+	}
+	return d, nil
+}
+
+// validOffset reports whether a chunk could be at offset o.
+func (d *decoder) validOffset(o uint64) bool {
+	return o >= d.chunkStart && o < uint64(d.size)
+}
+
+// isTiled reports whether i-th part is a tiled part.
+func (d *decoder) isTiled(i int) bool {
+	if d.vf.multiPart {
+		typ, ok := d.headers[i]["type"]
+		return ok && string(typ.value) == "tiledimage"
+	}
+	return d.vf.tiled
+}
+
+// chunkHeadSize returns size of the fields before data of a chunk in i-th part.
+func (d *decoder) chunkHeadSize(i int) int {
+	n := 8 // y, data size
+	if d.isTiled(i) {
+		n = 20 // tile x, tile y, level x, level y, data size
+	}
+	if d.vf.multiPart {
+		n += 4 // part number
+	}
+	return n
+}
+
+// reconstructOffsets fills invalid offsets of the tables, by reading chunks
+// one after another from the first chunk, in the same way with OpenEXR.
+// It stops at the end of the file, or at a chunk that doesn't look valid.
+// Offsets of chunks those aren't found are left invalid.
+//
+// Only chunks of scanline parts could be found.
+func (d *decoder) reconstructOffsets() {
+	type scanline struct {
+		yMin, yMax, blockLines int
+	}
+	parts := make([]*scanline, len(d.headers))
+	for i, h := range d.headers {
+		if d.isTiled(i) || d.vf.deep {
+			continue
+		}
+		if typ, ok := h["type"]; ok && string(typ.value) != "scanlineimage" {
+			continue
+		}
+		dw, ok := h.box2iAttribute("dataWindow")
+		c, cok := h["compression"]
+		if !ok || !cok || len(c.value) != 1 {
+			continue
+		}
+		comp, _ := compressionFromBytes(c.value)
+		blockLines, ok := numLinesPerBlock[comp]
+		if !ok {
+			continue
+		}
+		parts[i] = &scanline{dw.Min.Y, dw.Max.Y, blockLines}
+	}
+
+	o := d.chunkStart
+	for {
+		part := 0
+		n := 0
+		if d.vf.multiPart {
+			b := make([]byte, 4)
+			if _, err := d.r.ReadAt(b, int64(o)); err != nil {
+				return
+			}
+			part = int(int32(parse.Uint32(b)))
+			n = 4
+		}
+		if part < 0 || part >= len(parts) || parts[part] == nil {
+			return
+		}
+		p := parts[part]
+		b := make([]byte, 8)
+		if _, err := d.r.ReadAt(b, int64(o)+int64(n)); err != nil {
+			return
+		}
+		n += 8
+		y := int(int32(parse.Uint32(b[:4])))
+		size := uint64(parse.Uint32(b[4:8]))
+		if y < p.yMin || y >= p.yMax || (y-p.yMin)%p.blockLines != 0 {
+			return
+		}
+		if o+uint64(n)+size > uint64(d.size) {
+			// truncated chunk
+			return
+		}
+		i := (y - p.yMin) / p.blockLines
+		if i < len(d.offsets[part]) && !d.validOffset(d.offsets[part][i]) {
+			d.offsets[part][i] = o
+		}
+		o += uint64(n) + size
+	}
+}
+
+// partInfo has information of a part, that is needed to decode it's chunks.
+type partInfo struct {
+	channels    chlist
+	dataWindow  box2i
+	compression compression
+	lineOrder   lineOrder
+
+	// tiles is the tile description of a tiled part. It is nil for a scanline part.
+	tiles *tiledesc
+
+	// skip is true for channels those aren't decoded. It is nil when all channels are decoded.
+	skip []bool
+}
+
+// partInfo gets information of i-th part from it's header.
+func (d *decoder) partInfo(i int) (partInfo, error) {
+	h := d.headers[i]
+	if typ, ok := h["type"]; ok {
+		if t := string(typ.value); t != "scanlineimage" && t != "tiledimage" {
+			return partInfo{}, UnsupportedError(fmt.Sprintf("%s part", t))
+		}
+	}
+	if d.vf.deep {
+		return partInfo{}, UnsupportedError("deep image")
+	}
+	channelsAttr, ok := h["channels"]
+	if !ok {
+		return partInfo{}, FormatError("header does not have 'channels' attribute")
+	}
+	dataWindowAttr, ok := h["dataWindow"]
+	if !ok {
+		return partInfo{}, FormatError("header does not have 'dataWindow' attribute")
+	}
+	compressionAttr, ok := h["compression"]
+	if !ok {
+		return partInfo{}, FormatError("header does not have 'compression' attribute")
+	}
+	lineOrderAttr, ok := h["lineOrder"]
+	if !ok {
+		return partInfo{}, FormatError("header does not have 'lineOrder' attribute")
+	}
+	channels, err := chlistFromBytes(channelsAttr.value)
+	if err != nil {
+		return partInfo{}, err
+	}
+	dataWindow, err := box2iFromBytes(dataWindowAttr.value)
+	if err != nil {
+		return partInfo{}, err
+	}
+	for _, ch := range channels {
+		if pixelSize(ch.pixelType) == 0 {
+			return partInfo{}, FormatError(fmt.Sprintf("unknown pixel type of channel %q: %d", ch.name, ch.pixelType))
+		}
+		if err := validateSampling(ch, dataWindow); err != nil {
+			return partInfo{}, err
+		}
+	}
+	order, err := lineOrderFromBytes(lineOrderAttr.value)
+	if err != nil {
+		return partInfo{}, err
+	}
+	if order != INCREASING_Y && order != DECREASING_Y && order != RANDOM_Y {
+		return partInfo{}, FormatError(fmt.Sprintf("unknown line order: %d", order))
+	}
+	comp, err := compressionFromBytes(compressionAttr.value)
+	if err != nil {
+		return partInfo{}, err
+	}
+	info := partInfo{
+		channels:    channels,
+		dataWindow:  dataWindow,
+		compression: comp,
+		lineOrder:   order,
+	}
+	if d.isTiled(i) {
+		tilesAttr, ok := h["tiles"]
+		if !ok {
+			return partInfo{}, FormatError("header does not have 'tiles' attribute")
+		}
+		t, err := tiledescFromBytes(tilesAttr.value)
+		if err != nil {
+			return partInfo{}, err
+		}
+		if t.xSize == 0 || t.ySize == 0 {
+			return partInfo{}, FormatError(fmt.Sprintf("invalid tile size: %dx%d", t.xSize, t.ySize))
+		}
+		info.tiles = &t
+	}
+	return info, nil
+}
+
+// rect returns the data window in image.Rectangle form.
+func (p partInfo) rect() image.Rectangle {
+	return p.dataWindow.rect()
+}
+
+// numTiles returns number of tiles of the full resolution level, in x and y direction.
+func (p partInfo) numTiles() (int, int) {
+	r := p.rect()
+	return numTilesInLevel(*p.tiles, r.Dx(), r.Dy(), 0, 0)
+}
+
+// numBlocks returns number of blocks of the full resolution image.
+// Blocks are groups of scanlines, or tiles of the full resolution level.
+// Their chunks come first in the offset table.
+func (p partInfo) numBlocks() int {
+	if p.tiles != nil {
+		nx, ny := p.numTiles()
+		return nx * ny
+	}
+	blockLines := numLinesPerBlock[p.compression]
+	return (p.rect().Dy() + blockLines - 1) / blockLines
+}
+
+// blockRect returns bounds of n-th block.
+// Blocks are indexed from the top of the data window, regardless of the line order,
+// and tiles are indexed in rows.
+func (p partInfo) blockRect(n int) image.Rectangle {
+	r := p.rect()
+	var b image.Rectangle
+	if p.tiles != nil {
+		nx, _ := p.numTiles()
+		tw, th := int(p.tiles.xSize), int(p.tiles.ySize)
+		x := r.Min.X + (n%nx)*tw
+		y := r.Min.Y + (n/nx)*th
+		b = image.Rect(x, y, x+tw, y+th)
+	} else {
+		blockLines := numLinesPerBlock[p.compression]
+		y := r.Min.Y + n*blockLines
+		b = image.Rect(r.Min.X, y, r.Max.X, y+blockLines)
+	}
+	return b.Intersect(r)
+}
+
+// blockInfo returns information of n-th block.
+func (p partInfo) blockInfo(n int) blockInfo {
+	b := p.blockRect(n)
+	block := newBlockInfo(p.compression, p.channels, b.Min.X, b.Min.Y, b.Dx(), b.Dy())
+	block.skip = p.skip
+	return block
+}
+
+// blockIndex returns index of the block that the chunk has.
+func (p partInfo) blockIndex(c chunk) (int, error) {
+	if p.tiles != nil {
+		nx, ny := p.numTiles()
+		if c.lx != 0 || c.ly != 0 || c.tx < 0 || c.tx >= nx || c.ty < 0 || c.ty >= ny {
+			return 0, FormatError(fmt.Sprintf("invalid tile coordinates of a chunk: (%d, %d), level (%d, %d)", c.tx, c.ty, c.lx, c.ly))
+		}
+		return c.ty*nx + c.tx, nil
+	}
+	w := p.dataWindow
+	blockLines := numLinesPerBlock[p.compression]
+	if c.y < int(w.yMin) || c.y > int(w.yMax) || (c.y-int(w.yMin))%blockLines != 0 {
+		return 0, FormatError(fmt.Sprintf("invalid y coordinate of a chunk: %d", c.y))
+	}
+	return (c.y - int(w.yMin)) / blockLines, nil
+}
+
+// validateSampling checks sampling rates of a channel is valid for the data window.
+// Origin and size of the data window should be divisible by the sampling rates.
+func validateSampling(ch channel, w box2i) error {
+	sx := int(ch.xSampling)
+	sy := int(ch.ySampling)
+	if sx < 1 || sy < 1 {
+		return FormatError(fmt.Sprintf("invalid sampling rates of channel %q: (%d, %d)", ch.name, sx, sy))
+	}
+	width := int(w.xMax) - int(w.xMin) + 1
+	height := int(w.yMax) - int(w.yMin) + 1
+	if modp(int(w.xMin), sx) != 0 || modp(width, sx) != 0 || modp(int(w.yMin), sy) != 0 || modp(height, sy) != 0 {
+		return FormatError(fmt.Sprintf("data window is not divisible by sampling rates of channel %q: (%d, %d)", ch.name, sx, sy))
+	}
+	return nil
+}
+
+// chunk is a chunk read from a file.
+type chunk struct {
+	// y is y coordinate of the first line of a scanline block.
+	y int
+
+	// tx and ty are coordinates of a tile, and lx and ly are level numbers of it.
+	tx, ty, lx, ly int
+
+	// offset and size are the offset and the size of the compressed data in the file.
+	offset int64
+	size   int
+}
+
+// readChunk reads fields of a chunk of i-th part at offset o.
+// The compressed data is read by readData or readRawData.
+func (d *decoder) readChunk(i int, o uint64) (chunk, error) {
+	if !d.validOffset(o) {
+		return chunk{}, ErrMissingChunk
+	}
+	n := d.chunkHeadSize(i)
+	head := make([]byte, n)
+	if _, err := d.r.ReadAt(head, int64(o)); err != nil {
+		if err == io.EOF {
+			err = ErrMissingChunk
+		}
+		return chunk{}, err
+	}
+	if d.vf.multiPart {
+		part := int(parse.Uint32(head[:4]))
+		if part != i {
+			return chunk{}, FormatError(fmt.Sprintf("chunk of part %d found in offset table of part %d", part, i))
+		}
+		head = head[4:]
+	}
+	field := func(j int) int {
+		return int(int32(parse.Uint32(head[4*j:])))
+	}
+	var c chunk
+	if d.isTiled(i) {
+		c.tx, c.ty, c.lx, c.ly = field(0), field(1), field(2), field(3)
+	} else {
+		c.y = field(0)
+	}
+	size := uint64(parse.Uint32(head[len(head)-4:]))
+	if err := d.limits.checkChunkSize(int(size)); err != nil {
+		return chunk{}, err
+	}
+	if o+uint64(n)+size > uint64(d.size) {
+		// The file is truncated.
+		return chunk{}, ErrMissingChunk
+	}
+	c.offset = int64(o) + int64(n)
+	c.size = int(size)
+	return c, nil
+}
+
+// readData reads the compressed data of the chunk.
+func (d *decoder) readData(c chunk) ([]byte, error) {
+	data := make([]byte, c.size)
+	if _, err := d.r.ReadAt(data, c.offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readRawData reads data of the chunk, that is stored uncompressed.
+// Data of the channels skipped by the block are not read, and left as 0.
+func (d *decoder) readRawData(c chunk, block blockInfo) ([]byte, error) {
+	data := make([]byte, c.size)
+	o := 0
+	for y := block.y; y < block.y+block.height; y++ {
+		for i, ch := range block.channels {
+			if modp(y, int(ch.ySampling)) != 0 {
+				continue
+			}
+			nx := numSamples(int(ch.xSampling), block.x, block.x+block.width-1)
+			size := nx * pixelSize(ch.pixelType)
+			if !block.skip[i] {
+				if _, err := d.r.ReadAt(data[o:o+size], c.offset+int64(o)); err != nil {
+					return nil, err
+				}
+			}
+			o += size
+		}
+	}
+	return data, nil
+}
+
+// decodePart decodes i-th part of the image with the options.
+// Tiled parts are decoded from the tiles of the full resolution level.
+//
+// Chunks are read in the order they are stored in the file, that is decided by the line order.
+// Each block is placed by the coordinates stored in it's chunk,
+// so the chunks of RANDOM_Y line order could be stored in any order.
+//
+// When o.Region is not empty, the image has only pixels in the region,
+// and only chunks those intersect with it are read.
+//
+// When some chunks are missing, it returns the image decoded from the other chunks,
+// with an *IncompleteError. In the tolerant mode, chunks those fail to be read
+// or decompressed are also reported by the *IncompleteError.
+func (d *decoder) decodePart(i int, o *DecodeOptions) (*Image, error) {
+	return d.decodeChannels(i, o, func(name string) bool {
+		return len(o.Channels) == 0 || channelSelected(name, o.Channels)
+	})
+}
+
+// decodeChannels decodes i-th part of the image like decodePart,
+// but decodes only the channels those selected reports true, instead of o.Channels.
+func (d *decoder) decodeChannels(i int, o *DecodeOptions, selected func(name string) bool) (*Image, error) {
+	info, err := d.partInfo(i)
+	if err != nil {
+		return nil, err
+	}
+	rect := info.rect()
+	if !o.Region.Empty() {
+		rect = rect.Intersect(o.Region)
+	}
+	var chans chlist
+	for _, ch := range info.channels {
+		if selected(ch.name) {
+			chans = append(chans, ch)
+		}
+	}
+	if err := d.limits.checkAllocation(d.tableSize + pixelBytes(chans, rect)); err != nil {
+		return nil, err
+	}
+	m := &Image{
+		Header: d.headers[i],
+		Rect:   rect,
+	}
+	// dst has the channel to unpack pixel values, for each channel in the channel list.
+	// It is nil for the channels not selected.
+	dst := make([]*Channel, len(info.channels))
+	for j, ch := range info.channels {
+		if !selected(ch.name) {
+			if info.skip == nil {
+				info.skip = make([]bool, len(info.channels))
+			}
+			info.skip[j] = true
+			continue
+		}
+		dst[j] = newChannel(ch, m.Rect)
+		m.Channels = append(m.Channels, dst[j])
+	}
+	// order has indices of the offset table those blocks are needed, sorted by the offsets.
+	numBlocks := info.numBlocks()
+	if numBlocks > len(d.offsets[i]) {
+		return nil, FormatError(fmt.Sprintf("offset table has %d offsets, want at least %d", len(d.offsets[i]), numBlocks))
+	}
+	needed := make([]bool, numBlocks)
+	order := make([]int, 0, numBlocks)
+	for n := range needed {
+		if info.blockRect(n).Overlaps(rect) {
+			needed[n] = true
+			order = append(order, n)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return d.offsets[i][order[a]] < d.offsets[i][order[b]]
+	})
+	decoded, failures, err := d.decodeChunks(i, info, dst, order, o)
+	if err != nil {
+		return nil, err
+	}
+	// failed has the first error of each block that isn't decoded.
+	failed := make(map[int]error)
+	var unknown []*ChunkError
+	for _, f := range failures {
+		if f.n < 0 {
+			unknown = append(unknown, &ChunkError{Part: i, Index: -1, Offset: f.offset, Err: f.err})
+			continue
+		}
+		if _, ok := failed[f.n]; !ok && !decoded[f.n] {
+			failed[f.n] = f.err
+		}
+	}
+	var chunks []*ChunkError
+	for n, ok := range decoded {
+		if ok || !needed[n] {
+			continue
+		}
+		err, ok := failed[n]
+		if !ok {
+			err = ErrMissingChunk
+		}
+		chunks = append(chunks, info.chunkError(i, n, err))
+		if o.Tolerant {
+			m.fill(info.blockRect(n), o.Fill)
+		}
+	}
+	if chunks != nil {
+		// When all blocks are decoded, the broken chunks are extra ones,
+		// and the image is complete.
+		return m, &IncompleteError{Chunks: append(chunks, unknown...)}
+	}
+	return m, nil
+}
+
+// chunkJob is a chunk to decode, with the index of it's block.
+type chunkJob struct {
+	seq    int // position of the chunk in the reading order
+	n      int // index of the block
+	offset uint64
+	c      chunk
+}
+
+// chunkFailure is a chunk that failed to be decoded.
+type chunkFailure struct {
+	seq    int    // position of the chunk in the reading order
+	n      int    // index of the block, or -1 when the chunk is broken before it's coordinates are known
+	offset uint64 // offset of the chunk
+	err    error
+}
+
+// decodeChunks decodes chunks of i-th part at the offsets of the blocks in order,
+// and unpacks them to dst, that has the channel for each channel in the channel list.
+// It returns whether each block is decoded, and the failed chunks in order.
+// Without o.Tolerant, it returns the error of the first failed chunk in order instead.
+//
+// Fields of the chunks are read one after another in the calling goroutine.
+// With more than one o.Workers, their data are read, decompressed and unpacked
+// by that number of goroutines. Each chunk is unpacked to pixels of it's own block,
+// and a block is decoded from only one chunk, so the goroutines write disjoint pixels of dst.
+func (d *decoder) decodeChunks(i int, info partInfo, dst []*Channel, order []int, o *DecodeOptions) ([]bool, []chunkFailure, error) {
+	numBlocks := info.numBlocks()
+	decoded := make([]bool, numBlocks)
+	claimed := make([]bool, numBlocks)
+	var (
+		mu       sync.Mutex
+		failures []chunkFailure
+	)
+	fail := func(f chunkFailure) {
+		mu.Lock()
+		failures = append(failures, f)
+		mu.Unlock()
+	}
+	stopped := func() bool {
+		if o.Tolerant {
+			return false
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return len(failures) != 0
+	}
+	run := func(j chunkJob) {
+		err := d.decodeBlock(info, dst, j.n, j.c)
+		if err == nil {
+			decoded[j.n] = true
+			return
+		}
+		if err != ErrMissingChunk {
+			fail(chunkFailure{j.seq, j.n, j.offset, err})
+		}
+	}
+
+	workers := o.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	jobs := make(chan chunkJob, workers)
+	for w := 0; w < workers && workers > 1; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				run(j)
+			}
+		}()
+	}
+	for seq, idx := range order {
+		if stopped() {
+			break
+		}
+		offset := d.offsets[i][idx]
+		c, err := d.readChunk(i, offset)
+		if err == ErrMissingChunk {
+			continue
+		}
+		n := -1
+		if err == nil {
+			n, err = info.blockIndex(c)
+		}
+		if err != nil {
+			// The chunk is broken before it's coordinates are known.
+			fail(chunkFailure{seq, -1, offset, err})
+			continue
+		}
+		if claimed[n] {
+			fail(chunkFailure{seq, n, offset, FormatError(fmt.Sprintf("duplicate chunks of block %d", n))})
+			continue
+		}
+		claimed[n] = true
+		j := chunkJob{seq, n, offset, c}
+		if workers > 1 {
+			jobs <- j
+		} else {
+			run(j)
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Failures are handled in order, as if the chunks were decoded one by one.
+	sort.Slice(failures, func(a, b int) bool {
+		return failures[a].seq < failures[b].seq
+	})
+	if len(failures) != 0 && !o.Tolerant {
+		return nil, nil, failures[0].err
+	}
+	return decoded, failures, nil
+}
+
+// decodeBlock reads data of chunk c, that has n-th block, and decompresses and unpacks it to dst.
+func (d *decoder) decodeBlock(info partInfo, dst []*Channel, n int, c chunk) error {
+	block := info.blockInfo(n)
+	if err := d.limits.checkChunkSize(block.rawSize()); err != nil {
+		return err
+	}
+	var data []byte
+	var err error
+	if info.skip != nil && c.size == block.rawSize() {
+		// Uncompressed data of the skipped channels don't need to be read.
+		data, err = d.readRawData(c, block)
+	} else {
+		data, err = d.readData(c)
+	}
+	if err != nil {
+		return err
+	}
+	raw, err := decompress(block, data)
+	if err != nil {
+		return err
+	}
+	return unpack(block, raw, dst)
+}
+
+// fill fills pixels in r of HALF and FLOAT channels with v.
+// UINT channels are filled with 0.
+func (m *Image) fill(r image.Rectangle, v float32) {
+	for _, c := range m.Channels {
+		sx, sy := c.sampling()
+		sr := sampledRect(r, sx, sy).Intersect(c.Rect)
+		for y := sr.Min.Y; y < sr.Max.Y; y++ {
+			start := c.PixOffset(sr.Min.X, y)
+			if c.Uint != nil {
+				for x := 0; x < sr.Dx(); x++ {
+					c.Uint[start+x] = 0
+				}
+				continue
+			}
+			for x := 0; x < sr.Dx(); x++ {
+				c.Float[start+x] = v
+			}
+		}
+	}
+}
+
+// chunkError returns a ChunkError of n-th chunk of i-th part.
+func (p partInfo) chunkError(i, n int, err error) *ChunkError {
+	r := p.blockRect(n)
+	return &ChunkError{Part: i, Index: n, Lines: [2]int{r.Min.Y, r.Max.Y}, Err: err}
+}
+
+// unpack copies pixel values of a decompressed block to dst,
+// that has the channel for each channel in the channel list of the block.
+// Pixel values of nil channels, and those out of bounds of the channels are dropped.
+//
+// Each line of raw has pixel values of all channels,
+// one channel after another, in the order of the channel list.
+// Subsampled channels have values only in the lines they are sampled.
+func unpack(block blockInfo, raw []byte, dst []*Channel) error {
+	if len(raw) != block.rawSize() {
+		return FormatError(fmt.Sprintf("block at (%d, %d) has wrong size of data", block.x, block.y))
+	}
+	hs := make([]uint16, block.width)
+	for y := block.y; y < block.y+block.height; y++ {
+		for j, ch := range block.channels {
+			sx, sy := int(ch.xSampling), int(ch.ySampling)
+			if modp(y, sy) != 0 {
+				continue
+			}
+			// The block has n samples from x0 in the channel's coordinate.
+			n := numSamples(sx, block.x, block.x+block.width-1)
+			x0 := divp(block.x+sx-1, sx)
+			size := n * pixelSize(ch.pixelType)
+			line := raw[:size]
+			raw = raw[size:]
+			c := dst[j]
+			if c == nil {
+				continue
+			}
+
+			cy := divp(y, sy)
+			a, b := x0, x0+n
+			if a < c.Rect.Min.X {
+				a = c.Rect.Min.X
+			}
+			if b > c.Rect.Max.X {
+				b = c.Rect.Max.X
+			}
+			if cy < c.Rect.Min.Y || cy >= c.Rect.Max.Y || a >= b {
+				continue
+			}
+			i := c.PixOffset(a, cy)
+			line = line[(a-x0)*pixelSize(c.Type):]
+			switch c.Type {
+			case UINT:
+				for x := 0; x < b-a; x++ {
+					c.Uint[i+x] = parse.Uint32(line[4*x:])
+				}
+			case HALF:
+				for x := 0; x < b-a; x++ {
+					hs[x] = parse.Uint16(line[2*x:])
+				}
+				uint16sToFloat32s(c.Float[i:i+b-a], hs[:b-a])
+			case FLOAT:
+				for x := 0; x < b-a; x++ {
+					c.Float[i+x] = math.Float32frombits(parse.Uint32(line[4*x:]))
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,700 @@
+package exr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// encodeBytes encodes m, and returns the encoded file content.
+func encodeBytes(t *testing.T, m *Image, o *Options) []byte {
+	path := encodeTemp(t, m, o)
+	defer os.RemoveAll(filepath.Dir(path))
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// decodeBytes decodes the first part of the file content b.
+func decodeBytes(t *testing.T, b []byte, o *DecodeOptions) (*Image, error) {
+	if o == nil {
+		o = &DecodeOptions{}
+	}
+	d, err := newDecoder(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d.decodePart(0, o)
+}
+
+func TestReconstructOffsets(t *testing.T) {
+	rect := image.Rect(0, 0, 4, 6)
+	m := lineOrderImage(rect)
+	for _, order := range []lineOrder{INCREASING_Y, DECREASING_Y} {
+		b := encodeBytes(t, m, &Options{LineOrder: order})
+		d, err := newDecoder(bytes.NewReader(b), int64(len(b)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Zero the offset table, like an interrupted render leaves it.
+		for i := d.chunkStart - 8*uint64(rect.Dy()); i < d.chunkStart; i++ {
+			b[i] = 0
+		}
+		got, err := decodeBytes(t, b, nil)
+		if err != nil {
+			t.Fatalf("%v: %v", order, err)
+		}
+		compareChannels(t, got, m)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	rect := image.Rect(0, 0, 4, 6)
+	m := lineOrderImage(rect)
+	b := encodeBytes(t, m, nil)
+	// Cut the file in the middle of the 5th line, and zero the offset of the 2nd line.
+	b = b[:len(b)-len(lineChunk(m.Channels, 5))-len(lineChunk(m.Channels, 4))/2]
+	d, err := newDecoder(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := d.chunkStart - 8*uint64(rect.Dy())
+	copy(b[table+8:], make([]byte, 8))
+
+	got, err := decodeBytes(t, b, nil)
+	ierr, ok := err.(*IncompleteError)
+	if !ok {
+		t.Fatalf("got error %v, want *IncompleteError", err)
+	}
+	want := []*ChunkError{
+		{Part: 0, Index: 4, Lines: [2]int{4, 5}, Err: ErrMissingChunk},
+		{Part: 0, Index: 5, Lines: [2]int{5, 6}, Err: ErrMissingChunk},
+	}
+	if len(ierr.Chunks) != len(want) {
+		t.Fatalf("missing chunks: got %v, want %v", ierr.Chunks, want)
+	}
+	for i, c := range ierr.Chunks {
+		if *c != *want[i] {
+			t.Fatalf("missing chunk: got %v, want %v", c, want[i])
+		}
+	}
+	// The zeroed offset is reconstructed, and intact lines are decoded.
+	y := got.Channel("Y")
+	for py := rect.Min.Y; py < rect.Max.Y; py++ {
+		for px := rect.Min.X; px < rect.Max.X; px++ {
+			want := float32(0)
+			if py < 4 {
+				want = m.Channel("Y").FloatAt(px, py)
+			}
+			if v := y.FloatAt(px, py); v != want {
+				t.Fatalf("pixel at (%d, %d): got %v, want %v", px, py, v, want)
+			}
+		}
+	}
+}
+
+func TestDecodeTruncatedHeader(t *testing.T) {
+	data, err := ioutil.ReadFile("image/scanline.exr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := newDecoder(bytes.NewReader(data), int64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cut the file in the version field, the headers and the offset table.
+	for n := 0; n < int(d.chunkStart); n++ {
+		b := data[:n]
+		_, err := newDecoder(bytes.NewReader(b), int64(len(b)), nil)
+		if _, ok := err.(FormatError); !ok {
+			t.Fatalf("cut to %d bytes: got %T error %v, want FormatError", n, err, err)
+		}
+	}
+}
+
+func TestDecodeTolerant(t *testing.T) {
+	rect := image.Rect(0, 0, 4, 6)
+	m := lineOrderImage(rect)
+	b := encodeBytes(t, m, nil)
+	d, err := newDecoder(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Break the data size of the 3rd chunk, and the y coordinate of the 5th chunk.
+	o := d.offsets[0][2]
+	parse.PutUint32(b[o+4:], parse.Uint32(b[o+4:])-2)
+	broken := d.offsets[0][4]
+	parse.PutUint32(b[broken:], 1000)
+
+	if got, err := decodeBytes(t, b, nil); got != nil || err == nil {
+		t.Fatalf("decode without tolerant mode: got (%v, %v), want an error", got, err)
+	}
+	got, err := decodeBytes(t, b, &DecodeOptions{Tolerant: true, Fill: -1})
+	ierr, ok := err.(*IncompleteError)
+	if !ok {
+		t.Fatalf("got error %v, want *IncompleteError", err)
+	}
+	// The chunk with the broken y coordinate isn't known to have the 5th line,
+	// so the line is reported as missing, and the chunk by it's offset.
+	want := []struct {
+		index   int
+		lines   [2]int
+		offset  uint64
+		missing bool
+	}{
+		{2, [2]int{2, 3}, 0, false},
+		{4, [2]int{4, 5}, 0, true},
+		{-1, [2]int{0, 0}, broken, false},
+	}
+	if len(ierr.Chunks) != len(want) {
+		t.Fatalf("failed chunks: got %v, want %v", ierr.Chunks, want)
+	}
+	for i, c := range ierr.Chunks {
+		w := want[i]
+		if c.Index != w.index || c.Lines != w.lines || c.Offset != w.offset || c.Err == nil || (c.Err == ErrMissingChunk) != w.missing {
+			t.Fatalf("failed chunk: got %v, want chunk %d of lines %v at offset %d", c, w.index, w.lines, w.offset)
+		}
+	}
+	for _, name := range []string{"Y", "RY"} {
+		gc := got.Channel(name)
+		wc := m.Channel(name)
+		sx, sy := gc.sampling()
+		for py := rect.Min.Y; py < rect.Max.Y; py++ {
+			if modp(py, sy) != 0 {
+				continue
+			}
+			for px := rect.Min.X; px < rect.Max.X; px += sx {
+				want := wc.sampleAt(px, py)
+				if py == 2 || py == 4 {
+					want = -1
+				}
+				if v := gc.sampleAt(px, py); v != want {
+					t.Fatalf("channel %q at (%d, %d): got %v, want %v", name, px, py, v, want)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeRegion(t *testing.T) {
+	rect := image.Rect(-2, 0, 6, 10)
+	m := lineOrderImage(rect)
+	b := encodeBytes(t, m, nil)
+	d, err := newDecoder(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	region := image.Rect(0, 4, 8, 7)
+	// Break chunks outside of the region, they shouldn't be read.
+	for n, o := range d.offsets[0] {
+		if y := rect.Min.Y + n; y < region.Min.Y || y >= region.Max.Y {
+			parse.PutUint32(b[o:], 1000)
+		}
+	}
+	got, err := decodeBytes(t, b, &DecodeOptions{Region: region})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := region.Intersect(rect)
+	if got.Rect != want {
+		t.Fatalf("bounds: got %v, want %v", got.Rect, want)
+	}
+	for _, c := range m.Channels {
+		gc := got.Channel(c.Name)
+		for y := want.Min.Y; y < want.Max.Y; y++ {
+			for x := want.Min.X; x < want.Max.X; x++ {
+				if g, w := gc.sampleAt(x, y), c.sampleAt(x, y); g != w {
+					t.Fatalf("channel %q at (%d, %d): got %v, want %v", c.Name, x, y, g, w)
+				}
+			}
+		}
+	}
+}
+
+// encodeTiled encodes m as a single part ONE_LEVEL tiled image without compression.
+func encodeTiled(m *Image, tw, th int) []byte {
+	h := make(Header)
+	channels := make(chlist, 0, len(m.Channels))
+	for _, c := range m.Channels {
+		channels = append(channels, c.channel())
+	}
+	h.SetAttribute("channels", "chlist", chlistToBytes(channels))
+	h.SetAttribute("compression", "compression", []byte{byte(NO_COMPRESSION)})
+	h.SetAttribute("dataWindow", "box2i", box2iToBytes(box2iFromRect(m.Rect)))
+	h.SetDisplayWindow(m.Rect)
+	h.SetAttribute("lineOrder", "lineOrder", []byte{byte(INCREASING_Y)})
+	h.SetPixelAspectRatio(1)
+	h.SetScreenWindowCenter(0, 0)
+	h.SetScreenWindowWidth(1)
+	tiles := make([]byte, 9)
+	parse.PutUint32(tiles[0:], uint32(tw))
+	parse.PutUint32(tiles[4:], uint32(th))
+	h.SetAttribute("tiles", "tiledesc", tiles)
+
+	vf := VersionField{version: 2, tiled: true}
+	var chunks [][]byte
+	for ty := 0; ty*th < m.Rect.Dy(); ty++ {
+		for tx := 0; tx*tw < m.Rect.Dx(); tx++ {
+			r := image.Rect(tx*tw, ty*th, (tx+1)*tw, (ty+1)*th).Add(m.Rect.Min).Intersect(m.Rect)
+			var data []byte
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for _, c := range m.Channels {
+					for x := r.Min.X; x < r.Max.X; x++ {
+						v := make([]byte, 4)
+						parse.PutUint32(v, math.Float32bits(c.FloatAt(x, y)))
+						data = append(data, v...)
+					}
+				}
+			}
+			head := make([]byte, 20)
+			parse.PutUint32(head[0:], uint32(tx))
+			parse.PutUint32(head[4:], uint32(ty))
+			parse.PutUint32(head[16:], uint32(len(data)))
+			chunks = append(chunks, append(head, data...))
+		}
+	}
+	buf := new(bytes.Buffer)
+	buf.Write(versionToBytes(vf))
+	hb := headersToBytes(vf, []Header{h})
+	buf.Write(hb)
+	o := uint64(8 + len(hb) + 8*len(chunks))
+	for _, c := range chunks {
+		ob := make([]byte, 8)
+		parse.PutUint64(ob, o)
+		buf.Write(ob)
+		o += uint64(len(c))
+	}
+	for _, c := range chunks {
+		buf.Write(c)
+	}
+	return buf.Bytes()
+}
+
+// encodePIZ encodes m as a single part scanline image with PIZ compression.
+func encodePIZ(tb testing.TB, m *Image) []byte {
+	e, err := newImageEncoder(m, &Options{})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	vf, err := e.prepare()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	e.header.SetAttribute("compression", "compression", []byte{byte(PIZ_COMPRESSION)})
+	channels, err := chlistFromBytes(e.header["channels"].value)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	rect := e.rect()
+	blockLines := numLinesPerBlock[PIZ_COMPRESSION]
+	var chunks [][]byte
+	for y := rect.Min.Y; y < rect.Max.Y; y += blockLines {
+		h := blockLines
+		if y+h > rect.Max.Y {
+			h = rect.Max.Y - y
+		}
+		var raw []byte
+		for ly := y; ly < y+h; ly++ {
+			raw = append(raw, lineChunk(e.channels, ly)[8:]...)
+		}
+		data, err := pizCompress(newBlockInfo(PIZ_COMPRESSION, channels, rect.Min.X, y, rect.Dx(), h), raw)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if len(data) >= len(raw) {
+			// Data is stored uncompressed, when compression doesn't make it smaller.
+			data = raw
+		}
+		head := make([]byte, 8)
+		parse.PutUint32(head[0:], uint32(y))
+		parse.PutUint32(head[4:], uint32(len(data)))
+		chunks = append(chunks, append(head, data...))
+	}
+	buf := new(bytes.Buffer)
+	buf.Write(versionToBytes(vf))
+	hb := headersToBytes(vf, []Header{e.header})
+	buf.Write(hb)
+	o := uint64(8 + len(hb) + 8*len(chunks))
+	for _, c := range chunks {
+		ob := make([]byte, 8)
+		parse.PutUint64(ob, o)
+		buf.Write(ob)
+		o += uint64(len(c))
+	}
+	for _, c := range chunks {
+		buf.Write(c)
+	}
+	return buf.Bytes()
+}
+
+// workersImage returns an image of HALF, FLOAT, UINT and subsampled channels.
+func workersImage(rect image.Rectangle) *Image {
+	m := lineOrderImage(rect)
+	r := &Channel{Name: "R", Type: HALF, Rect: rect}
+	id := &Channel{Name: "id", Type: UINT, Rect: rect}
+	for i := 0; i < rect.Dx()*rect.Dy(); i++ {
+		r.Float = append(r.Float, float32(i%251)/8)
+		id.Uint = append(id.Uint, uint32(i/7))
+	}
+	m.Channels = append(m.Channels, r, id)
+	return m
+}
+
+func TestDecodeTiled(t *testing.T) {
+	rect := image.Rect(-3, 2, 7, 9)
+	c := &Channel{Name: "Z", Type: FLOAT, Rect: rect}
+	for i := 0; i < rect.Dx()*rect.Dy(); i++ {
+		c.Float = append(c.Float, float32(i))
+	}
+	m := &Image{Header: make(Header), Rect: rect, Channels: []*Channel{c}}
+	b := encodeTiled(m, 4, 3)
+
+	got, err := decodeBytes(t, b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareChannels(t, got, m)
+
+	d, err := newDecoder(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	region := image.Rect(0, 4, 2, 6)
+	// Break tiles outside of the region, they shouldn't be read.
+	// Tiles are 4x3 from (-3, 2), so the region intersects with tiles (0, 0) to (1, 1).
+	for n, o := range d.offsets[0] {
+		if n != 0 && n != 1 && n != 3 && n != 4 {
+			parse.PutUint32(b[o:], 1000)
+		}
+	}
+	got, err = decodeBytes(t, b, &DecodeOptions{Region: region})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Rect != region {
+		t.Fatalf("bounds: got %v, want %v", got.Rect, region)
+	}
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		for x := region.Min.X; x < region.Max.X; x++ {
+			if g, w := got.Channel("Z").FloatAt(x, y), c.FloatAt(x, y); g != w {
+				t.Fatalf("pixel at (%d, %d): got %v, want %v", x, y, g, w)
+			}
+		}
+	}
+}
+
+func TestDecodeChannels(t *testing.T) {
+	rect := image.Rect(0, 0, 3, 2)
+	var channels []*Channel
+	for i, name := range []string{"Z", "diffuse.B", "diffuse.G", "diffuse.R", "diffuse2.R", "specular.R"} {
+		c := &Channel{Name: name, Type: HALF, Rect: rect}
+		for j := 0; j < rect.Dx()*rect.Dy(); j++ {
+			c.Float = append(c.Float, float32(10*i+j))
+		}
+		channels = append(channels, c)
+	}
+	m := &Image{Header: make(Header), Rect: rect, Channels: channels}
+	b := encodeBytes(t, m, nil)
+
+	cases := []struct {
+		selection []string
+		want      []string
+	}{
+		{nil, []string{"Z", "diffuse.B", "diffuse.G", "diffuse.R", "diffuse2.R", "specular.R"}},
+		{[]string{"Z"}, []string{"Z"}},
+		{[]string{"diffuse", "Z"}, []string{"Z", "diffuse.B", "diffuse.G", "diffuse.R"}},
+		{[]string{"diffuse.", "specular.R"}, []string{"diffuse.B", "diffuse.G", "diffuse.R", "specular.R"}},
+		{[]string{"none"}, nil},
+	}
+	for _, c := range cases {
+		got, err := decodeBytes(t, b, &DecodeOptions{Channels: c.selection})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, ch := range got.Channels {
+			names = append(names, ch.Name)
+		}
+		if len(names) != len(c.want) {
+			t.Fatalf("%v: channels: got %v, want %v", c.selection, names, c.want)
+		}
+		for i := range names {
+			if names[i] != c.want[i] {
+				t.Fatalf("%v: channels: got %v, want %v", c.selection, names, c.want)
+			}
+		}
+		for _, ch := range got.Channels {
+			want := m.Channel(ch.Name)
+			for i := range want.Float {
+				if ch.Float[i] != want.Float[i] {
+					t.Fatalf("%v: channel %q: got %v, want %v", c.selection, ch.Name, ch.Float, want.Float)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeChannelsPIZ(t *testing.T) {
+	full, err := DecodeWithOptions("image/scanline.exr", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := DecodeWithOptions("image/scanline.exr", &DecodeOptions{Channels: []string{"G"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Channels) != 1 {
+		t.Fatalf("got %d channels, want 1", len(m.Channels))
+	}
+	got, want := m.Channel("G"), full.Channel("G")
+	for i := range want.Float {
+		if got.Float[i] != want.Float[i] && !(got.Float[i] != got.Float[i] && want.Float[i] != want.Float[i]) {
+			t.Fatalf("pixel value at %d: got %v, want %v", i, got.Float[i], want.Float[i])
+		}
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, b := range testFiles(f) {
+		// The truncated files still have the headers, the offset tables and some chunks.
+		if len(b) > fuzzSeedSize {
+			b = b[:fuzzSeedSize]
+		}
+		f.Add(b, true)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, lineOrderImage(image.Rect(0, 0, 4, 6)), nil); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(buf.Bytes(), false)
+	// Limits are small, so the fuzzer doesn't spend time for large allocations.
+	l := &Limits{
+		MaxWidth:           1 << 12,
+		MaxHeight:          1 << 12,
+		MaxAttributeSize:   1 << 20,
+		MaxChunkSize:       1 << 22,
+		MaxAllocation:      1 << 26,
+		MaxSamplesPerPixel: 1 << 10,
+	}
+	f.Fuzz(func(t *testing.T, b []byte, tolerant bool) {
+		d, err := newDecoder(bytes.NewReader(b), int64(len(b)), l)
+		if err == nil {
+			_, err = d.decodePart(0, &DecodeOptions{Tolerant: tolerant, Limits: l})
+		}
+		switch err.(type) {
+		case nil, FormatError, UnsupportedError, LimitError, *IncompleteError:
+		default:
+			t.Fatalf("got %T error: %v", err, err)
+		}
+	})
+}
+
+func FuzzEncodeRoundTrip(f *testing.F) {
+	f.Add(uint8(4), uint8(6), int8(0), int8(0), []byte{1, 2, 3, 4, 5, 6, 7})
+	f.Add(uint8(3), uint8(5), int8(-1), int8(3), []byte{0xff, 0x7c, 0x00, 0x80})
+	f.Fuzz(func(t *testing.T, w, h uint8, x, y int8, values []byte) {
+		if len(values) == 0 {
+			values = []byte{0}
+		}
+		i := 0
+		next := func() uint32 {
+			bs := make([]byte, 4)
+			for j := range bs {
+				bs[j] = values[i%len(values)]
+				i++
+			}
+			return binary.LittleEndian.Uint32(bs)
+		}
+		// The data window should be divisible by the sampling rates of RY.
+		rect := image.Rect(2*int(x), 2*int(y), 2*(int(x)+1+int(w)%16), 2*(int(y)+1+int(h)%16))
+		id := &Channel{Name: "id", Type: UINT, Rect: rect}
+		z := &Channel{Name: "Z", Type: FLOAT, Rect: rect}
+		r := &Channel{Name: "R", Type: HALF, Rect: rect}
+		ry := &Channel{Name: "RY", Type: HALF, XSampling: 2, YSampling: 2, Rect: sampledRect(rect, 2, 2)}
+		for j := 0; j < rect.Dx()*rect.Dy(); j++ {
+			id.Uint = append(id.Uint, next())
+			z.Float = append(z.Float, math.Float32frombits(next()))
+			r.Float = append(r.Float, Half(next()).Float32())
+		}
+		for j := 0; j < ry.Rect.Dx()*ry.Rect.Dy(); j++ {
+			ry.Float = append(ry.Float, Half(next()).Float32())
+		}
+		want := &Image{Header: make(Header), Rect: rect, Channels: []*Channel{id, z, r, ry}}
+		var buf bytes.Buffer
+		if err := Encode(&buf, want, nil); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		d, err := newDecoder(bytes.NewReader(b), int64(len(b)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := d.decodePart(0, &DecodeOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Rect != rect {
+			t.Fatalf("bounds: got %v, want %v", got.Rect, rect)
+		}
+		for _, wc := range want.Channels {
+			gc := got.Channel(wc.Name)
+			if gc == nil {
+				t.Fatalf("channel %q not found", wc.Name)
+			}
+			if gc.Rect != wc.Rect {
+				t.Fatalf("channel %q: bounds: got %v, want %v", wc.Name, gc.Rect, wc.Rect)
+			}
+			for j := range wc.Uint {
+				if gc.Uint[j] != wc.Uint[j] {
+					t.Fatalf("channel %q: pixel value at %d: got %v, want %v", wc.Name, j, gc.Uint[j], wc.Uint[j])
+				}
+			}
+			for j := range wc.Float {
+				g, w := gc.Float[j], wc.Float[j]
+				if g != w && !(g != g && w != w) {
+					t.Fatalf("channel %q: pixel value at %d: got %v, want %v", wc.Name, j, g, w)
+				}
+			}
+		}
+	})
+}
+
+// TestDecodeWorkers decodes images with several workers, and compares them with
+// the images decoded one chunk by one. Run it with -race to check the workers.
+func TestDecodeWorkers(t *testing.T) {
+	rect := image.Rect(-2, 4, 68, 104)
+	m := workersImage(rect)
+	piz := encodePIZ(t, m)
+	got, err := decodeBytes(t, piz, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareChannels(t, got, m)
+
+	scanline, err := ioutil.ReadFile("image/scanline.exr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := &Channel{Name: "Z", Type: FLOAT, Rect: rect}
+	for i := 0; i < rect.Dx()*rect.Dy(); i++ {
+		z.Float = append(z.Float, float32(i))
+	}
+	tiled := encodeTiled(&Image{Header: make(Header), Rect: rect, Channels: []*Channel{z}}, 16, 8)
+
+	cases := []struct {
+		name string
+		b    []byte
+		o    DecodeOptions
+	}{
+		{"piz", piz, DecodeOptions{}},
+		{"piz region", piz, DecodeOptions{Region: image.Rect(0, 30, 20, 70)}},
+		{"piz channels", piz, DecodeOptions{Channels: []string{"R", "id"}}},
+		{"uncompressed", encodeBytes(t, m, &Options{LineOrder: DECREASING_Y}), DecodeOptions{}},
+		{"tiled", tiled, DecodeOptions{}},
+		{"scanline.exr", scanline, DecodeOptions{}},
+	}
+	for _, c := range cases {
+		want, err := decodeBytes(t, c.b, &c.o)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		for _, workers := range []int{-1, 2, 3, 8} {
+			o := c.o
+			o.Workers = workers
+			got, err := decodeBytes(t, c.b, &o)
+			if err != nil {
+				t.Fatalf("%s with %d workers: %v", c.name, workers, err)
+			}
+			if got.Rect != want.Rect || len(got.Channels) != len(want.Channels) {
+				t.Fatalf("%s with %d workers: got %d channels in %v, want %d in %v", c.name, workers, len(got.Channels), got.Rect, len(want.Channels), want.Rect)
+			}
+			compareChannels(t, got, want)
+		}
+	}
+}
+
+func TestDecodeWorkersBroken(t *testing.T) {
+	rect := image.Rect(0, 0, 40, 200)
+	b := encodePIZ(t, workersImage(rect))
+	d, err := newDecoder(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Break the data of the 2nd chunk, the data size of the 4th chunk,
+	// and the y coordinate of the 6th chunk.
+	o := d.offsets[0][1]
+	for j := o + 8; j < o+40; j++ {
+		b[j] = 0xff
+	}
+	o = d.offsets[0][3]
+	parse.PutUint32(b[o+4:], parse.Uint32(b[o+4:])-2)
+	o = d.offsets[0][5]
+	parse.PutUint32(b[o:], 1000)
+
+	_, want := decodeBytes(t, b, nil)
+	if want == nil {
+		t.Fatalf("decode without tolerant mode: want an error")
+	}
+	tolerant := DecodeOptions{Tolerant: true, Fill: -1}
+	wantImage, wantErr := decodeBytes(t, b, &tolerant)
+	ierr, ok := wantErr.(*IncompleteError)
+	if !ok || len(ierr.Chunks) != 4 {
+		t.Fatalf("got error %v, want *IncompleteError of 4 chunks", wantErr)
+	}
+	for _, workers := range []int{2, 4, 8} {
+		_, err := decodeBytes(t, b, &DecodeOptions{Workers: workers})
+		if err == nil || err.Error() != want.Error() {
+			t.Fatalf("%d workers: got error %v, want %v", workers, err, want)
+		}
+		o := tolerant
+		o.Workers = workers
+		got, err := decodeBytes(t, b, &o)
+		if err == nil || err.Error() != wantErr.Error() {
+			t.Fatalf("%d workers in tolerant mode: got error %v, want %v", workers, err, wantErr)
+		}
+		compareChannels(t, got, wantImage)
+	}
+}
+
+func BenchmarkDecodeWorkers(b *testing.B) {
+	// A 4K frame of RGBA HALF channels.
+	rect := image.Rect(0, 0, 3840, 2160)
+	m := &Image{Header: make(Header), Rect: rect}
+	for i, name := range []string{"R", "G", "B", "A"} {
+		c := &Channel{Name: name, Type: HALF, Rect: rect, Float: make([]float32, rect.Dx()*rect.Dy())}
+		for y := 0; y < rect.Dy(); y++ {
+			for x := 0; x < rect.Dx(); x++ {
+				c.Float[y*rect.Dx()+x] = float32(x*(i+1)+y) / 4096 * float32(1+(x*y)%7) / 7
+			}
+		}
+		m.Channels = append(m.Channels, c)
+	}
+	data := encodePIZ(b, m)
+	counts := []int{1, 2, 4}
+	if n := runtime.GOMAXPROCS(0); n > 4 {
+		counts = append(counts, n)
+	}
+	for _, workers := range counts {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(rect.Dx() * rect.Dy() * 4 * 2))
+			for i := 0; i < b.N; i++ {
+				d, err := newDecoder(bytes.NewReader(data), int64(len(data)), nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := d.decodePart(0, &DecodeOptions{Workers: workers}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
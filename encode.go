@@ -0,0 +1,387 @@
+package exr
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// Options are the encoding parameters.
+type Options struct {
+	// Header has additional attributes to write.
+	// Attributes those are decided by the encoder,
+	// such as channels or dataWindow, are overwritten.
+	Header Header
+
+	// Half makes the encoder write channels as HALF type, instead of FLOAT.
+	// Pixel values are rounded to the nearest Half.
+	Half bool
+
+	// Preview makes the encoder generate a preview image (thumbnail)
+	// from the full image, and store it to the preview attribute.
+	Preview bool
+
+	// LuminanceChroma makes the encoder write colors as Y, RY and BY channels,
+	// converted from R, G and B channels. Chroma channels are subsampled by 2
+	// in each direction that the data window is divisible by 2.
+	// Luminance weights are decided by the chromaticities attribute
+	// of the image's header or Header, or Rec.709 chromaticities when neither has it.
+	LuminanceChroma bool
+
+	// ACES makes the encoder write an ACES image container (SMPTE ST 2065-4).
+	// Colors are converted to ACES AP0 primaries and white point,
+	// and written as R, G, B, A channels of HALF type.
+	// Encode returns an ACESViolation when the image has other channels,
+	// LuminanceChroma is also set, or LineOrder is RANDOM_Y.
+	ACES bool
+
+	// LineOrder is the order of the chunks to write. It is one of INCREASING_Y
+	// (the default), DECREASING_Y or RANDOM_Y. Encode writes chunks of RANDOM_Y
+	// line order from the top. Use Writer to write them in any order.
+	LineOrder lineOrder
+}
+
+// Encode writes the image m to w in exr format,
+// as a single part scanline image without compression.
+// Bounds of m become the data window of the image. They also become
+// the display window, unless the header of m (when m is an *Image)
+// or o.Header has a displayWindow attribute, which is kept instead.
+//
+// When m is an *Image, it's channels are written with their own pixel types,
+// and attributes of it's header are kept.
+// Otherwise, pixels of m are written as R, G, B, A channels of FLOAT type
+// (or HALF type, if o.Half is true).
+func Encode(w io.Writer, m image.Image, o *Options) error {
+	if o == nil {
+		o = &Options{}
+	}
+	e, err := newImageEncoder(m, o)
+	if err != nil {
+		return err
+	}
+	return e.encode(w)
+}
+
+// newImageEncoder returns an encoder that writes m with the options, like Encode.
+func newImageEncoder(m image.Image, o *Options) (*encoder, error) {
+	img, ok := m.(*Image)
+	if !ok {
+		typ := FLOAT
+		if o.Half {
+			typ = HALF
+		}
+		img = rgbaImage(m, typ)
+	}
+	e := newEncoder(img.Bounds())
+	e.lineOrder = o.LineOrder
+	for name, attr := range img.Header {
+		e.header[name] = attr
+	}
+	for _, name := range []string{"chunkCount", "tiles", "type"} {
+		delete(e.header, name)
+	}
+	for name, attr := range o.Header {
+		e.header[name] = attr
+	}
+	if o.ACES {
+		if o.LuminanceChroma {
+			return nil, ACESViolation{Attribute: "channels", Reason: "luminance/chroma channels are not allowed"}
+		}
+		if o.LineOrder != INCREASING_Y && o.LineOrder != DECREASING_Y {
+			return nil, ACESViolation{Attribute: "lineOrder", Reason: fmt.Sprintf("%v is not allowed", o.LineOrder)}
+		}
+		var err error
+		img, err = toACES(&Image{Header: e.header, Rect: img.Rect, Channels: img.Channels})
+		if err != nil {
+			return nil, err
+		}
+		e.header = img.Header
+	}
+	if o.LuminanceChroma {
+		// Convert with the chromaticities of the header to write.
+		img = (&Image{Header: e.header, Rect: img.Rect, Channels: img.Channels}).ToLuminanceChroma()
+	}
+	for _, c := range img.Channels {
+		e.addChannel(c)
+	}
+	if o.Preview {
+		e.makePreview()
+	}
+	return e, nil
+}
+
+// rgbaImage returns an *Image that has R, G, B and A channels of type typ,
+// those pixel values are colors of m.
+func rgbaImage(m image.Image, typ pixelType) *Image {
+	r, g, b, a := rgbaPlanes(m)
+	rect := m.Bounds()
+	return &Image{
+		Header: make(Header),
+		Rect:   rect,
+		Channels: []*Channel{
+			{Name: "A", Type: typ, XSampling: 1, YSampling: 1, Rect: rect, Float: a},
+			{Name: "B", Type: typ, XSampling: 1, YSampling: 1, Rect: rect, Float: b},
+			{Name: "G", Type: typ, XSampling: 1, YSampling: 1, Rect: rect, Float: g},
+			{Name: "R", Type: typ, XSampling: 1, YSampling: 1, Rect: rect, Float: r},
+		},
+	}
+}
+
+// rgbaPlanes returns pixel values of m, separated by r, g, b, a channels.
+func rgbaPlanes(m image.Image) (r, g, b, a []float32) {
+	bounds := m.Bounds()
+	n := bounds.Dx() * bounds.Dy()
+	r = make([]float32, 0, n)
+	g = make([]float32, 0, n)
+	b = make([]float32, 0, n)
+	a = make([]float32, 0, n)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.RGBA64Model.Convert(m.At(x, y)).(color.RGBA64)
+			r = append(r, float32(c.R)/0xFFFF)
+			g = append(g, float32(c.G)/0xFFFF)
+			b = append(b, float32(c.B)/0xFFFF)
+			a = append(a, float32(c.A)/0xFFFF)
+		}
+	}
+	return r, g, b, a
+}
+
+// encoder writes a single part scanline image.
+type encoder struct {
+	header     Header
+	dataWindow box2i
+	lineOrder  lineOrder
+	channels   []*Channel
+}
+
+func newEncoder(rect image.Rectangle) *encoder {
+	dataWindow := box2iFromRect(rect)
+	h := make(Header)
+	h.SetDisplayWindow(rect)
+	h.SetPixelAspectRatio(1)
+	h.SetScreenWindowCenter(0, 0)
+	h.SetScreenWindowWidth(1)
+	return &encoder{
+		header:     h,
+		dataWindow: dataWindow,
+	}
+}
+
+// rect returns the data window in image.Rectangle form.
+func (e *encoder) rect() image.Rectangle {
+	return e.dataWindow.rect()
+}
+
+// size returns width and height of the image.
+func (e *encoder) size() (int, int) {
+	return int(e.dataWindow.xMax) - int(e.dataWindow.xMin) + 1, int(e.dataWindow.yMax) - int(e.dataWindow.yMin) + 1
+}
+
+// addChannel adds a channel to write.
+func (e *encoder) addChannel(c *Channel) {
+	e.channels = append(e.channels, c)
+}
+
+// makePreview makes a preview image from R, G, B, A channels
+// (or Y, RY, BY, A channels), and sets it to the header.
+func (e *encoder) makePreview() {
+	m := (&Image{Header: e.header, Rect: e.rect(), Channels: e.channels}).ToRGB()
+	plane := func(name string) []float32 {
+		if c := m.Channel(name); c != nil {
+			return c.Upsample(e.rect()).Float
+		}
+		return nil
+	}
+	width, height := e.size()
+	p := makePreview(width, height, e.header.PixelAspectRatio(), plane("R"), plane("G"), plane("B"), plane("A"), previewWidth)
+	e.header.SetPreview(p)
+}
+
+// prepare validates layout of the channels, and sets the attributes
+// decided by the encoder to the header. It returns the version field of the image.
+// Channels are sorted by their names.
+func (e *encoder) prepare() (VersionField, error) {
+	if e.lineOrder != INCREASING_Y && e.lineOrder != DECREASING_Y && e.lineOrder != RANDOM_Y {
+		return VersionField{}, FormatError(fmt.Sprintf("unknown line order: %d", e.lineOrder))
+	}
+	sortChannels(e.channels)
+	channels := make(chlist, 0, len(e.channels))
+	for _, c := range e.channels {
+		if c.Type != UINT && c.Type != HALF && c.Type != FLOAT {
+			return VersionField{}, FormatError(fmt.Sprintf("unknown pixel type of channel %q: %d", c.Name, c.Type))
+		}
+		ch := c.channel()
+		if err := validateSampling(ch, e.dataWindow); err != nil {
+			return VersionField{}, err
+		}
+		channels = append(channels, ch)
+	}
+
+	vf := VersionField{version: 2}
+	e.header.SetAttribute("channels", "chlist", chlistToBytes(channels))
+	e.header.SetAttribute("compression", "compression", []byte{byte(NO_COMPRESSION)})
+	e.header.SetAttribute("dataWindow", "box2i", box2iToBytes(e.dataWindow))
+	e.header.SetAttribute("lineOrder", "lineOrder", []byte{byte(e.lineOrder)})
+	if e.header.hasLongName() {
+		vf.longName = true
+	}
+	return vf, nil
+}
+
+// validatePixels checks the channel has pixel values of all pixels in rect (in image coordinate).
+func validatePixels(c *Channel, rect image.Rectangle) error {
+	sx, sy := c.sampling()
+	want := sampledRect(rect, sx, sy)
+	if c.Rect != want {
+		return FormatError(fmt.Sprintf("channel %q has bounds %v, want %v", c.Name, c.Rect, want))
+	}
+	n := len(c.Float)
+	if c.Type == UINT {
+		n = len(c.Uint)
+	}
+	if n != want.Dx()*want.Dy() {
+		return FormatError(fmt.Sprintf("channel %q has %d pixel values, want %d", c.Name, n, want.Dx()*want.Dy()))
+	}
+	return nil
+}
+
+// blockOrder returns indices of n blocks, in the order they are stored in a file.
+// Blocks of RANDOM_Y line order are stored from the top, when the whole image is known.
+func blockOrder(n int, order lineOrder) []int {
+	idx := make([]int, n)
+	for i := range idx {
+		if order == DECREASING_Y {
+			idx[i] = n - 1 - i
+		} else {
+			idx[i] = i
+		}
+	}
+	return idx
+}
+
+// encode writes the image to w.
+func (e *encoder) encode(w io.Writer) error {
+	return encodeParts(w, []*encoder{e}, false)
+}
+
+// encodeParts writes the images of the encoders to w, as parts of an image.
+// When multiPart is true, it writes a multi-part image even for a single encoder.
+// Headers of a multi-part image should have unique name attributes.
+func encodeParts(w io.Writer, parts []*encoder, multiPart bool) error {
+	vf := VersionField{version: 2, multiPart: multiPart}
+	headers := make([]Header, len(parts))
+	chunks := make([][][]byte, len(parts))
+	for i, e := range parts {
+		pvf, err := e.prepare()
+		if err != nil {
+			return err
+		}
+		if pvf.longName {
+			vf.longName = true
+		}
+		for _, c := range e.channels {
+			if err := validatePixels(c, e.rect()); err != nil {
+				return err
+			}
+		}
+		_, height := e.size()
+		if multiPart {
+			e.header.SetString("type", "scanlineimage")
+			e.header.SetInt("chunkCount", int32(height))
+		}
+		headers[i] = e.header
+		chunks[i] = make([][]byte, height)
+		for j := range chunks[i] {
+			c := lineChunk(e.channels, int(e.dataWindow.yMin)+j)
+			if multiPart {
+				// Chunks of a multi-part image start with the part number.
+				part := make([]byte, 4, 4+len(c))
+				parse.PutUint32(part, uint32(i))
+				c = append(part, c...)
+			}
+			chunks[i][j] = c
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	headerBytes := headersToBytes(vf, headers)
+	o := uint64(8 + len(headerBytes))
+	for i := range chunks {
+		o += uint64(8 * len(chunks[i]))
+	}
+	offsets := make([][]uint64, len(parts))
+	orders := make([][]int, len(parts))
+	for i, e := range parts {
+		offsets[i] = make([]uint64, len(chunks[i]))
+		orders[i] = blockOrder(len(chunks[i]), e.lineOrder)
+		for _, j := range orders[i] {
+			offsets[i][j] = o
+			o += uint64(len(chunks[i][j]))
+		}
+	}
+	if _, err := bw.Write(versionToBytes(vf)); err != nil {
+		return err
+	}
+	if _, err := bw.Write(headerBytes); err != nil {
+		return err
+	}
+	for i := range offsets {
+		if _, err := bw.Write(offsetsToBytes(offsets[i])); err != nil {
+			return err
+		}
+	}
+	for i := range chunks {
+		for _, j := range orders[i] {
+			if _, err := bw.Write(chunks[i][j]); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// lineChunk returns a chunk of line y from pixel values of the channels,
+// including it's y coordinate and data size.
+// The channels should be sorted by their names, and have pixel values of line y.
+// Subsampled channels are written only in the lines they are sampled.
+func lineChunk(channels []*Channel, y int) []byte {
+	data := make([]byte, 0)
+	for _, c := range channels {
+		_, sy := c.sampling()
+		if modp(y, sy) != 0 {
+			continue
+		}
+		n := c.Rect.Dx()
+		j := c.PixOffset(c.Rect.Min.X, divp(y, sy))
+		switch c.Type {
+		case UINT:
+			for _, v := range c.Uint[j : j+n] {
+				bs := make([]byte, 4)
+				parse.PutUint32(bs, v)
+				data = append(data, bs...)
+			}
+		case HALF:
+			hs := make([]uint16, n)
+			float32sToUint16s(hs, c.Float[j:j+n])
+			for _, h := range hs {
+				bs := make([]byte, 2)
+				parse.PutUint16(bs, h)
+				data = append(data, bs...)
+			}
+		case FLOAT:
+			for _, v := range c.Float[j : j+n] {
+				bs := make([]byte, 4)
+				parse.PutUint32(bs, math.Float32bits(v))
+				data = append(data, bs...)
+			}
+		}
+	}
+	c := make([]byte, 8, 8+len(data))
+	parse.PutUint32(c[:4], uint32(y))
+	parse.PutUint32(c[4:8], uint32(len(data)))
+	return append(c, data...)
+}
@@ -0,0 +1,464 @@
+package exr
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// An environment map has colors of all directions seen from a point.
+// The envmap attribute decides how directions are mapped to pixels.
+//
+// Directions are in a right handed coordinate system, where +Y is up.
+//
+// A latitude-longitude map (ENVMAP_LATLONG) has latitude from π/2 at the top
+// to -π/2 at the bottom, and longitude from π at the left to -π at the right.
+// The center of the map is +Z direction, and the left and right edges are -Z direction.
+//
+// A cube map (ENVMAP_CUBE) has six square faces of a cube, stacked vertically
+// in the order of +X, -X, +Y, -Y, +Z and -Z faces. It's width is the size of a face,
+// and it's height is 6 times of the size.
+//
+// Pixel positions are in image coordinate, and a pixel's center is at it's integer position.
+
+type cubeFace int
+
+const (
+	CUBEFACE_POS_X = cubeFace(iota)
+	CUBEFACE_NEG_X
+	CUBEFACE_POS_Y
+	CUBEFACE_NEG_Y
+	CUBEFACE_POS_Z
+	CUBEFACE_NEG_Z
+)
+
+func (f cubeFace) String() string {
+	switch f {
+	case CUBEFACE_POS_X:
+		return "CUBEFACE_POS_X"
+	case CUBEFACE_NEG_X:
+		return "CUBEFACE_NEG_X"
+	case CUBEFACE_POS_Y:
+		return "CUBEFACE_POS_Y"
+	case CUBEFACE_NEG_Y:
+		return "CUBEFACE_NEG_Y"
+	case CUBEFACE_POS_Z:
+		return "CUBEFACE_POS_Z"
+	case CUBEFACE_NEG_Z:
+		return "CUBEFACE_NEG_Z"
+	default:
+		return "UNKNOWN_CUBEFACE"
+	}
+}
+
+// Envmap returns the envmap attribute of the header.
+// ok is false when the header doesn't have the attribute.
+func (h Header) Envmap() (e envmap, ok bool) {
+	attr, ok := h["envmap"]
+	if !ok {
+		return 0, false
+	}
+	e, err := envmapFromBytes(attr.value)
+	if err != nil {
+		return 0, false
+	}
+	return e, true
+}
+
+// SetEnvmap sets the envmap attribute of the header.
+func (h Header) SetEnvmap(e envmap) {
+	h.SetAttribute("envmap", "envmap", []byte{byte(e)})
+}
+
+// normalize returns the unit vector of v. It returns v as is, when it is a zero vector.
+func normalize(v [3]float64) [3]float64 {
+	l := math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+	if l == 0 {
+		return v
+	}
+	return [3]float64{v[0] / l, v[1] / l, v[2] / l}
+}
+
+func cross(a, b [3]float64) [3]float64 {
+	return [3]float64{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
+
+// LatLong returns latitude and longitude of the direction.
+func LatLong(dir [3]float64) (lat, long float64) {
+	r := math.Sqrt(dir[2]*dir[2] + dir[0]*dir[0])
+	l := math.Sqrt(r*r + dir[1]*dir[1])
+	if l == 0 {
+		return 0, 0
+	}
+	if r < math.Abs(dir[1]) {
+		lat = math.Acos(r / l)
+		if dir[1] < 0 {
+			lat = -lat
+		}
+	} else {
+		lat = math.Asin(dir[1] / l)
+	}
+	if r != 0 {
+		long = math.Atan2(dir[0], dir[2])
+	}
+	return lat, long
+}
+
+// LatLongPosition returns pixel position of the direction in a latlong map,
+// those bounds are r.
+func LatLongPosition(r image.Rectangle, dir [3]float64) (x, y float64) {
+	lat, long := LatLong(dir)
+	x = (long-math.Pi)/(-2*math.Pi)*float64(r.Dx()-1) + float64(r.Min.X)
+	y = (lat-math.Pi/2)/(-math.Pi)*float64(r.Dy()-1) + float64(r.Min.Y)
+	return x, y
+}
+
+// LatLongDirection returns the unit direction of pixel position (x, y)
+// in a latlong map, those bounds are r.
+func LatLongDirection(r image.Rectangle, x, y float64) [3]float64 {
+	var lat, long float64
+	if r.Dx() > 1 {
+		long = -2*math.Pi*(x-float64(r.Min.X))/float64(r.Dx()-1) + math.Pi
+	}
+	if r.Dy() > 1 {
+		lat = -math.Pi*(y-float64(r.Min.Y))/float64(r.Dy()-1) + math.Pi/2
+	}
+	return [3]float64{
+		math.Sin(long) * math.Cos(lat),
+		math.Sin(lat),
+		math.Cos(long) * math.Cos(lat),
+	}
+}
+
+// CubeFaceSize returns size of a face of a cube map, those bounds are r.
+func CubeFaceSize(r image.Rectangle) int {
+	n := r.Dy() / 6
+	if r.Dx() < n {
+		n = r.Dx()
+	}
+	return n
+}
+
+// CubeFaceRect returns bounds of the face in a cube map, those bounds are r.
+func CubeFaceRect(r image.Rectangle, face cubeFace) image.Rectangle {
+	n := CubeFaceSize(r)
+	min := r.Min.Add(image.Pt(0, int(face)*n))
+	return image.Rectangle{min, min.Add(image.Pt(n, n))}
+}
+
+// CubePosition returns pixel position of the direction in a cube map,
+// those bounds are r.
+func CubePosition(r image.Rectangle, dir [3]float64) (x, y float64) {
+	_, x, y = cubeFacePosition(r, dir)
+	return x, y
+}
+
+// cubeFacePosition returns the face and pixel position of the direction in a cube map.
+func cubeFacePosition(r image.Rectangle, dir [3]float64) (face cubeFace, x, y float64) {
+	n := float64(CubeFaceSize(r) - 1)
+	ax, ay, az := math.Abs(dir[0]), math.Abs(dir[1]), math.Abs(dir[2])
+	// (u, v) is the position in the face.
+	var u, v float64
+	switch {
+	case ax >= ay && ax >= az:
+		if ax == 0 {
+			// zero vector
+			break
+		}
+		u = (dir[1]/ax + 1) / 2 * n
+		v = (dir[2]/ax + 1) / 2 * n
+		face = CUBEFACE_POS_X
+		if dir[0] < 0 {
+			face = CUBEFACE_NEG_X
+		}
+	case ay >= az:
+		u = (dir[0]/ay + 1) / 2 * n
+		v = (dir[2]/ay + 1) / 2 * n
+		face = CUBEFACE_POS_Y
+		if dir[1] < 0 {
+			face = CUBEFACE_NEG_Y
+		}
+	default:
+		u = (dir[0]/az + 1) / 2 * n
+		v = (dir[1]/az + 1) / 2 * n
+		face = CUBEFACE_POS_Z
+		if dir[2] < 0 {
+			face = CUBEFACE_NEG_Z
+		}
+	}
+	fr := CubeFaceRect(r, face)
+	minX, minY := float64(fr.Min.X), float64(fr.Min.Y)
+	maxX, maxY := minX+n, minY+n
+	switch face {
+	case CUBEFACE_POS_X:
+		x, y = minX+v, maxY-u
+	case CUBEFACE_NEG_X:
+		x, y = maxX-v, maxY-u
+	case CUBEFACE_POS_Y:
+		x, y = minX+u, maxY-v
+	case CUBEFACE_NEG_Y:
+		x, y = minX+u, minY+v
+	case CUBEFACE_POS_Z:
+		x, y = maxX-u, maxY-v
+	default:
+		x, y = minX+u, maxY-v
+	}
+	return face, x, y
+}
+
+// CubeDirection returns the unit direction of pixel position (x, y)
+// in a cube map, those bounds are r.
+func CubeDirection(r image.Rectangle, x, y float64) [3]float64 {
+	size := CubeFaceSize(r)
+	if size == 0 {
+		return [3]float64{1, 0, 0}
+	}
+	face := cubeFace(math.Floor((y - float64(r.Min.Y) + 0.5) / float64(size)))
+	if face < CUBEFACE_POS_X {
+		face = CUBEFACE_POS_X
+	} else if face > CUBEFACE_NEG_Z {
+		face = CUBEFACE_NEG_Z
+	}
+	fr := CubeFaceRect(r, face)
+	n := float64(size - 1)
+	minX, minY := float64(fr.Min.X), float64(fr.Min.Y)
+	maxX, maxY := minX+n, minY+n
+	// (u, v) is the position in the face, reverse of CubePosition.
+	var u, v float64
+	switch face {
+	case CUBEFACE_POS_X:
+		u, v = maxY-y, x-minX
+	case CUBEFACE_NEG_X:
+		u, v = maxY-y, maxX-x
+	case CUBEFACE_POS_Y:
+		u, v = x-minX, maxY-y
+	case CUBEFACE_NEG_Y:
+		u, v = x-minX, y-minY
+	case CUBEFACE_POS_Z:
+		u, v = maxX-x, maxY-y
+	default:
+		u, v = x-minX, maxY-y
+	}
+	if n > 0 {
+		u, v = u/n*2-1, v/n*2-1
+	} else {
+		u, v = 0, 0
+	}
+	var dir [3]float64
+	switch face {
+	case CUBEFACE_POS_X:
+		dir = [3]float64{1, u, v}
+	case CUBEFACE_NEG_X:
+		dir = [3]float64{-1, u, v}
+	case CUBEFACE_POS_Y:
+		dir = [3]float64{u, 1, v}
+	case CUBEFACE_NEG_Y:
+		dir = [3]float64{u, -1, v}
+	case CUBEFACE_POS_Z:
+		dir = [3]float64{u, v, 1}
+	default:
+		dir = [3]float64{u, v, -1}
+	}
+	return normalize(dir)
+}
+
+// envmapLayout maps directions to pixels of an environment map.
+type envmapLayout struct {
+	typ  envmap
+	rect image.Rectangle
+}
+
+func newEnvmapLayout(typ envmap, r image.Rectangle) (envmapLayout, error) {
+	switch typ {
+	case ENVMAP_LATLONG:
+		if r.Empty() {
+			return envmapLayout{}, FormatError(fmt.Sprintf("empty latlong map bounds: %v", r))
+		}
+	case ENVMAP_CUBE:
+		if CubeFaceSize(r) < 1 {
+			return envmapLayout{}, FormatError(fmt.Sprintf("cube map bounds %v are too small for 6 faces", r))
+		}
+	default:
+		return envmapLayout{}, UnsupportedError(fmt.Sprintf("environment map type %v", typ))
+	}
+	return envmapLayout{typ: typ, rect: r}, nil
+}
+
+// direction returns the direction of a pixel.
+// ok is false, when the pixel is out of the faces of a cube map.
+func (l envmapLayout) direction(x, y int) (dir [3]float64, ok bool) {
+	if l.typ == ENVMAP_LATLONG {
+		return LatLongDirection(l.rect, float64(x), float64(y)), true
+	}
+	size := CubeFaceSize(l.rect)
+	if x-l.rect.Min.X >= size || y-l.rect.Min.Y >= 6*size {
+		return dir, false
+	}
+	return CubeDirection(l.rect, float64(x), float64(y)), true
+}
+
+// position returns the pixel position of the direction,
+// and bounds of the pixels those could be interpolated around it.
+func (l envmapLayout) position(dir [3]float64) (x, y float64, bounds image.Rectangle) {
+	if l.typ == ENVMAP_LATLONG {
+		x, y = LatLongPosition(l.rect, dir)
+		return x, y, l.rect
+	}
+	face, x, y := cubeFacePosition(l.rect, dir)
+	return x, y, CubeFaceRect(l.rect, face)
+}
+
+// pixelAngle returns approximate angle between neighboring pixels.
+func (l envmapLayout) pixelAngle() float64 {
+	steps := func(n int) float64 {
+		if n < 1 {
+			return 1
+		}
+		return float64(n)
+	}
+	if l.typ == ENVMAP_LATLONG {
+		return math.Max(2*math.Pi/steps(l.rect.Dx()-1), math.Pi/steps(l.rect.Dy()-1))
+	}
+	return 2 / steps(CubeFaceSize(l.rect)-1)
+}
+
+// envmapTap is a pixel and it's weight, to compute a filtered pixel value.
+type envmapTap struct {
+	p      image.Point
+	weight float64
+}
+
+// bilinearTaps appends the pixels around (x, y) in bounds to taps, weighted by
+// bilinear interpolation and w. Pixels out of bounds are clamped to the edges.
+func bilinearTaps(taps []envmapTap, x, y float64, bounds image.Rectangle, w float64) []envmapTap {
+	clamp := func(v, min, max int) int {
+		if v < min {
+			return min
+		}
+		if v > max {
+			return max
+		}
+		return v
+	}
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	for _, t := range []struct {
+		dx, dy int
+		w      float64
+	}{
+		{0, 0, (1 - fx) * (1 - fy)},
+		{1, 0, fx * (1 - fy)},
+		{0, 1, (1 - fx) * fy},
+		{1, 1, fx * fy},
+	} {
+		if t.w == 0 {
+			continue
+		}
+		p := image.Pt(
+			clamp(int(x0)+t.dx, bounds.Min.X, bounds.Max.X-1),
+			clamp(int(y0)+t.dy, bounds.Min.Y, bounds.Max.Y-1),
+		)
+		taps = append(taps, envmapTap{p, w * t.w})
+	}
+	return taps
+}
+
+// ConvertEnvmap returns the environment map m converted to the layout typ,
+// those bounds are r. m should have the envmap attribute.
+// It could also resize a map, by converting it to the same layout.
+//
+// Each pixel is a filtered average of pixels of m in it's footprint,
+// sampled with a tent filter around it's direction, so the map is not aliased
+// when it becomes smaller. UINT channels take the nearest pixel instead.
+// Subsampled channels are upsampled first. Pixels out of the faces of a cube map are 0.
+//
+// The returned image has a copy of m's header, with the envmap attribute of typ.
+func (m *Image) ConvertEnvmap(typ envmap, r image.Rectangle) (*Image, error) {
+	src, ok := m.Header.Envmap()
+	if !ok {
+		return nil, FormatError("image doesn't have envmap attribute")
+	}
+	in, err := newEnvmapLayout(src, m.Rect)
+	if err != nil {
+		return nil, err
+	}
+	out, err := newEnvmapLayout(typ, r)
+	if err != nil {
+		return nil, err
+	}
+	h := m.Header.copy()
+	h.SetEnvmap(typ)
+	c := &Image{
+		Header: h,
+		Rect:   r,
+	}
+	srcs := make([]*Channel, len(m.Channels))
+	for i, ch := range m.Channels {
+		srcs[i] = ch.Upsample(m.Rect)
+		dst := newChannel(channel{name: ch.Name, pixelType: ch.Type, xSampling: 1, ySampling: 1}, r)
+		dst.PLinear = ch.PLinear
+		c.Channels = append(c.Channels, dst)
+	}
+
+	// The footprint of a pixel is the angle to it's neighbors, and it is
+	// sampled enough times to cover the pixels of m in it.
+	radius := out.pixelAngle()
+	n := int(math.Ceil(2 * radius / in.pixelAngle()))
+	if n < 2 {
+		n = 2
+	} else if n > 16 {
+		n = 16
+	}
+	var taps []envmapTap
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			dir, ok := out.direction(x, y)
+			if !ok {
+				continue
+			}
+			up := [3]float64{0, 1, 0}
+			if math.Abs(dir[1]) > 0.9 {
+				up = [3]float64{1, 0, 0}
+			}
+			t1 := normalize(cross(dir, up))
+			t2 := cross(dir, t1)
+			taps = taps[:0]
+			var sum float64
+			for i := 0; i < n; i++ {
+				u := radius * (2*(float64(i)+0.5)/float64(n) - 1)
+				for j := 0; j < n; j++ {
+					v := radius * (2*(float64(j)+0.5)/float64(n) - 1)
+					w := (1 - math.Abs(u)/radius) * (1 - math.Abs(v)/radius)
+					d := [3]float64{
+						dir[0] + u*t1[0] + v*t2[0],
+						dir[1] + u*t1[1] + v*t2[1],
+						dir[2] + u*t1[2] + v*t2[2],
+					}
+					px, py, bounds := in.position(d)
+					taps = bilinearTaps(taps, px, py, bounds, w)
+					sum += w
+				}
+			}
+			nx, ny, _ := in.position(dir)
+			nearest := image.Pt(int(math.Floor(nx+0.5)), int(math.Floor(ny+0.5)))
+			for k, s := range srcs {
+				dst := c.Channels[k]
+				i := dst.PixOffset(x, y)
+				if s.Type == UINT {
+					dst.Uint[i] = s.UintAt(nearest.X, nearest.Y)
+					continue
+				}
+				var v float64
+				for _, t := range taps {
+					v += float64(s.Float[s.PixOffset(t.p.X, t.p.Y)]) * t.weight
+				}
+				dst.Float[i] = float32(v / sum)
+			}
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,138 @@
+package exr
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func dirNear(a, b [3]float64, tolerance float64) bool {
+	a, b = normalize(a), normalize(b)
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEnvmapDirections(t *testing.T) {
+	latlong := image.Rect(-3, 2, 30, 19)
+	cube := image.Rect(5, -7, 13, 41)
+	cases := []struct {
+		dir    [3]float64
+		ll     [2]float64 // latlong position
+		cube   [2]float64 // cube position
+		facept image.Point
+	}{
+		{[3]float64{0, 0, 1}, [2]float64{13, 10}, [2]float64{8.5, 28.5}, image.Pt(0, 4)},
+		{[3]float64{0, 1, 0}, [2]float64{13, 2}, [2]float64{8.5, 12.5}, image.Pt(0, 2)},
+		{[3]float64{0, -2, 0}, [2]float64{13, 18}, [2]float64{8.5, 20.5}, image.Pt(0, 3)},
+		{[3]float64{1, 0, 0}, [2]float64{5, 10}, [2]float64{8.5, -3.5}, image.Pt(0, 0)},
+		{[3]float64{-1, 0, 0}, [2]float64{21, 10}, [2]float64{8.5, 4.5}, image.Pt(0, 1)},
+		{[3]float64{0, 0, -1}, [2]float64{-3, 10}, [2]float64{8.5, 36.5}, image.Pt(0, 5)},
+	}
+	for _, c := range cases {
+		if x, y := LatLongPosition(latlong, c.dir); math.Abs(x-c.ll[0]) > 1e-9 || math.Abs(y-c.ll[1]) > 1e-9 {
+			t.Fatalf("latlong position of %v: got (%v, %v), want %v", c.dir, x, y, c.ll)
+		}
+		if got := LatLongDirection(latlong, c.ll[0], c.ll[1]); !dirNear(got, c.dir, 1e-9) {
+			t.Fatalf("latlong direction at %v: got %v, want %v", c.ll, got, c.dir)
+		}
+		if x, y := CubePosition(cube, c.dir); math.Abs(x-c.cube[0]) > 1e-9 || math.Abs(y-c.cube[1]) > 1e-9 {
+			t.Fatalf("cube position of %v: got (%v, %v), want %v", c.dir, x, y, c.cube)
+		}
+		if got := CubeDirection(cube, c.cube[0], c.cube[1]); !dirNear(got, c.dir, 1e-9) {
+			t.Fatalf("cube direction at %v: got %v, want %v", c.cube, got, c.dir)
+		}
+	}
+
+	// Every pixel maps to a direction, that maps back to the pixel.
+	for y := cube.Min.Y; y < cube.Max.Y; y++ {
+		for x := cube.Min.X; x < cube.Max.X; x++ {
+			d := CubeDirection(cube, float64(x), float64(y))
+			if gx, gy := CubePosition(cube, d); !dirNear(CubeDirection(cube, gx, gy), d, 1e-9) {
+				t.Fatalf("cube pixel (%d, %d): direction %v maps to (%v, %v)", x, y, d, gx, gy)
+			}
+		}
+	}
+	for y := latlong.Min.Y; y < latlong.Max.Y; y++ {
+		for x := latlong.Min.X; x < latlong.Max.X; x++ {
+			d := LatLongDirection(latlong, float64(x), float64(y))
+			if gx, gy := LatLongPosition(latlong, d); !dirNear(LatLongDirection(latlong, gx, gy), d, 1e-9) {
+				t.Fatalf("latlong pixel (%d, %d): direction %v maps to (%v, %v)", x, y, d, gx, gy)
+			}
+		}
+	}
+}
+
+// envmapImage returns an environment map, those channels are functions of directions.
+func envmapImage(typ envmap, r image.Rectangle) *Image {
+	m := &Image{Header: make(Header), Rect: r}
+	m.Header.SetEnvmap(typ)
+	l, _ := newEnvmapLayout(typ, r)
+	y := newChannel(channel{name: "Y", pixelType: FLOAT, xSampling: 1, ySampling: 1}, r)
+	id := newChannel(channel{name: "id", pixelType: UINT, xSampling: 1, ySampling: 1}, r)
+	for py := r.Min.Y; py < r.Max.Y; py++ {
+		for px := r.Min.X; px < r.Max.X; px++ {
+			d, ok := l.direction(px, py)
+			if !ok {
+				continue
+			}
+			y.Float[y.PixOffset(px, py)] = float32(1 + d[0] + d[1]/2)
+			if d[1] > 0 {
+				id.Uint[id.PixOffset(px, py)] = 1
+			}
+		}
+	}
+	m.Channels = []*Channel{y, id}
+	return m
+}
+
+func TestConvertEnvmap(t *testing.T) {
+	latlong := image.Rect(0, 0, 129, 65)
+	cube := image.Rect(0, 0, 32, 192)
+	cases := []struct {
+		name string
+		src  *Image
+		typ  envmap
+		r    image.Rectangle
+	}{
+		{"latlong to cube", envmapImage(ENVMAP_LATLONG, latlong), ENVMAP_CUBE, cube},
+		{"cube to latlong", envmapImage(ENVMAP_CUBE, cube), ENVMAP_LATLONG, latlong},
+		{"downsize latlong", envmapImage(ENVMAP_LATLONG, latlong), ENVMAP_LATLONG, image.Rect(0, 0, 33, 17)},
+	}
+	for _, c := range cases {
+		got, err := c.src.ConvertEnvmap(c.typ, c.r)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if typ, ok := got.Header.Envmap(); !ok || typ != c.typ {
+			t.Fatalf("%s: envmap attribute: got %v, want %v", c.name, typ, c.typ)
+		}
+		want := envmapImage(c.typ, c.r)
+		wy, gy := want.Channel("Y"), got.Channel("Y")
+		wid, gid := want.Channel("id"), got.Channel("id")
+		l, _ := newEnvmapLayout(c.typ, c.r)
+		for y := c.r.Min.Y; y < c.r.Max.Y; y++ {
+			for x := c.r.Min.X; x < c.r.Max.X; x++ {
+				d, _ := l.direction(x, y)
+				i := gy.PixOffset(x, y)
+				// Filtering blurs the values by about a pixel.
+				if math.Abs(float64(gy.Float[i]-wy.Float[i])) > 0.1 {
+					t.Fatalf("%s: Y at (%d, %d): got %v, want %v", c.name, x, y, gy.Float[i], wy.Float[i])
+				}
+				if math.Abs(d[1]) > 0.2 && gid.Uint[i] != wid.Uint[i] {
+					t.Fatalf("%s: id at (%d, %d): got %v, want %v", c.name, x, y, gid.Uint[i], wid.Uint[i])
+				}
+			}
+		}
+	}
+
+	if _, err := (&Image{Header: make(Header), Rect: latlong}).ConvertEnvmap(ENVMAP_CUBE, cube); err == nil {
+		t.Fatalf("converted an image without envmap attribute")
+	}
+	if _, err := envmapImage(ENVMAP_LATLONG, latlong).ConvertEnvmap(ENVMAP_CUBE, image.Rect(0, 0, 32, 5)); err == nil {
+		t.Fatalf("converted to a cube map without room for the faces")
+	}
+}
@@ -5,11 +5,9 @@ import (
 	"encoding/binary"
 	"fmt"
 	"image"
-	"image/color"
-	"image/png"
-	"log"
-	"math"
+	"io"
 	"os"
+	"strings"
 )
 
 // A FormatError reports that the input is not a valid EXR image.
@@ -63,21 +61,123 @@ type VersionField struct {
 	multiPart bool
 }
 
+// DecodeOptions are the decoding parameters.
+type DecodeOptions struct {
+	// DisplayWindow makes the decoder return pixels in the display window,
+	// instead of the data window. Pixels outside of the data window are 0,
+	// and pixels outside of the display window (overscan) are dropped.
+	DisplayWindow bool
+
+	// Tolerant makes the decoder skip chunks those fail to be read or decompressed,
+	// instead of returning an error. The decoder returns the image decoded from
+	// the other chunks, with an *IncompleteError that reports the failed
+	// and missing chunks.
+	Tolerant bool
+
+	// Fill is the pixel value of HALF and FLOAT channels in lines of
+	// the failed and missing chunks, in the tolerant mode.
+	// UINT channels are filled with 0.
+	Fill float32
+
+	// Region makes the decoder read only the chunks (scanline blocks or tiles)
+	// those intersect with it, and return an image those bounds are Region.
+	// Pixels in Region outside of the data window are 0.
+	// DisplayWindow is ignored when Region is not empty.
+	Region image.Rectangle
+
+	// Channels makes the decoder decode only the channels those names are in it,
+	// or those are in the layers in it. For example, "Z" selects the Z channel,
+	// and "diffuse" selects diffuse.R, diffuse.G and diffuse.B channels.
+	// Other channels are skipped, without being unpacked or even read when possible.
+	// All channels are decoded when it is empty.
+	Channels []string
+
+	// Limits are limits of the resources for the image. The decoder returns
+	// a LimitError, when the image needs more. DefaultLimits are used when it is nil.
+	Limits *Limits
+
+	// Workers is the number of goroutines those decompress chunks concurrently.
+	// Chunks are still read from the same open file, and each of them is unpacked
+	// to the lines of it's own block. Chunks are decoded one by one in the calling
+	// goroutine, when it is 0 or 1. runtime.GOMAXPROCS(0) is a good value
+	// for large compressed images.
+	Workers int
+}
+
+// Decode reads an exr image from the file, and returns it's first part as *Image.
+// Bounds of the image is the data window.
+//
+// When some chunks are missing, such as in a truncated file, it returns
+// the image decoded from the other chunks, with an *IncompleteError
+// that reports the missing chunks.
 func Decode(path string) (image.Image, error) {
+	m, err := DecodeWithOptions(path, nil)
+	if m == nil {
+		return nil, err
+	}
+	return m, err
+}
+
+// DecodeWithOptions reads an exr image from the file with the options,
+// and returns it's first part. A nil o is the same with the zero DecodeOptions.
+// Like Decode, it returns a non-nil image with an *IncompleteError.
+// Other errors are returned with a nil image.
+func DecodeWithOptions(path string, o *DecodeOptions) (*Image, error) {
+	if o == nil {
+		o = &DecodeOptions{}
+	}
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
-	r := bufio.NewReader(f)
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	d, err := newDecoder(f, fi.Size(), o.Limits)
+	if err != nil {
+		return nil, err
+	}
+	m, err := d.decodePart(0, o)
+	if m == nil {
+		return nil, err
+	}
+	return o.reframe(m), err
+}
+
+// reframe returns m in the region or in the display window, as the options ask.
+func (o *DecodeOptions) reframe(m *Image) *Image {
+	switch {
+	case !o.Region.Empty():
+		return m.Reframe(o.Region)
+	case o.DisplayWindow:
+		return m.Reframe(m.Header.DisplayWindow())
+	}
+	return m
+}
+
+// channelSelected reports whether the named channel is selected
+// by a list of channel names or layer names.
+func channelSelected(name string, selection []string) bool {
+	for _, s := range selection {
+		if name == s || strings.HasPrefix(name, strings.TrimSuffix(s, ".")+".") {
+			return true
+		}
+	}
+	return false
+}
 
+// readVersion reads the magic number and the version field of an exr image.
+func readVersion(r *bufio.Reader) (VersionField, error) {
 	// Magic number: 4 bytes
 	magicByte, err := read(r, 4)
 	if err != nil {
-		return nil, err
+		return VersionField{}, truncated(err, "version field")
 	}
 	magic := int(parse.Uint32(magicByte))
 	if magic != MagicNumber {
-		return nil, FormatError(fmt.Sprintf("wrong magic number"))
+		return VersionField{}, FormatError(fmt.Sprintf("wrong magic number"))
 	}
 
 	// version field: 4 bytes
@@ -85,9 +185,12 @@ func Decode(path string) (image.Image, error) {
 	// next 3 bytes: set of boolean flags
 	versionBytes, err := read(r, 4)
 	if err != nil {
-		return nil, err
+		return VersionField{}, truncated(err, "version field")
 	}
 	versionNum := int(parse.Uint32(versionBytes))
+	if err := validateVersion(uint32(versionNum)); err != nil {
+		return VersionField{}, err
+	}
 
 	vf := VersionField{
 		version:   int(versionBytes[0]),
@@ -98,28 +201,25 @@ func Decode(path string) (image.Image, error) {
 	}
 	if vf.tiled {
 		if vf.deep {
-			return nil, FormatError("single tile bit is on, non-image bit should be off")
+			return VersionField{}, FormatError("single tile bit is on, non-image bit should be off")
 		}
 		if vf.multiPart {
-			return nil, FormatError("single tile bit is on, multi-part bit should be off")
+			return VersionField{}, FormatError("single tile bit is on, multi-part bit should be off")
 		}
 	}
+	return vf, nil
+}
 
-	fmt.Println("version: ", vf.version)
-	fmt.Println("tiled: ", vf.tiled)
-	fmt.Println("multi part: ", vf.multiPart)
-	fmt.Println("deep: ", vf.deep)
-	fmt.Println("long name: ", vf.longName)
-
-	// Parse attributes of a header.
-	parts := make([]map[string]attribute, 0)
-
+// readHeaders reads headers of all parts in an exr image.
+// Single part image always have one header.
+// A nil l is the same with DefaultLimits.
+func readHeaders(r *bufio.Reader, vf VersionField, l *Limits) ([]Header, error) {
+	l = limitsOrDefault(l)
+	parts := make([]Header, 0)
 	for {
-		fmt.Println("== a part ==")
-
-		header := make(map[string]attribute)
+		header := make(Header)
 		for {
-			pAttr, err := parseAttribute(r, parse)
+			pAttr, err := parseAttribute(r, parse, l)
 			if err != nil {
 				return nil, err
 			}
@@ -137,220 +237,81 @@ func Decode(path string) (image.Image, error) {
 		}
 		bs, err := r.Peek(1)
 		if err != nil {
-			return nil, err
+			return nil, truncated(err, "header")
 		}
 		if bs[0] == 0x00 {
+			// An empty header indicates end of the headers.
+			r.Discard(1)
 			break
 		}
 	}
-
-	// TODO: Parse multi-part image.
-	if vf.multiPart {
-		log.Fatal("does not support multi-part image yet")
-	}
-	header := parts[0]
-
-	for _, attr := range header {
-		switch attr.typ {
-		case "float":
-			fmt.Println(attr.name, math.Float32frombits(parse.Uint32(attr.value)))
-		case "box2i":
-			fmt.Println(attr.name, box2iFromBytes(attr.value))
-		case "box2f":
-			fmt.Println(attr.name, box2fFromBytes(attr.value))
-		case "chlist":
-			fmt.Println(attr.name, chlistFromBytes(attr.value))
-		case "chromaticities":
-			fmt.Println(attr.name, chromaticitiesFromBytes(attr.value))
-		case "compression":
-			fmt.Println(attr.name, compressionFromBytes(attr.value))
-		case "envmap":
-			fmt.Println(attr.name, envmapFromBytes(attr.value))
-		case "keycode":
-			fmt.Println(attr.name, keycodeFromBytes(attr.value))
-		case "lineOrder":
-			fmt.Println(attr.name, lineOrderFromBytes(attr.value))
-		case "m33f":
-			fmt.Println(attr.name, m33fFromBytes(attr.value))
-		case "m44f":
-			fmt.Println(attr.name, m44fFromBytes(attr.value))
-		case "preview":
-			// long result
-			// fmt.Println(attr.name, previewFromBytes(attr.value))
-		case "rational":
-			fmt.Println(attr.name, rationalFromBytes(attr.value))
-		case "string":
-			fmt.Println(attr.name, string(attr.value))
-		case "tiledesc":
-			fmt.Println(attr.name, tiledescFromBytes(attr.value))
-		case "timecode":
-			fmt.Println(attr.name, timecodeFromBytes(attr.value))
-		case "v2i":
-			fmt.Println(attr.name, v2iFromBytes(attr.value))
-		case "v2f":
-			fmt.Println(attr.name, v2fFromBytes(attr.value))
-		case "v3i":
-			fmt.Println(attr.name, v3iFromBytes(attr.value))
-		case "v3f":
-			fmt.Println(attr.name, v3fFromBytes(attr.value))
-		default:
-			fmt.Printf("unknown type of attribute %q: %v\n", attr.name, attr.typ)
-		}
-	}
-
-	// Parse channels.
-	channelsAttr, ok := header["channels"]
-	if !ok {
-		return nil, FormatError("header does not have 'channels' attribute")
-	}
-	channels := chlistFromBytes(channelsAttr.value)
-	fmt.Println("channels: ", channels)
-
-	// Check image (x, y) size.
-	dataWindowAttr, ok := header["dataWindow"]
-	if !ok {
-		return nil, FormatError("header does not have 'dataWindow' attribute")
-	}
-	dataWindow := box2iFromBytes(dataWindowAttr.value)
-	fmt.Println("data window: ", dataWindow)
-
-	// Check compression method.
-	compressionAttr, ok := header["compression"]
-	if !ok {
-		return nil, FormatError("header does not have 'compression' attribute")
-	}
-	compressionMethod := compressionFromBytes(compressionAttr.value)
-	blockLines := numLinesPerBlock[compressionMethod]
-	fmt.Printf("compression method: %v - %v lines per block\n", compressionMethod, blockLines)
-
-	lineOrderAttr, ok := header["lineOrder"]
-	if !ok {
-		return nil, FormatError("header does not have 'lineOrder' attribute")
-	}
-	lineOrder := lineOrderFromBytes(lineOrderAttr.value)
-	fmt.Printf("line order: %v\n", lineOrder)
-
-	// Parse offsets.
-	nLines := int(dataWindow.yMax - dataWindow.yMin + 1)
-	nChunks := nLines / blockLines
-	if nLines%blockLines != 0 {
-		nChunks++
-	}
-	fmt.Printf("number of chunks: %d = %d/%d\n", nChunks, nLines, blockLines)
-	offsets := make([]uint64, nChunks)
-	for i := range offsets {
-		offsetByte, err := read(r, 8)
-		if err != nil {
-			return nil, err
-		}
-		offsets[i] = uint64(parse.Uint64(offsetByte))
-	}
-	fmt.Println(offsets)
-
-	rgba := image.NewRGBA64(image.Rect(int(dataWindow.xMin), int(dataWindow.yMin), int(dataWindow.xMax), int(dataWindow.yMax)))
-	for i, o := range offsets {
-		f, err := os.Open(path)
-		if err != nil {
-			return nil, err
-		}
-		r := bufio.NewReader(f)
-		_, err = r.Discard(int(o))
-		if err != nil {
-			log.Fatal("discard failed")
-		}
-		n, err := read(r, 4)
-		if err != nil {
-			log.Fatal("read offset failed")
-		}
-		yoffset := int(parse.Uint32(n)) // y offset
-		n, err = read(r, 4)
-		if err != nil {
-			log.Fatal("read offset failed")
-		}
-		size := int(parse.Uint32(n))
-		if i != len(offsets)-1 {
-			got := uint64(int(o) + 8 + size)
-			if got != offsets[i+1] {
-				fmt.Printf("%v + 8 + %v: got %v, want %v\n", o, size, int(o)+8+size, offsets[i+1])
-			}
-		}
-		compressed, err := read(r, size)
-		if err != nil {
-			log.Fatal("read compressed data failed")
-		}
-		width := int(dataWindow.xMax - dataWindow.xMin + 1)
-		block := newBlockInfo(compressionMethod, channels, yoffset, width)
-		raw := decompress(block, compressed)
-
-		var c color.RGBA64
-		for _, ch := range block.channels {
-			s := pixelSize(ch.pixelType)
-			for y := yoffset; y < yoffset+block.height; y++ {
-				for x := 0; x < block.width; x++ {
-					c = rgba.RGBA64At(x, y)
-					f := half(parse.Uint16(raw[:s]))
-					v := uint16(f * 65535)
-					// v := parse.Uint16(raw[:s])
-					// fmt.Println(ch.name, v)
-					raw = raw[s:]
-					switch ch.name {
-					case "R":
-						c.R = v
-						rgba.SetRGBA64(x, y, c)
-					case "G":
-						c.G = v
-						rgba.SetRGBA64(x, y, c)
-					case "B":
-						c.B = v
-						rgba.SetRGBA64(x, y, c)
-					case "A":
-						c.A = v
-						rgba.SetRGBA64(x, y, c)
-					}
-				}
-			}
-		}
-	}
-	out, err := os.Create("test.png")
-	if err != nil {
-		log.Fatal("unable to open test.png")
+	if err := validateHeaders(vf, parts); err != nil {
+		return nil, err
 	}
-	png.Encode(out, rgba)
-	return nil, nil
+	return parts, nil
 }
 
-func decompress(block blockInfo, compressed []byte) []byte {
-	if block.compression == PIZ_COMPRESSION {
+// decompress decompresses data of a block.
+// It returns raw data of the block, each line of it has pixel values of all channels,
+// one channel after another.
+func decompress(block blockInfo, compressed []byte) ([]byte, error) {
+	if len(compressed) == block.rawSize() {
+		// Data is stored uncompressed, when compression doesn't make it smaller.
+		return compressed, nil
+	}
+	switch block.compression {
+	case NO_COMPRESSION:
+		return nil, FormatError(fmt.Sprintf("uncompressed block at line %d has wrong size of data", block.y))
+	case PIZ_COMPRESSION:
 		return pizDecompress(block, compressed)
 	}
-	log.Fatalf("decompress of %d not supported yet", block.compression)
-	return nil
+	return nil, UnsupportedError(fmt.Sprintf("decompress of %v", block.compression))
 }
 
 // blockInfo contains information of block to compress or decompress the images.
 type blockInfo struct {
 	compression compression
 	channels    chlist
+	x           int // x coordinate of the first pixel in a line
 	y           int
 	width       int
 	height      int
-	pixsize     int // sum of pixel size of channels
+
+	// skip is true for channels those pixel values aren't needed.
+	// Decompressors could leave their data undecoded. It is nil when all channels are needed.
+	skip []bool
 }
 
-func newBlockInfo(c compression, channels chlist, y, width int) blockInfo {
-	pixsize := 0
-	for _, ch := range channels {
-		pixsize += pixelSize(ch.pixelType)
-	}
+func newBlockInfo(c compression, channels chlist, x, y, width, height int) blockInfo {
 	return blockInfo{
 		compression: c,
 		channels:    channels,
+		x:           x,
+		y:           y,
 		width:       width,
-		height:      numLinesPerBlock[c],
-		pixsize:     pixsize,
+		height:      height,
 	}
 }
 
+// channelSize returns number of samples of a channel in the block,
+// in x and y direction. It is smaller than width and height of the block,
+// when the channel is subsampled.
+func (b blockInfo) channelSize(ch channel) (int, int) {
+	nx := numSamples(int(ch.xSampling), b.x, b.x+b.width-1)
+	ny := numSamples(int(ch.ySampling), b.y, b.y+b.height-1)
+	return nx, ny
+}
+
+// rawSize returns size of the uncompressed data of the block in bytes.
+func (b blockInfo) rawSize() int {
+	size := 0
+	for _, ch := range b.channels {
+		nx, ny := b.channelSize(ch)
+		size += nx * ny * pixelSize(ch.pixelType)
+	}
+	return size
+}
+
 type attribute struct {
 	name  string
 	typ   string
@@ -366,39 +327,42 @@ type attribute struct {
 // 	(nil, error) if any error occurred when read.
 // 	(nil, nil) if the header ends.
 //
-func parseAttribute(r *bufio.Reader, parse binary.ByteOrder) (*attribute, error) {
+// The value size is checked with l before the value is read.
+func parseAttribute(r *bufio.Reader, parse binary.ByteOrder, l *Limits) (*attribute, error) {
 	nameByte, err := r.ReadBytes(0x00)
 	if err != nil {
-		return nil, err
+		return nil, truncated(err, "header")
 	}
 	nameByte = nameByte[:len(nameByte)-1] // remove trailing 0x00
 	if len(nameByte) == 0 {
 		// Header ends.
 		return nil, nil
 	}
-	// TODO: Properly validate length of attribute name.
-	if len(nameByte) > 255 {
+	// Length of the name is validated with the version field later.
+	if len(nameByte) > maxLongNameLen {
 		return nil, FormatError("attribute name too long.")
 	}
 	name := string(nameByte)
 
 	typeByte, err := r.ReadBytes(0x00)
-	typeByte = typeByte[:len(typeByte)-1] // remove trailing 0x00
 	if err != nil {
-		return nil, err
+		return nil, truncated(err, "header")
 	}
+	typeByte = typeByte[:len(typeByte)-1] // remove trailing 0x00
 	typ := string(typeByte)
-	// TODO: Should I validate the length of attribute type?
 
 	sizeByte, err := read(r, 4)
 	if err != nil {
-		return nil, err
+		return nil, truncated(err, "header")
 	}
 	size := int(parse.Uint32(sizeByte))
+	if err := l.checkAttributeSize(name, size); err != nil {
+		return nil, err
+	}
 
 	valueByte, err := read(r, size)
 	if err != nil {
-		return nil, err
+		return nil, truncated(err, "header")
 	}
 
 	attr := attribute{
@@ -410,8 +374,18 @@ func parseAttribute(r *bufio.Reader, parse binary.ByteOrder) (*attribute, error)
 	return &attr, nil
 }
 
+// truncated returns a FormatError that reports truncated data of what,
+// when err is an EOF of the data. Other errors are returned as they are.
+func truncated(err error, what string) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return FormatError("truncated " + what)
+	}
+	return err
+}
+
 // read reads _size_ bytes from *bufio.Reader and return it as ([]byte, error) form.
 // If error occurs during read, it will return nil, error.
+// Data shorter than size is an io.ErrUnexpectedEOF, like io.ReadFull.
 func read(r *bufio.Reader, size int) ([]byte, error) {
 	bs := make([]byte, 0, size)
 	remain := size
@@ -422,6 +396,9 @@ func read(r *bufio.Reader, size int) ([]byte, error) {
 		}
 		b := make([]byte, s)
 		n, err := r.Read(b)
+		if err == io.EOF && remain < size {
+			err = io.ErrUnexpectedEOF
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -1,19 +1,144 @@
 package exr
 
 import (
+	"bufio"
+	"bytes"
+	"image"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
 func TestDecode(t *testing.T) {
 	// These are all valid exr files.
-	cases := []string{
-		"image/scanline.exr",
+	cases := []struct {
+		path   string
+		bounds image.Rectangle
+	}{
+		{"image/scanline.exr", image.Rect(0, 0, 928, 906)},
 	}
 
 	for _, c := range cases {
-		_, err := Decode(c)
+		m, err := Decode(c.path)
 		if err != nil {
-			t.Fatalf("Could not decode exr image: %v: %v", c, err)
+			t.Fatalf("Could not decode exr image: %v: %v", c.path, err)
 		}
+		if m.Bounds() != c.bounds {
+			t.Fatalf("%v: bounds: got %v, want %v", c.path, m.Bounds(), c.bounds)
+		}
+	}
+}
+
+// encodeTemp encodes m to a temporary file, and returns path of the file.
+// The caller should remove the file after use.
+func encodeTemp(t *testing.T, m image.Image, o *Options) string {
+	dir, err := ioutil.TempDir("", "exr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "test.exr")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := Encode(f, m, o); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDecodePixelTypes(t *testing.T) {
+	rect := image.Rect(-1, 2, 3, 5)
+	n := rect.Dx() * rect.Dy()
+	id := &Channel{Name: "id", Type: UINT, Rect: rect, Uint: make([]uint32, n)}
+	z := &Channel{Name: "Z", Type: FLOAT, Rect: rect, Float: make([]float32, n)}
+	r := &Channel{Name: "R", Type: HALF, Rect: rect, Float: make([]float32, n)}
+	for i := 0; i < n; i++ {
+		id.Uint[i] = math.MaxUint32 - uint32(i)
+		z.Float[i] = 1e10 + float32(i)
+		r.Float[i] = float32(i) / 4
+	}
+	want := &Image{
+		Header:   make(Header),
+		Rect:     rect,
+		Channels: []*Channel{id, z, r},
+	}
+	path := encodeTemp(t, want, nil)
+	defer os.RemoveAll(filepath.Dir(path))
+	m, err := Decode(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := m.(*Image)
+	if got.Rect != rect {
+		t.Fatalf("bounds: got %v, want %v", got.Rect, rect)
+	}
+	for _, wc := range want.Channels {
+		gc := got.Channel(wc.Name)
+		if gc == nil {
+			t.Fatalf("channel %q not found", wc.Name)
+		}
+		if gc.Type != wc.Type {
+			t.Fatalf("channel %q: type: got %v, want %v", wc.Name, gc.Type, wc.Type)
+		}
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if g, w := gc.UintAt(x, y), wc.UintAt(x, y); g != w {
+					t.Fatalf("channel %q at (%d, %d): got %v, want %v", wc.Name, x, y, g, w)
+				}
+				if g, w := gc.FloatAt(x, y), wc.FloatAt(x, y); g != w {
+					t.Fatalf("channel %q at (%d, %d): got %v, want %v", wc.Name, x, y, g, w)
+				}
+			}
+		}
+	}
+}
+
+// fuzzSeedSize is the maximum size of a seed of the fuzz targets.
+// The fuzzer is too slow with larger inputs, such as the whole test files.
+const fuzzSeedSize = 1 << 16
+
+// testFiles returns contents of the exr files in the image directory.
+// They are the seed corpus of the fuzz targets.
+func testFiles(tb testing.TB) [][]byte {
+	paths, err := filepath.Glob("image/*.exr")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	files := make([][]byte, 0, len(paths))
+	for _, p := range paths {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		files = append(files, b)
 	}
+	return files
+}
+
+func FuzzParseAttribute(f *testing.F) {
+	for _, b := range testFiles(f) {
+		// Headers start after the magic number and the version field.
+		b = b[8:]
+		if len(b) > fuzzSeedSize {
+			b = b[:fuzzSeedSize]
+		}
+		f.Add(b)
+	}
+	l := &Limits{MaxAttributeSize: 1 << 20}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		r := bufio.NewReader(bytes.NewReader(b))
+		for {
+			attr, err := parseAttribute(r, parse, l)
+			if err != nil || attr == nil {
+				return
+			}
+			if attr.size != len(attr.value) {
+				t.Fatalf("attribute %q: size is %d, but value has %d bytes", attr.name, attr.size, len(attr.value))
+			}
+		}
+	})
 }
@@ -2,7 +2,209 @@ package exr
 
 import "math"
 
+// Half is a 16 bit IEEE floating point number. (binary16)
+//
+// It has 1 sign bit, 5 exponent bits and 10 mantissa bits.
+type Half uint16
+
+const (
+	halfSignMask     = 0x8000
+	halfExponentMask = 0x7C00
+	halfMantissaMask = 0x03FF
+)
+
+// halfTable maps every half (as an index) to it's float32 value.
+var halfTable = newHalfTable()
+
+func newHalfTable() []float32 {
+	t := make([]float32, 1<<16)
+	for i := range t {
+		t[i] = half(uint16(i))
+	}
+	return t
+}
+
+// halfExponentTable maps sign and exponent bits of a float32 (upper 9 bits)
+// to sign and exponent bits of a half.
+//
+// It has 0 for exponents those could make a denormalized half,
+// an infinity or a NaN. These should be handled by fromFloat32Bits.
+var halfExponentTable = newHalfExponentTable()
+
+func newHalfExponentTable() []uint16 {
+	t := make([]uint16, 1<<9)
+	for i := 0; i < 0x100; i++ {
+		e := (i & 0xFF) - (127 - 15)
+		if e <= 0 || e >= 30 {
+			continue
+		}
+		t[i] = uint16(e << 10)
+		t[i|0x100] = uint16(e<<10) | halfSignMask
+	}
+	return t
+}
+
+// FromFloat32 converts a float32 to the nearest Half.
+//
+// Ties are rounded to even. Values too large for a Half become
+// an infinity of the same sign, and values too small become a signed zero.
+// Small values that fit in denormalized Half are kept as denormals.
+// NaN is kept as NaN, preserving upper bits of it's mantissa.
+func FromFloat32(f float32) Half {
+	i := math.Float32bits(f)
+	if e := halfExponentTable[i>>23]; e != 0 {
+		// Normalized half. Round the mantissa to nearest even.
+		// When the rounded mantissa overflows, it carries to the exponent.
+		m := i & 0x007FFFFF
+		return Half(uint32(e) + (m+0x00000FFF+((m>>13)&1))>>13)
+	}
+	return fromFloat32Bits(i)
+}
+
+// fromFloat32Bits converts a float32 to the nearest Half,
+// without help of halfExponentTable.
+func fromFloat32Bits(i uint32) Half {
+	s := (i >> 16) & halfSignMask
+	e := int((i>>23)&0xFF) - (127 - 15)
+	m := i & 0x007FFFFF
+
+	if e <= 0 {
+		if e < -10 {
+			// Too small to be represented as a denormalized half.
+			return Half(s)
+		}
+		// Denormalized half. Add the leading 1 bit to the mantissa,
+		// then shift it, rounding to nearest even.
+		m |= 0x00800000
+		t := uint(14 - e)
+		a := uint32(1)<<(t-1) - 1
+		b := (m >> t) & 1
+		m = (m + a + b) >> t
+		return Half(s | m)
+	}
+	if e == 0xFF-(127-15) {
+		if m == 0 {
+			// Infinity
+			return Half(s | halfExponentMask)
+		}
+		// NaN. Keep the upper bits of the mantissa,
+		// but make sure it doesn't become an infinity.
+		m >>= 13
+		if m == 0 {
+			m = 1
+		}
+		return Half(s | halfExponentMask | m)
+	}
+	// Normalized half. Round the mantissa to nearest even.
+	m = m + 0x00000FFF + ((m >> 13) & 1)
+	if m&0x00800000 != 0 {
+		// Mantissa overflowed, increase the exponent.
+		m = 0
+		e++
+	}
+	if e > 30 {
+		// Overflow to infinity.
+		return Half(s | halfExponentMask)
+	}
+	return Half(s | uint32(e)<<10 | m>>13)
+}
+
+// Float32 converts the Half to a float32. It is always exact.
+func (h Half) Float32() float32 {
+	return halfTable[h]
+}
+
+// IsNaN reports whether h is a NaN.
+func (h Half) IsNaN() bool {
+	return h&halfExponentMask == halfExponentMask && h&halfMantissaMask != 0
+}
+
+// IsInf reports whether h is an infinity, either positive or negative.
+func (h Half) IsInf() bool {
+	return h&halfExponentMask == halfExponentMask && h&halfMantissaMask == 0
+}
+
+// IsFinite reports whether h is neither an infinity nor a NaN.
+func (h Half) IsFinite() bool {
+	return h&halfExponentMask != halfExponentMask
+}
+
+// IsNormalized reports whether h is a normalized number.
+func (h Half) IsNormalized() bool {
+	e := h & halfExponentMask
+	return e != 0 && e != halfExponentMask
+}
+
+// IsDenormalized reports whether h is a denormalized number.
+func (h Half) IsDenormalized() bool {
+	return h&halfExponentMask == 0 && h&halfMantissaMask != 0
+}
+
+// IsZero reports whether h is a zero, either positive or negative.
+func (h Half) IsZero() bool {
+	return h&^halfSignMask == 0
+}
+
+// IsNegative reports whether the sign bit of h is set.
+func (h Half) IsNegative() bool {
+	return h&halfSignMask != 0
+}
+
+// HalfsToFloat32s converts Halfs in src to float32s, and stores them to dst.
+// It returns number of converted values, which is the minimum of len(dst) and len(src).
+func HalfsToFloat32s(dst []float32, src []Half) int {
+	n := len(src)
+	if len(dst) < n {
+		n = len(dst)
+	}
+	for i, h := range src[:n] {
+		dst[i] = halfTable[h]
+	}
+	return n
+}
+
+// Float32sToHalfs converts float32s in src to Halfs, and stores them to dst.
+// It returns number of converted values, which is the minimum of len(dst) and len(src).
+func Float32sToHalfs(dst []Half, src []float32) int {
+	n := len(src)
+	if len(dst) < n {
+		n = len(dst)
+	}
+	for i, f := range src[:n] {
+		dst[i] = FromFloat32(f)
+	}
+	return n
+}
+
+// uint16sToFloat32s converts halfs in src to float32s, and stores them to dst.
+// It returns number of converted values, which is the minimum of len(dst) and len(src).
+func uint16sToFloat32s(dst []float32, src []uint16) int {
+	n := len(src)
+	if len(dst) < n {
+		n = len(dst)
+	}
+	for i, h := range src[:n] {
+		dst[i] = halfTable[h]
+	}
+	return n
+}
+
+// float32sToUint16s converts float32s in src to halfs, and stores them to dst.
+// It returns number of converted values, which is the minimum of len(dst) and len(src).
+func float32sToUint16s(dst []uint16, src []float32) int {
+	n := len(src)
+	if len(dst) < n {
+		n = len(dst)
+	}
+	for i, f := range src[:n] {
+		dst[i] = uint16(FromFloat32(f))
+	}
+	return n
+}
+
 // half converts a uint16 to 32bit IEEE float.
+//
+// It is used to build halfTable. Use the table to convert many values.
 func half(h uint16) float32 {
 	var x uint32
 
@@ -31,7 +233,7 @@ func half(h uint16) float32 {
 			if hm == 0 { // If mantissa is zero ...
 				x = (uint32(hs) << 16) | 0x7F800000 // Signed Inf
 			} else {
-				x = uint32(0xFFC00000) // NaN, only 1st mantissa bit set
+				x = (uint32(hs) << 16) | 0x7F800000 | (uint32(hm) << 13) // NaN, preserve the mantissa
 			}
 		} else { // Normalized number
 			xs := uint32(hs) << 16        // Sign bit
@@ -0,0 +1,190 @@
+package exr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFromFloat32(t *testing.T) {
+	cases := []struct {
+		f    float32
+		want Half
+	}{
+		{f: 0, want: 0x0000},
+		{f: float32(math.Copysign(0, -1)), want: 0x8000},
+		{f: 1, want: 0x3C00},
+		{f: -2, want: 0xC000},
+		{f: 0.1, want: 0x2E66},
+		{f: 65504, want: 0x7BFF}, // max half
+		{f: 65519, want: 0x7BFF}, // rounded down to max half
+		{f: 65520, want: 0x7C00}, // overflow to infinity
+		{f: -1e10, want: 0xFC00},
+		{f: float32(math.Inf(1)), want: 0x7C00},
+		{f: float32(math.Inf(-1)), want: 0xFC00},
+		{f: 1.0009765625, want: 0x3C01},       // 1 + 2^-10
+		{f: 1.00048828125, want: 0x3C00},      // 1 + 2^-11, tie to even
+		{f: 1.00146484375, want: 0x3C02},      // 1 + 3*2^-11, tie to even
+		{f: 6.103515625e-05, want: 0x0400},    // min normalized half
+		{f: 5.9604644775390625e-08, want: 1},  // min denormalized half
+		{f: 2.98023223876953125e-08, want: 0}, // 2^-25, tie to even
+		{f: 4.470348358154297e-08, want: 1},   // 1.5 * 2^-25
+		{f: 1e-10, want: 0},
+		{f: -1e-10, want: 0x8000},
+	}
+	for _, c := range cases {
+		got := FromFloat32(c.f)
+		if got != c.want {
+			t.Fatalf("FromFloat32(%v): got %#04x, want %#04x", c.f, got, c.want)
+		}
+	}
+
+	nan := FromFloat32(float32(math.NaN()))
+	if !nan.IsNaN() {
+		t.Fatalf("FromFloat32(NaN): got %#04x, want NaN", nan)
+	}
+	// NaN that has only lower bits of mantissa shouldn't become an infinity.
+	nan = FromFloat32(math.Float32frombits(0x7F800001))
+	if !nan.IsNaN() {
+		t.Fatalf("FromFloat32(%#08x): got %#04x, want NaN", 0x7F800001, nan)
+	}
+}
+
+func TestHalfRoundTrip(t *testing.T) {
+	for i := 0; i < 1<<16; i++ {
+		h := Half(i)
+		got := FromFloat32(h.Float32())
+		if got != h {
+			t.Fatalf("FromFloat32(%#04x.Float32()): got %#04x", i, got)
+		}
+	}
+}
+
+func TestHalfClassification(t *testing.T) {
+	cases := []struct {
+		h            Half
+		nan          bool
+		inf          bool
+		normalized   bool
+		denormalized bool
+		zero         bool
+		negative     bool
+	}{
+		{h: 0x0000, zero: true},
+		{h: 0x8000, zero: true, negative: true},
+		{h: 0x3C00, normalized: true},
+		{h: 0x0001, denormalized: true},
+		{h: 0x83FF, denormalized: true, negative: true},
+		{h: 0x7C00, inf: true},
+		{h: 0xFC00, inf: true, negative: true},
+		{h: 0x7E00, nan: true},
+	}
+	for _, c := range cases {
+		if c.h.IsNaN() != c.nan ||
+			c.h.IsInf() != c.inf ||
+			c.h.IsNormalized() != c.normalized ||
+			c.h.IsDenormalized() != c.denormalized ||
+			c.h.IsZero() != c.zero ||
+			c.h.IsNegative() != c.negative ||
+			c.h.IsFinite() != !(c.nan || c.inf) {
+			t.Fatalf("wrong classification of %#04x", c.h)
+		}
+	}
+}
+
+func TestHalfSlices(t *testing.T) {
+	src := []float32{0, 1, -2, 0.5, 65504}
+	hs := make([]Half, 4)
+	if n := Float32sToHalfs(hs, src); n != 4 {
+		t.Fatalf("Float32sToHalfs: got %d converted, want 4", n)
+	}
+	dst := make([]float32, 5)
+	if n := HalfsToFloat32s(dst, hs); n != 4 {
+		t.Fatalf("HalfsToFloat32s: got %d converted, want 4", n)
+	}
+	for i := 0; i < 4; i++ {
+		if dst[i] != src[i] {
+			t.Fatalf("value %d: got %v, want %v", i, dst[i], src[i])
+		}
+	}
+}
+
+func TestFromFloat32Table(t *testing.T) {
+	// Sweep float32s with every sign and exponent,
+	// and mantissas those make ties or carries.
+	mantissas := []uint32{0, 1, 0xFFF, 0x1000, 0x1FFF, 0x2000, 0x3000, 0x7FE000, 0x7FEFFF, 0x7FF000, 0x7FFFFF}
+	for se := uint32(0); se < 1<<9; se++ {
+		for _, m := range mantissas {
+			i := se<<23 | m
+			got := FromFloat32(math.Float32frombits(i))
+			want := fromFloat32Bits(i)
+			if got != want {
+				t.Fatalf("FromFloat32(%#08x): got %#04x, want %#04x", i, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkHalf(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		half(uint16(i))
+	}
+}
+
+func BenchmarkHalfFloat32(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Half(i).Float32()
+	}
+}
+
+func BenchmarkUint16sToFloat32s(b *testing.B) {
+	src := make([]uint16, 4096)
+	for i := range src {
+		src[i] = uint16(i * 16)
+	}
+	dst := make([]float32, len(src))
+	b.SetBytes(int64(2 * len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		uint16sToFloat32s(dst, src)
+	}
+}
+
+func BenchmarkHalfLoop(b *testing.B) {
+	src := make([]uint16, 4096)
+	for i := range src {
+		src[i] = uint16(i * 16)
+	}
+	dst := make([]float32, len(src))
+	b.SetBytes(int64(2 * len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, h := range src {
+			dst[j] = half(h)
+		}
+	}
+}
+
+func BenchmarkFromFloat32(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		FromFloat32(float32(i&0xFFFF) / 256)
+	}
+}
+
+func BenchmarkFromFloat32Bits(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		fromFloat32Bits(math.Float32bits(float32(i&0xFFFF) / 256))
+	}
+}
+
+func BenchmarkFloat32sToUint16s(b *testing.B) {
+	src := make([]float32, 4096)
+	for i := range src {
+		src[i] = float32(i) / 100
+	}
+	dst := make([]uint16, len(src))
+	b.SetBytes(int64(4 * len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		float32sToUint16s(dst, src)
+	}
+}
@@ -0,0 +1,390 @@
+package exr
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// Header is a set of attributes that describes a part of an exr image.
+// It is keyed by attribute names.
+type Header map[string]attribute
+
+// Names returns names of the attributes in the header, in sorted order.
+func (h Header) Names() []string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Attribute returns type name and raw value of the named attribute.
+// ok is false if the header doesn't have the attribute.
+func (h Header) Attribute(name string) (typ string, value []byte, ok bool) {
+	attr, ok := h[name]
+	if !ok {
+		return "", nil, false
+	}
+	return attr.typ, attr.value, true
+}
+
+// SetAttribute sets the named attribute with it's type name and raw value.
+// It could be used to set custom attributes.
+func (h Header) SetAttribute(name, typ string, value []byte) {
+	h[name] = attribute{
+		name:  name,
+		typ:   typ,
+		size:  len(value),
+		value: value,
+	}
+}
+
+// Delete deletes the named attribute from the header.
+func (h Header) Delete(name string) {
+	delete(h, name)
+}
+
+// SetString sets a string attribute.
+func (h Header) SetString(name, v string) {
+	h.SetAttribute(name, "string", []byte(v))
+}
+
+// SetInt sets an int attribute.
+func (h Header) SetInt(name string, v int32) {
+	b := make([]byte, 4)
+	parse.PutUint32(b, uint32(v))
+	h.SetAttribute(name, "int", b)
+}
+
+// SetFloat sets a float attribute.
+func (h Header) SetFloat(name string, v float32) {
+	b := make([]byte, 4)
+	parse.PutUint32(b, math.Float32bits(v))
+	h.SetAttribute(name, "float", b)
+}
+
+// copy returns a copy of the header.
+func (h Header) copy() Header {
+	c := make(Header, len(h))
+	for name, attr := range h {
+		c[name] = attr
+	}
+	return c
+}
+
+// layoutAttributes are attributes that decide how chunks are stored in a file.
+// Modifying them requires re-encoding of the chunks.
+var layoutAttributes = []string{
+	"channels",
+	"chunkCount",
+	"compression",
+	"dataWindow",
+	"lineOrder",
+	"tiles",
+	"type",
+}
+
+// hasLongName reports whether the header has an attribute or a channel
+// those name is longer than 31 bytes.
+func (h Header) hasLongName() bool {
+	for _, attr := range h {
+		if len(attr.name) > 31 || len(attr.typ) > 31 {
+			return true
+		}
+	}
+	if attr, ok := h["channels"]; ok {
+		chans, _ := chlistFromBytes(attr.value)
+		for _, ch := range chans {
+			if len(ch.name) > 31 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DecodeHeader reads headers of parts in an exr image.
+// Single part image always have one header.
+func DecodeHeader(path string) ([]Header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	vf, err := readVersion(r)
+	if err != nil {
+		return nil, err
+	}
+	return readHeaders(r, vf, nil)
+}
+
+// RewriteHeaders reads an exr image from src, let edit modify header of each part,
+// then writes the image to dst with the modified headers.
+//
+// Compressed chunks are copied untouched. Because the chunks are moved
+// by the difference of the header lengths, offset tables are recomputed.
+// Missing chunks (those offsets are 0) are kept as missing.
+//
+// edit is not allowed to modify attributes that decide the chunk layout,
+// such as channels, compression, dataWindow or tiles.
+//
+// src is checked with DefaultLimits. When src is an io.Seeker, such as *os.File,
+// offset tables are also checked with it's size before they are read.
+func RewriteHeaders(dst io.Writer, src io.Reader, edit func(part int, h Header) error) error {
+	l := &DefaultLimits
+	size := readerSize(src)
+	r := bufio.NewReader(src)
+	vf, err := readVersion(r)
+	if err != nil {
+		return err
+	}
+	headers, err := readHeaders(r, vf, l)
+	if err != nil {
+		return err
+	}
+	offsets, _, err := readOffsetTables(r, vf, headers, size, l)
+	if err != nil {
+		return err
+	}
+	oldLen := len(headersToBytes(vf, headers))
+
+	for i, h := range headers {
+		orig := h.copy()
+		if err := edit(i, h); err != nil {
+			return err
+		}
+		for _, name := range layoutAttributes {
+			a, aok := orig[name]
+			b, bok := h[name]
+			if aok != bok || a.typ != b.typ || !bytes.Equal(a.value, b.value) {
+				return UnsupportedError(fmt.Sprintf("rewrite %q attribute without re-encoding the chunks", name))
+			}
+		}
+		if h.hasLongName() {
+			vf.longName = true
+		}
+	}
+	if err := validateHeaders(vf, headers); err != nil {
+		return err
+	}
+	newLen := len(headersToBytes(vf, headers))
+
+	delta := int64(newLen - oldLen)
+	for _, offs := range offsets {
+		for i, o := range offs {
+			if o == 0 {
+				continue
+			}
+			offs[i] = uint64(int64(o) + delta)
+		}
+	}
+
+	w := bufio.NewWriter(dst)
+	if _, err := w.Write(versionToBytes(vf)); err != nil {
+		return err
+	}
+	if _, err := w.Write(headersToBytes(vf, headers)); err != nil {
+		return err
+	}
+	for _, offs := range offsets {
+		if _, err := w.Write(offsetsToBytes(offs)); err != nil {
+			return err
+		}
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// chunkCount returns number of chunks in a part.
+// It is also the length of the offset table of the part.
+func chunkCount(vf VersionField, h Header) (int, error) {
+	if attr, ok := h["chunkCount"]; ok {
+		n, err := intFromBytes(attr.value)
+		if err != nil {
+			return 0, err
+		}
+		if n < 0 {
+			return 0, FormatError(fmt.Sprintf("negative chunk count: %d", n))
+		}
+		return int(n), nil
+	}
+	dataWindowAttr, ok := h["dataWindow"]
+	if !ok {
+		return 0, FormatError("header does not have 'dataWindow' attribute")
+	}
+	dataWindow, err := box2iFromBytes(dataWindowAttr.value)
+	if err != nil {
+		return 0, err
+	}
+	if vf.tiled {
+		tilesAttr, ok := h["tiles"]
+		if !ok {
+			return 0, FormatError("header does not have 'tiles' attribute")
+		}
+		t, err := tiledescFromBytes(tilesAttr.value)
+		if err != nil {
+			return 0, err
+		}
+		return numTiles(t, dataWindow), nil
+	}
+	compressionAttr, ok := h["compression"]
+	if !ok {
+		return 0, FormatError("header does not have 'compression' attribute")
+	}
+	comp, err := compressionFromBytes(compressionAttr.value)
+	if err != nil {
+		return 0, err
+	}
+	blockLines, ok := numLinesPerBlock[comp]
+	if !ok {
+		return 0, FormatError(fmt.Sprintf("unknown compression: %d", comp))
+	}
+	nLines := int(dataWindow.yMax) - int(dataWindow.yMin) + 1
+	return (nLines + blockLines - 1) / blockLines, nil
+}
+
+// readerSize returns the number of bytes from the current position of r to it's end,
+// when r is an io.Seeker such as *os.File. Otherwise, it returns -1.
+func readerSize(r io.Reader) int64 {
+	s, ok := r.(io.Seeker)
+	if !ok {
+		return -1
+	}
+	cur, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1
+	}
+	if _, err := s.Seek(cur, io.SeekStart); err != nil {
+		return -1
+	}
+	return end - cur
+}
+
+// readOffsetTables reads offset tables of the parts, those follow the headers.
+// size is the size of the image in bytes, or -1 when it is unknown.
+// Each part is checked with l and the size before it's table is allocated.
+// It also returns the total size of the tables in bytes.
+func readOffsetTables(r *bufio.Reader, vf VersionField, headers []Header, size int64, l *Limits) ([][]uint64, int64, error) {
+	// remain is the number of bytes after the headers.
+	remain := size - int64(8+len(headersToBytes(vf, headers)))
+	offsets := make([][]uint64, len(headers))
+	var total int64
+	for i, h := range headers {
+		if err := l.checkHeader(h); err != nil {
+			return nil, 0, err
+		}
+		n, err := chunkCount(vf, h)
+		if err != nil {
+			return nil, 0, err
+		}
+		total += 8 * int64(n)
+		if size >= 0 && total > remain {
+			return nil, 0, FormatError(fmt.Sprintf("offset tables need %d bytes, but the file has %d bytes after the headers", total, remain))
+		}
+		if err := l.checkAllocation(total); err != nil {
+			return nil, 0, err
+		}
+		offsets[i], err = readOffsets(r, n)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return offsets, total, nil
+}
+
+// readOffsets reads an offset table that has n offsets.
+// The table is read in pieces of at most offsetsPerRead offsets,
+// so memory for a broken n isn't allocated before the offsets are read.
+func readOffsets(r io.Reader, n int) ([]uint64, error) {
+	const offsetsPerRead = 1 << 16
+	m := n
+	if m > offsetsPerRead {
+		m = offsetsPerRead
+	}
+	offsets := make([]uint64, 0, m)
+	b := make([]byte, 8*m)
+	for len(offsets) < n {
+		if m > n-len(offsets) {
+			m = n - len(offsets)
+		}
+		if _, err := io.ReadFull(r, b[:8*m]); err != nil {
+			return nil, truncated(err, "offset table")
+		}
+		for i := 0; i < m; i++ {
+			offsets = append(offsets, parse.Uint64(b[8*i:]))
+		}
+	}
+	return offsets, nil
+}
+
+func offsetsToBytes(offsets []uint64) []byte {
+	b := make([]byte, 8*len(offsets))
+	for i, o := range offsets {
+		parse.PutUint64(b[8*i:], o)
+	}
+	return b
+}
+
+// versionToBytes returns the magic number and the version field as bytes.
+func versionToBytes(vf VersionField) []byte {
+	v := uint32(vf.version)
+	if vf.tiled {
+		v |= 0x200
+	}
+	if vf.longName {
+		v |= 0x400
+	}
+	if vf.deep {
+		v |= 0x800
+	}
+	if vf.multiPart {
+		v |= 0x1000
+	}
+	b := make([]byte, 8)
+	parse.PutUint32(b[:4], uint32(MagicNumber))
+	parse.PutUint32(b[4:], v)
+	return b
+}
+
+// headersToBytes returns headers of all parts as bytes.
+// Attributes of a header are sorted by their names.
+func headersToBytes(vf VersionField, headers []Header) []byte {
+	buf := new(bytes.Buffer)
+	for _, h := range headers {
+		for _, name := range h.Names() {
+			buf.Write(attributeToBytes(h[name]))
+		}
+		buf.WriteByte(0x00)
+	}
+	if vf.multiPart {
+		// An empty header indicates end of the headers.
+		buf.WriteByte(0x00)
+	}
+	return buf.Bytes()
+}
+
+func attributeToBytes(attr attribute) []byte {
+	b := make([]byte, 0, len(attr.name)+len(attr.typ)+6+len(attr.value))
+	b = append(b, attr.name...)
+	b = append(b, 0x00)
+	b = append(b, attr.typ...)
+	b = append(b, 0x00)
+	size := make([]byte, 4)
+	parse.PutUint32(size, uint32(len(attr.value)))
+	b = append(b, size...)
+	b = append(b, attr.value...)
+	return b
+}
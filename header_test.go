@@ -0,0 +1,171 @@
+package exr
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// readChunks reads all chunks of an exr image, using it's offset tables.
+func readChunks(t *testing.T, data []byte) ([]Header, [][]byte) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	vf, err := readVersion(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, err := readHeaders(r, vf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := make([][]byte, 0)
+	for _, h := range headers {
+		n, err := chunkCount(vf, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets, err := readOffsets(r, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, o := range offsets {
+			// compare only heading bytes of chunks, it's enough to check the position.
+			chunks = append(chunks, data[o:o+16])
+		}
+	}
+	return headers, chunks
+}
+
+func TestRewriteHeaders(t *testing.T) {
+	cases := []string{
+		"image/scanline.exr",
+		"image/multipart.exr",
+	}
+	for _, c := range cases {
+		data, err := ioutil.ReadFile(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, wantChunks := readChunks(t, data)
+
+		out := new(bytes.Buffer)
+		err = RewriteHeaders(out, bytes.NewReader(data), func(part int, h Header) error {
+			h.SetString("owner", "coldmine")
+			h.SetString("comments", "rewritten header")
+			h.SetFloat("a.custom.attribute.that.has.a.long.name", 1)
+			tc, err := ParseTimecode("01:02:03:04")
+			if err != nil {
+				return err
+			}
+			return h.SetTimeCode(tc)
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", c, err)
+		}
+		headers, gotChunks := readChunks(t, out.Bytes())
+		if out.Bytes()[5]&0x04 == 0 {
+			t.Fatalf("%s: long name bit should be set", c)
+		}
+		for i, h := range headers {
+			_, owner, _ := h.Attribute("owner")
+			if string(owner) != "coldmine" {
+				t.Fatalf("%s: part %d: owner: got %q, want %q", c, i, owner, "coldmine")
+			}
+			_, tc, _ := h.Attribute("timeCode")
+			got, err := timecodeFromBytes(tc)
+			if err != nil {
+				t.Fatalf("%s: part %d: timeCode: %v", c, i, err)
+			}
+			if got.timeAndFlags != 0x01020304 {
+				t.Fatalf("%s: part %d: timeCode: got %x, want %x", c, i, got.timeAndFlags, 0x01020304)
+			}
+		}
+		if len(gotChunks) != len(wantChunks) {
+			t.Fatalf("%s: number of chunks: got %d, want %d", c, len(gotChunks), len(wantChunks))
+		}
+		for i := range gotChunks {
+			if !bytes.Equal(gotChunks[i], wantChunks[i]) {
+				t.Fatalf("%s: chunk %d moved to wrong offset", c, i)
+			}
+		}
+	}
+}
+
+func TestRewriteHeadersLayoutAttribute(t *testing.T) {
+	data, err := ioutil.ReadFile("image/scanline.exr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = RewriteHeaders(ioutil.Discard, bytes.NewReader(data), func(part int, h Header) error {
+		h.Delete("compression")
+		return nil
+	})
+	if _, ok := err.(UnsupportedError); !ok {
+		t.Fatalf("modifying compression should return UnsupportedError, got %v", err)
+	}
+}
+
+func TestReadOffsets(t *testing.T) {
+	// The table is longer than a piece of reading.
+	want := make([]uint64, 1<<16+3)
+	for i := range want {
+		want[i] = uint64(i) * 0x0101010101
+	}
+	b := offsetsToBytes(want)
+	got, err := readOffsets(bytes.NewReader(b), len(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d offsets, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("offset %d: got %#x, want %#x", i, got[i], want[i])
+		}
+	}
+	if _, err := readOffsets(bytes.NewReader(b[:len(b)-1]), len(want)); err == nil {
+		t.Fatalf("truncated table: want an error")
+	}
+}
+
+func TestRewriteHeadersSize(t *testing.T) {
+	valid := encodeBytes(t, lineOrderImage(image.Rect(0, 0, 2, 2)), nil)
+	r := bufio.NewReader(bytes.NewReader(valid))
+	vf, err := readVersion(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, err := readHeaders(r, vf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 65536 lines need an offset table of 512 KiB, that the file doesn't have.
+	h := headers[0]
+	h.SetAttribute("dataWindow", "box2i", box2iToBytes(box2i{0, 0, 1, 1<<16 - 1}))
+	b := append(versionToBytes(vf), headersToBytes(vf, []Header{h})...)
+	b = append(b, make([]byte, 64)...)
+	edit := func(part int, h Header) error { return nil }
+
+	err = RewriteHeaders(ioutil.Discard, bytes.NewReader(b), edit)
+	if _, ok := err.(FormatError); !ok || !strings.Contains(err.Error(), "after the headers") {
+		t.Fatalf("seekable source: got error %v, want FormatError of the file size", err)
+	}
+	// Without the size, the table is read until the end of the data.
+	err = RewriteHeaders(ioutil.Discard, struct{ io.Reader }{bytes.NewReader(b)}, edit)
+	if _, ok := err.(FormatError); !ok {
+		t.Fatalf("unseekable source: got error %v, want FormatError", err)
+	}
+
+	sr := bytes.NewReader(b)
+	sr.Seek(10, io.SeekStart)
+	if got, want := readerSize(sr), int64(len(b)-10); got != want {
+		t.Fatalf("readerSize: got %d, want %d", got, want)
+	}
+	if n, _ := sr.Seek(0, io.SeekCurrent); n != 10 {
+		t.Fatalf("readerSize moved the position to %d", n)
+	}
+}
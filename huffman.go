@@ -33,12 +33,15 @@ func huffmanCodeLength(pack uint64) int {
 // see `Code Construction` part of http://www.compressconsult.com/huffman/
 //
 // packs should only having the length parts (lower 6 bits) when given.
-// It will assign their codes using the lengths.
-func huffmanBuildCanonicalCodes(packs []uint64) {
+// It will assign their codes using the lengths, those should not be longer than 58.
+func huffmanBuildCanonicalCodes(packs []uint64) error {
 	// check how many codes are exist in each length.
 	freq := make([]uint64, 59)
 	for i := range packs {
 		l := packs[i]
+		if l >= uint64(len(freq)) {
+			return FormatError(fmt.Sprintf("huffman code length %d is longer than 58", l))
+		}
 		freq[l]++
 	}
 
@@ -53,14 +56,12 @@ func huffmanBuildCanonicalCodes(packs []uint64) {
 	// assign codes to packs
 	for i := range packs {
 		l := int(packs[i])
-		if l >= 1<<6 {
-			panic("length should not bigger or equal than 1 << 6")
-		}
 		if l > 0 {
 			packs[i] = (startCode[l] << 6) | uint64(l)
 			startCode[l]++
 		}
 	}
+	return nil
 }
 
 func huffmanCountFrequencies(raw []byte) []int {
@@ -78,37 +79,41 @@ type indexHeap struct {
 	value func(d int) int
 }
 
-func newIndexHeap(idx []int, value func(d int) int) indexHeap {
-	return indexHeap{
+func newIndexHeap(idx []int, value func(d int) int) *indexHeap {
+	return &indexHeap{
 		idx:   idx,
 		value: value,
 	}
 }
 
-func (h indexHeap) Len() int {
+func (h *indexHeap) Len() int {
 	return len(h.idx)
 }
 
-func (h indexHeap) Less(i, j int) bool {
+func (h *indexHeap) Less(i, j int) bool {
 	return h.value(h.idx[i]) < h.value(h.idx[j])
 }
 
-func (h indexHeap) Swap(i, j int) {
+func (h *indexHeap) Swap(i, j int) {
 	h.idx[i], h.idx[j] = h.idx[j], h.idx[i]
 }
 
-func (h indexHeap) Push(v interface{}) {
+func (h *indexHeap) Push(v interface{}) {
 	h.idx = append(h.idx, v.(int))
 }
 
-func (h indexHeap) Pop() interface{} {
+func (h *indexHeap) Pop() interface{} {
 	n := len(h.idx)
 	v := h.idx[n-1]
 	h.idx = h.idx[:n-1]
 	return v
 }
 
-func huffmanBuildEncodingTable(freq []int) ([]uint64, int, int) {
+// huffmanBuildEncodingTable builds huffman codes of data, from their frequencies.
+// freq should have at least one non-zero frequency. It is modified while building.
+// It returns the codes, and the range of data those have codes.
+// The last one, dMax, is a pseudo data for run length encoding.
+func huffmanBuildEncodingTable(freq []int) ([]uint64, int, int, error) {
 	// get data those frequency is non-zero.
 	data := make([]int, 0, HUF_ENCSIZE)
 	for d := 0; d < HUF_ENCSIZE; d++ {
@@ -132,6 +137,7 @@ func huffmanBuildEncodingTable(freq []int) ([]uint64, int, int) {
 	// add a pseudo symbol for run-length encoding.
 	symbol := data[len(data)-1] + 1
 	freq[symbol] = 1
+	hlink[symbol] = symbol
 	data = append(data, symbol)
 
 	// get min and max data before they are mixed by heap.
@@ -183,8 +189,10 @@ func huffmanBuildEncodingTable(freq []int) ([]uint64, int, int) {
 
 	// we've done calculating code length for each data.
 	// assign canonical codes to the lengths.
-	huffmanBuildCanonicalCodes(packs)
-	return packs, dMin, dMax
+	if err := huffmanBuildCanonicalCodes(packs); err != nil {
+		return nil, 0, 0, err
+	}
+	return packs, dMin, dMax, nil
 }
 
 // hdec is a decoding table for efficient huffman decoding.
@@ -213,19 +221,20 @@ type hdec []struct {
 }
 
 // huffmanBuildDecodingTable returns a decoding table to decode huffman codes.
-func huffmanBuildDecodingTable(packs []uint64, dMin, dMax int) hdec {
+// It returns a FormatError when the codes are not decodable.
+func huffmanBuildDecodingTable(packs []uint64, dMin, dMax int) (hdec, error) {
 	dec := make(hdec, HUF_DECSIZE)
 	for d := dMin; d <= dMax; d++ {
 		c := huffmanCode(packs[d])
 		l := huffmanCodeLength(packs[d])
 		if c>>l != 0 {
-			panic("code didn't match to it's length")
+			return nil, FormatError(fmt.Sprintf("huffman code of %d doesn't match to it's length %d", d, l))
 		}
 		if l > HUF_DECBITS {
 			// long code
 			i := c >> (l - HUF_DECBITS)
 			if dec[i].len != 0 {
-				panic("already occupied by short code")
+				return nil, FormatError(fmt.Sprintf("huffman code of %d is already occupied by a short code", d))
 			}
 			dec[i].lits = append(dec[i].lits, d)
 		} else if l != 0 {
@@ -235,10 +244,10 @@ func huffmanBuildDecodingTable(packs []uint64, dMin, dMax int) hdec {
 			n := uint64(1) << (HUF_DECBITS - l)
 			for n > 0 {
 				if dec[i].len != 0 {
-					panic("already been stored")
+					return nil, FormatError(fmt.Sprintf("huffman code of %d is already occupied by a short code", d))
 				}
 				if len(dec[i].lits) != 0 {
-					panic("already occupied by long code")
+					return nil, FormatError(fmt.Sprintf("huffman code of %d is already occupied by a long code", d))
 				}
 				dec[i].len = l
 				dec[i].lit = d
@@ -247,57 +256,69 @@ func huffmanBuildDecodingTable(packs []uint64, dMin, dMax int) hdec {
 			}
 		}
 	}
-	return dec
+	return dec, nil
 }
 
-// huffmanPackEncodingTable encodes input packs to bits.
+// huffmanPackEncodingTable encodes code lengths of packs from dMin to dMax to bits.
 // Note that bits is []byte type, but grouped in 6 bits usually,
 // except when containing 6+ zeros. (6 + 8 bits)
-func huffmanPackEncodingTable(packs []uint64, iMin, iMax int) ([]byte, int) {
-	w := newBitWriter(len(packs) * 64)
-	for i := iMin; i < iMax; i++ {
-		l := huffmanCodeLength(packs[uint64(i)])
-		if l != 0 {
-			packs = append(packs, uint64(l))
-			continue
-		}
-		// zero
-		n := 1
-		// compress continuous zeros
-		// n  | huffman code length
-		// ---|----------------------
-		// 1  | 0
-		// 2  | 59
-		// 3  | 60
-		// 4  | 61
-		// 5  | 62
-		// 6+ | 63, n-6  (6 + 8 bits)
-		for i < iMax && n < (255+6) {
-			if huffmanCodeLength(packs[uint64(i)]) != 0 {
-				break
+// It returns the bytes and number of bits in them.
+func huffmanPackEncodingTable(packs []uint64, dMin, dMax int) ([]byte, int, error) {
+	w := newBitWriter((dMax - dMin + 1) * 6)
+	for d := dMin; d <= dMax; d++ {
+		l := huffmanCodeLength(packs[d])
+		if l == 0 {
+			// compress continuous zeros
+			// n  | huffman code length
+			// ---|----------------------
+			// 1  | 0
+			// 2  | 59
+			// 3  | 60
+			// 4  | 61
+			// 5  | 62
+			// 6+ | 63, n-6  (6 + 8 bits)
+			n := 1
+			for d < dMax && n < (255+6) {
+				if huffmanCodeLength(packs[d+1]) != 0 {
+					break
+				}
+				d++
+				n++
+			}
+			if n >= 6 {
+				if err := w.Write(6, bitsToBytes(6, 63)); err != nil {
+					return nil, 0, err
+				}
+				if err := w.Write(8, bitsToBytes(8, uint64(n-6))); err != nil {
+					return nil, 0, err
+				}
+				continue
+			}
+			if n >= 2 {
+				if err := w.Write(6, bitsToBytes(6, uint64(59+n-2))); err != nil {
+					return nil, 0, err
+				}
+				continue
 			}
-			i++
-			n++
 		}
-		if n == 1 {
-			w.Write(6, []byte{0})
-		} else if n <= 5 {
-			w.Write(6, []byte{byte(n + 57)})
-		} else {
-			w.Write(6, []byte{63})
-			w.Write(8, []byte{byte(n - 6)})
+		if err := w.Write(6, bitsToBytes(6, uint64(l))); err != nil {
+			return nil, 0, err
 		}
 	}
-	return w.Data(), w.Index()
+	return w.Data()[:(w.Index()+7)/8], w.Index(), nil
 }
 
 // huffmanUnpackEncodingTable returns packs from the bits that contains length info.
 // Note that bits is []byte type, but grouped in 6 bits usually,
 // except when containing 6+ zeros. (6 + 8 bits)
-func huffmanUnpackEncodingTable(r *bitReader, dMin, dMax int) []uint64 {
+func huffmanUnpackEncodingTable(r *bitReader, dMin, dMax int) ([]uint64, error) {
 	packs := make([]uint64, HUF_ENCSIZE)
 	for d := dMin; d <= dMax; d++ {
-		l := int(r.Read(6)[0] >> 2)
+		b, err := r.Read(6)
+		if err != nil {
+			return nil, err
+		}
+		l := int(b[0] >> 2)
 		packs[d] = uint64(l)
 		// decompress continuous zeros
 		// n  | huffman code length
@@ -311,10 +332,17 @@ func huffmanUnpackEncodingTable(r *bitReader, dMin, dMax int) []uint64 {
 		if l >= 59 {
 			var n int
 			if l == 63 {
-				n = int(r.Read(8)[0]) + 6
+				b, err := r.Read(8)
+				if err != nil {
+					return nil, err
+				}
+				n = int(b[0]) + 6
 			} else {
 				n = l - 59 + 2
 			}
+			if d+n > dMax+1 {
+				return nil, FormatError(fmt.Sprintf("huffman encoding table has %d zeros after %d, more than the table can have", n, d))
+			}
 			for n != 0 {
 				packs[d] = 0
 				d++
@@ -323,61 +351,146 @@ func huffmanUnpackEncodingTable(r *bitReader, dMin, dMax int) []uint64 {
 			d--
 		}
 	}
-	huffmanBuildCanonicalCodes(packs)
-	return packs
+	if err := huffmanBuildCanonicalCodes(packs); err != nil {
+		return nil, err
+	}
+	return packs, nil
 }
 
-func uint64ToBytes(n uint64) []byte {
+// bitsToBytes returns the lower n bits of v in the form that bitWriter writes,
+// that is left-aligned bytes.
+func bitsToBytes(n int, v uint64) []byte {
 	bs := make([]byte, 8)
-	parse.PutUint64(bs, n)
+	binary.BigEndian.PutUint64(bs, v<<(64-uint(n)))
 	return bs
 }
 
-// writeCode writes codes to bitWriter w.
-// It uses run length encoding when they are shorter than normal encoding.
-func writeCode(w *bitWriter, p, runp uint64, run uint8) {
-	n := huffmanCodeLength(p) * int(run)
-	nrun := huffmanCodeLength(p) + huffmanCodeLength(runp) + 8
-	if nrun < n {
-		w.Write(huffmanCodeLength(p), uint64ToBytes(huffmanCode(p)))
-		w.Write(huffmanCodeLength(runp), uint64ToBytes(huffmanCode(runp)))
-		w.Write(8, []byte{run})
-	} else {
-		for i := 0; i < int(run); i++ {
-			w.Write(huffmanCodeLength(p), uint64ToBytes(huffmanCode(p)))
-		}
-	}
-}
-
-// huffmanEncode encodes packs to output bytes.
-func huffmanEncode(raw []byte, packs []uint64, runCode int) ([]byte, int) {
+// huffmanRuns calls code for each run of the same data in raw, that is
+// the data and number of it's repetitions after the first one, up to 255.
+// It stops and returns the error, when code returns an error.
+func huffmanRuns(raw []byte, code func(d uint16, run uint8) error) error {
 	r := newByteReader(binary.LittleEndian, raw)
-	w := newBitWriter(len(packs) * 8)
-	// run length encoding
 	var run uint8
 	prev := r.Uint16()
 	for i := 2; i < len(raw); i += 2 {
 		c := r.Uint16()
 		if c == prev && run < 255 {
 			run++
-		} else {
-			writeCode(w, packs[prev], packs[uint64(runCode)], run)
-			run = 0
+			continue
+		}
+		if err := code(prev, run); err != nil {
+			return err
 		}
+		run = 0
 		prev = c
 	}
-	writeCode(w, packs[prev], packs[uint64(runCode)], run)
-	return w.Data(), w.Index()
+	return code(prev, run)
+}
+
+// huffmanRunBits returns number of bits to encode a run of p code.
+// It uses run length encoding when it is shorter than repeating the code.
+func huffmanRunBits(p, runp uint64, run uint8) (bits int, useRun bool) {
+	n := huffmanCodeLength(p) * (int(run) + 1)
+	nrun := huffmanCodeLength(p) + huffmanCodeLength(runp) + 8
+	if nrun < n {
+		return nrun, true
+	}
+	return n, false
+}
+
+// writeCode writes codes of a run to bitWriter w.
+// run is number of repetitions after the first code.
+func writeCode(w *bitWriter, p, runp uint64, run uint8) error {
+	code := func(p uint64) error {
+		l := huffmanCodeLength(p)
+		return w.Write(l, bitsToBytes(l, huffmanCode(p)))
+	}
+	if _, useRun := huffmanRunBits(p, runp, run); useRun {
+		if err := code(p); err != nil {
+			return err
+		}
+		if err := code(runp); err != nil {
+			return err
+		}
+		return w.Write(8, []byte{run})
+	}
+	for i := 0; i <= int(run); i++ {
+		if err := code(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// huffmanEncode encodes raw data with packs to output bytes.
+// It returns the bytes and number of bits in them.
+func huffmanEncode(raw []byte, packs []uint64, runCode int) ([]byte, int, error) {
+	runp := packs[runCode]
+	nBits := 0
+	huffmanRuns(raw, func(d uint16, run uint8) error {
+		n, _ := huffmanRunBits(packs[d], runp, run)
+		nBits += n
+		return nil
+	})
+	w := newBitWriter(nBits)
+	err := huffmanRuns(raw, func(d uint16, run uint8) error {
+		return writeCode(w, packs[d], runp, run)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return w.Data(), w.Index(), nil
 }
 
 // huffmanDecode decodes packs to output bytes.
-func huffmanDecode(block blockInfo, data []byte, nBits int, dec hdec, packs []uint64, runCode int) []byte {
-	raw := make([]byte, block.width*block.height*block.pixsize)
+// It returns a FormatError when data has an unknown code,
+// or the decoded data doesn't fit to the block.
+func huffmanDecode(block blockInfo, data []byte, nBits int, dec hdec, packs []uint64, runCode int) ([]byte, error) {
+	raw := make([]byte, block.rawSize())
 	w := newByteWriter(binary.LittleEndian, raw)
 	r := newBitReader(data, nBits) // nBits
 	c := uint64(0)
 	lc := 0
 	lastd := 0
+	overflow := FormatError("huffman decoded data is larger than the block")
+
+	// put writes decoded data d. For the run code, it reads number of repetitions
+	// from the next 8 bits, and repeats the last data.
+	put := func(d int) error {
+		if d != runCode {
+			if w.Remain() < 2 {
+				return overflow
+			}
+			w.Uint16(uint16(d))
+			lastd = d
+			return nil
+		}
+		if lc < 8 {
+			// some bits of the run length are already in c.
+			n := 8 - lc
+			b, err := r.Read(n)
+			if err != nil {
+				return err
+			}
+			c = c<<n | uint64(b[0]>>(8-n))
+			lc += n
+		}
+		lc -= 8
+		run := c >> lc
+		c = (c << (64 - lc)) >> (64 - lc)
+		if w.i == 0 {
+			return FormatError("huffman decoding: run length code before any data")
+		}
+		if int(run)*2 > w.Remain() {
+			return overflow
+		}
+		for run > 0 {
+			w.Uint16(uint16(lastd))
+			run--
+		}
+		return nil
+	}
+
 READ:
 	for {
 		// read until c is full or reader is run out of bits
@@ -391,10 +504,17 @@ READ:
 		nhead := nr % 8
 		if nhead != 0 {
 			nr -= nhead
-			c = (c << nhead) | uint64(r.Read(nhead)[0]>>(8-nhead))
+			b, err := r.Read(nhead)
+			if err != nil {
+				return nil, err
+			}
+			c = (c << nhead) | uint64(b[0]>>(8-nhead))
 			lc += nhead
 		}
-		bs := r.Read(nr)
+		bs, err := r.Read(nr)
+		if err != nil {
+			return nil, err
+		}
 		for _, b := range bs {
 			c = (c << 8) | uint64(b)
 			lc += 8
@@ -412,12 +532,12 @@ READ:
 				found := false
 				for _, lit := range pl.lits {
 					l = huffmanCodeLength(packs[lit])
-					if l > 64 {
-						panic("code length should not bigger than 64")
-					}
 					if l > lc {
-						continue READ
-						fmt.Println("continue read")
+						if r.Remain() > 0 {
+							continue READ
+						}
+						// the code is longer than the remaining bits.
+						continue
 					}
 					code := c >> (lc - l)
 					if huffmanCode(packs[lit]) == code {
@@ -427,72 +547,106 @@ READ:
 					}
 				}
 				if !found {
-					panic("long code not found")
+					return nil, FormatError("huffman decoding: unknown long code")
 				}
 			}
 			lc -= l
 			c = (c << (64 - lc)) >> (64 - lc)
-			if d == runCode {
-				if lc < 8 {
-					c = c<<8 | uint64(r.Read(8)[0])
-					lc += 8
-				}
-				lc -= 8
-				run := c >> lc
-				for run > 0 {
-					w.Uint16(uint16(lastd))
-					run--
-				}
-				c = (c << (64 - lc)) >> (64 - lc)
-			} else {
-				w.Uint16(uint16(d))
-				lastd = d
+			if err := put(d); err != nil {
+				return nil, err
 			}
 		}
 	}
-	if lc != 0 {
-		// TODO: handle it?
+	// the last bits, those are shorter than HUF_DECBITS, could have short codes.
+	if lc >= HUF_DECBITS {
+		return nil, FormatError("huffman decoding: truncated long code")
+	}
+	for lc > 0 {
+		pl := dec[(c<<(HUF_DECBITS-lc))&HUF_DECMASK]
+		if pl.len == 0 || pl.len > lc {
+			return nil, FormatError("huffman decoding: unknown code at the end of data")
+		}
+		lc -= pl.len
+		c = (c << (64 - lc)) >> (64 - lc)
+		if err := put(pl.lit); err != nil {
+			return nil, err
+		}
+	}
+	if w.Remain() != 0 {
+		return nil, FormatError(fmt.Sprintf("huffman decoded data has %d bytes, want %d", w.i, len(raw)))
 	}
-	return raw
+	return raw, nil
 }
 
 // huffmanCompress compress raw channel data.
-func huffmanCompress(block blockInfo, raw []byte) []byte {
-	compressed := make([]byte, len(raw))
-	w := newByteWriter(binary.LittleEndian, compressed)
+// Empty data is compressed to empty bytes.
+func huffmanCompress(block blockInfo, raw []byte) ([]byte, error) {
+	if len(raw) == 0 {
+		return []byte{}, nil
+	}
+	if len(raw)%2 != 0 {
+		return nil, FormatError(fmt.Sprintf("huffman: raw data should have even number of bytes, got %d", len(raw)))
+	}
 	freqs := huffmanCountFrequencies(raw)
-	packs, dMin, dMax := huffmanBuildEncodingTable(freqs)
-	packBytes, nBitsPack := huffmanPackEncodingTable(packs, dMin, dMax)
+	packs, dMin, dMax, err := huffmanBuildEncodingTable(freqs)
+	if err != nil {
+		return nil, err
+	}
+	packBytes, _, err := huffmanPackEncodingTable(packs, dMin, dMax)
+	if err != nil {
+		return nil, err
+	}
 	runCode := dMax
-	rawBytes, nBitsData := huffmanEncode(raw, packs, runCode)
+	rawBytes, nBitsData, err := huffmanEncode(raw, packs, runCode)
+	if err != nil {
+		return nil, err
+	}
+	compressed := make([]byte, 20+len(packBytes)+len(rawBytes))
+	w := newByteWriter(binary.LittleEndian, compressed)
 	w.Uint32(uint32(dMin))
 	w.Uint32(uint32(dMax))
-	w.Uint32(uint32(nBitsPack))
+	w.Uint32(uint32(len(packBytes))) // tableLength
 	w.Uint32(uint32(nBitsData))
 	w.Uint32(0) // compressed[16:20] is room for future extensions
-	for _, b := range packBytes {
-		w.Uint8(b)
-	}
-	for _, b := range rawBytes {
-		w.Uint8(b)
-	}
-	return compressed
+	w.Bytes(packBytes)
+	w.Bytes(rawBytes)
+	return compressed, nil
 }
 
-func huffmanDecompress(block blockInfo, compressed []byte) []byte {
+// huffmanDecompress decompresses huffman compressed data of a block.
+// It returns a FormatError when the data is corrupted.
+func huffmanDecompress(block blockInfo, compressed []byte) ([]byte, error) {
+	if len(compressed) == 0 && block.rawSize() == 0 {
+		return []byte{}, nil
+	}
+	if len(compressed) < 20 {
+		return nil, FormatError(fmt.Sprintf("huffman compressed data is too short: %d bytes", len(compressed)))
+	}
 	r := newByteReader(binary.LittleEndian, compressed)
 	dMin := int(r.Uint32())
 	dMax := int(r.Uint32())
 	_ = int(r.Uint32()) // tableLength
 	nBitsData := int(r.Uint32())
 	_ = r.Uint32() // compressed[16:20] is room for future extensions
+	if dMin < 0 || dMax >= HUF_ENCSIZE || dMin > dMax {
+		return nil, FormatError(fmt.Sprintf("invalid huffman data range [%d, %d]", dMin, dMax))
+	}
 
 	br := r.ToBitReader()
-	packs := huffmanUnpackEncodingTable(br, dMin, dMax)
+	packs, err := huffmanUnpackEncodingTable(br, dMin, dMax)
+	if err != nil {
+		return nil, err
+	}
 	r = br.ToByteReader(binary.LittleEndian)
 
-	dec := huffmanBuildDecodingTable(packs, dMin, dMax)
+	dec, err := huffmanBuildDecodingTable(packs, dMin, dMax)
+	if err != nil {
+		return nil, err
+	}
 
+	if nBitsData < 0 || (nBitsData+7)/8 > r.Remain() {
+		return nil, FormatError(fmt.Sprintf("huffman compressed data has %d bytes, want %d bits", r.Remain(), nBitsData))
+	}
 	data := r.Bytes((nBitsData + 7) / 8)
 	runCode := dMax
 	return huffmanDecode(block, data, nBitsData, dec, packs, runCode)
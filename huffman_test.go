@@ -1,6 +1,8 @@
 package exr
 
 import (
+	"bytes"
+	"encoding/binary"
 	"reflect"
 	"testing"
 )
@@ -40,3 +42,220 @@ func TestHuffmanBuildCanonicalCodes(t *testing.T) {
 		}
 	}
 }
+
+// huffmanSeed returns the block and huffman compressed data in the piz compressed data of pizSeed.
+func huffmanSeed(t testing.TB) (blockInfo, []byte) {
+	block, _, data := pizSeed(t)
+	minNonZero := int(binary.LittleEndian.Uint16(data[0:]))
+	maxNonZero := int(binary.LittleEndian.Uint16(data[2:]))
+	lcOffset := 4 + maxNonZero - minNonZero + 1
+	return block, data[lcOffset+4:]
+}
+
+func FuzzHuffmanDecompress(f *testing.F) {
+	block, data := huffmanSeed(f)
+	f.Add(data)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		raw, err := huffmanDecompress(block, data)
+		if err != nil {
+			if _, ok := err.(FormatError); !ok {
+				t.Fatalf("got %T error, want FormatError: %v", err, err)
+			}
+			return
+		}
+		if len(raw) != block.rawSize() {
+			t.Fatalf("decompressed data has %d bytes, want %d", len(raw), block.rawSize())
+		}
+	})
+}
+
+func FuzzHuffmanRoundTrip(f *testing.F) {
+	_, data := huffmanSeed(f)
+	f.Add(data)
+	f.Add([]byte{})
+	f.Add([]byte{1, 0})
+	f.Add(make([]byte, 1000))
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		raw = raw[:len(raw)/2*2]
+		block := fuzzBlock(PIZ_COMPRESSION, len(raw)/2, 1, 0, 1)
+		compressed, err := huffmanCompress(block, raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := huffmanDecompress(block, compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, raw) {
+			t.Fatalf("got %v, want %v", got, raw)
+		}
+	})
+}
+
+// huffmanBlock returns a block of one HALF channel, that has n values in a line.
+func huffmanBlock(n int) blockInfo {
+	return newBlockInfo(PIZ_COMPRESSION, chlist{{name: "A", pixelType: HALF, xSampling: 1, ySampling: 1}}, 0, 0, n, 1)
+}
+
+// uint16Bytes returns vs in the little endian form.
+func uint16Bytes(vs []uint16) []byte {
+	b := make([]byte, 2*len(vs))
+	for i, v := range vs {
+		binary.LittleEndian.PutUint16(b[2*i:], v)
+	}
+	return b
+}
+
+func TestHuffmanBuildEncodingTable(t *testing.T) {
+	freq := make([]int, HUF_ENCSIZE)
+	for i, f := range []int{1, 1, 2, 3, 5, 8, 13, 21, 34, 55, 89, 144, 233, 377, 610, 987, 1597, 2584, 4181, 6765} {
+		freq[100+3*i] = f
+	}
+	used := make([]bool, HUF_ENCSIZE)
+	for d, f := range freq {
+		used[d] = f != 0
+	}
+	packs, dMin, dMax, err := huffmanBuildEncodingTable(freq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dMin != 100 || dMax != 100+3*19+1 {
+		t.Fatalf("range: got [%d, %d], want [100, %d]", dMin, dMax, 100+3*19+1)
+	}
+	// Codes of the data and the run length code should be a complete prefix code,
+	// so sum of 2^-length is 1.
+	used[dMax] = true
+	var sum float64
+	for d := range packs {
+		l := huffmanCodeLength(packs[d])
+		if used[d] != (l != 0) {
+			t.Fatalf("data %d: used is %v, but code length is %d", d, used[d], l)
+		}
+		if l != 0 {
+			sum += 1 / float64(uint64(1)<<uint(l))
+		}
+	}
+	if sum != 1 {
+		t.Fatalf("sum of 2^-length: got %v, want 1", sum)
+	}
+}
+
+func TestHuffmanPackEncodingTable(t *testing.T) {
+	packs := make([]uint64, HUF_ENCSIZE)
+	lengths := []int{3, 0, 5, 0, 0, 7, 0, 0, 0, 0, 0, 2}
+	for i, l := range lengths {
+		packs[10+i] = uint64(l)
+	}
+	// runs of zeros longer than the maximum run in the packed form.
+	packs[10+len(lengths)+300] = 4
+	packs[10+len(lengths)+300+262] = 1
+	dMin, dMax := 10, 10+len(lengths)+300+262
+	b, nBits, err := huffmanPackEncodingTable(packs, dMin, dMax)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != (nBits+7)/8 {
+		t.Fatalf("packed table has %d bytes for %d bits", len(b), nBits)
+	}
+	got, err := huffmanUnpackEncodingTable(newBitReader(b, nBits), dMin, dMax)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for d := dMin; d <= dMax; d++ {
+		if huffmanCodeLength(got[d]) != huffmanCodeLength(packs[d]) {
+			t.Fatalf("code length of %d: got %d, want %d", d, huffmanCodeLength(got[d]), huffmanCodeLength(packs[d]))
+		}
+	}
+}
+
+func TestBitsToBytes(t *testing.T) {
+	cases := []struct {
+		n    int
+		v    uint64
+		want []byte
+	}{
+		{6, 0b101101, []byte{0b10110100}},
+		{8, 0xab, []byte{0xab}},
+		{12, 0xabc, []byte{0xab, 0xc0}},
+	}
+	for _, c := range cases {
+		w := newBitWriter(c.n)
+		if err := w.Write(c.n, bitsToBytes(c.n, c.v)); err != nil {
+			t.Fatal(err)
+		}
+		if got := w.Data()[:(c.n+7)/8]; !bytes.Equal(got, c.want) {
+			t.Fatalf("%d bits of %#x: got %08b, want %08b", c.n, c.v, got, c.want)
+		}
+	}
+}
+
+func TestHuffmanRoundTrip(t *testing.T) {
+	repeat := func(v uint16, n int) []uint16 {
+		vs := make([]uint16, n)
+		for i := range vs {
+			vs[i] = v
+		}
+		return vs
+	}
+	// fibonacci frequencies make codes longer than HUF_DECBITS.
+	var skewed []uint16
+	for i, f := range []int{1, 1, 2, 3, 5, 8, 13, 21, 34, 55, 89, 144, 233, 377, 610, 987, 1597, 2584, 4181, 6765} {
+		skewed = append(skewed, repeat(uint16(19-i), f)...)
+	}
+	for i := range skewed {
+		// spread repeated values, so they aren't encoded as runs.
+		j := (i * 7919) % len(skewed)
+		skewed[i], skewed[j] = skewed[j], skewed[i]
+	}
+	cases := []struct {
+		name string
+		data []uint16
+	}{
+		{"empty", nil},
+		{"single value", []uint16{7}},
+		{"shorter than the decoding table bits", []uint16{1, 2, 1}},
+		{"runs", append(append(repeat(3, 2), repeat(4, 3)...), repeat(3, 9)...)},
+		{"longer run than 255", append(repeat(9, 300), 1)},
+		{"run at the end", append([]uint16{1, 2, 3, 4, 5, 6, 7}, repeat(8, 40)...)},
+		{"long code at the end", append(skewed, 19)},
+		{"wide range", []uint16{0, 65535, 32768, 1, 65534}},
+	}
+	for _, c := range cases {
+		raw := uint16Bytes(c.data)
+		block := huffmanBlock(len(c.data))
+		compressed, err := huffmanCompress(block, raw)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if len(compressed) != 0 {
+			tableLength := int(binary.LittleEndian.Uint32(compressed[8:]))
+			nBits := int(binary.LittleEndian.Uint32(compressed[12:]))
+			if len(compressed) != 20+tableLength+(nBits+7)/8 {
+				t.Fatalf("%s: compressed data has %d bytes, want %d", c.name, len(compressed), 20+tableLength+(nBits+7)/8)
+			}
+		}
+		got, err := huffmanDecompress(block, compressed)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if !bytes.Equal(got, raw) {
+			t.Fatalf("%s: got %v, want %v", c.name, got, raw)
+		}
+	}
+}
+
+func TestHuffmanDecompressChunk(t *testing.T) {
+	// The last codes of the chunk are shorter than HUF_DECBITS,
+	// those are decoded after all bits are read.
+	block, data := pizChunk(t)
+	minNonZero := int(binary.LittleEndian.Uint16(data[0:]))
+	maxNonZero := int(binary.LittleEndian.Uint16(data[2:]))
+	lcOffset := 4 + maxNonZero - minNonZero + 1
+	raw, err := huffmanDecompress(block, data[lcOffset+4:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := binary.LittleEndian.Uint16(raw[len(raw)-2:]); v != 155 {
+		t.Fatalf("last value: got %d, want 155", v)
+	}
+}
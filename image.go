@@ -0,0 +1,219 @@
+package exr
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// Image is a decoded part of an exr image.
+//
+// It implements image.Image by interpreting R, G, B and A channels
+// (or Y, RY, BY and A channels of a luminance/chroma image),
+// with pixel values clamped in [0, 1].
+// Channels keep the original pixel values, which are not clamped.
+type Image struct {
+	// Header is the header of the part.
+	Header Header
+
+	// Rect is the data window of the part.
+	Rect image.Rectangle
+
+	// Channels have pixel values of each channel,
+	// in the order of the header's channel list.
+	Channels []*Channel
+}
+
+// Channel has pixel values of a channel.
+type Channel struct {
+	// Name is the name of the channel.
+	Name string
+
+	// Type is the pixel type of the channel. It is one of UINT, HALF or FLOAT.
+	Type pixelType
+
+	// PLinear is a hint that pixel values of the channel are perceptually linear.
+	PLinear bool
+
+	// XSampling and YSampling are sampling rates of the channel.
+	// They are 1 when the channel isn't subsampled.
+	XSampling int
+	YSampling int
+
+	// Rect is bounds of the channel, in it's native resolution.
+	// It is the same with bounds of the image, when the channel isn't subsampled.
+	Rect image.Rectangle
+
+	// Uint has pixel values of a UINT channel, such as object IDs.
+	// It is nil for HALF or FLOAT channels.
+	// Pixel values are stored line by line, from the top.
+	Uint []uint32
+
+	// Float has pixel values of a HALF or FLOAT channel, such as colors or depths.
+	// HALF values are converted to float32 without loss.
+	// It is nil for a UINT channel.
+	// Pixel values are stored line by line, from the top.
+	Float []float32
+}
+
+// newChannel returns a channel that could hold pixel values in rect (in image coordinate).
+// When the channel is subsampled, it holds only the samples in rect.
+func newChannel(ch channel, rect image.Rectangle) *Channel {
+	c := &Channel{
+		Name:      ch.name,
+		Type:      ch.pixelType,
+		PLinear:   ch.pLinear != 0,
+		XSampling: int(ch.xSampling),
+		YSampling: int(ch.ySampling),
+		Rect:      sampledRect(rect, int(ch.xSampling), int(ch.ySampling)),
+	}
+	n := c.Rect.Dx() * c.Rect.Dy()
+	if ch.pixelType == UINT {
+		c.Uint = make([]uint32, n)
+	} else {
+		c.Float = make([]float32, n)
+	}
+	return c
+}
+
+// PixOffset returns index of the pixel value at (x, y) in Uint or Float.
+// For a subsampled channel, (x, y) is in the channel's coordinate.
+func (c *Channel) PixOffset(x, y int) int {
+	return (y-c.Rect.Min.Y)*c.Rect.Dx() + (x - c.Rect.Min.X)
+}
+
+// FloatAt returns pixel value at (x, y) as a float32.
+// For a subsampled channel, (x, y) is in the channel's coordinate.
+// Pixel values of a UINT channel are converted to float32.
+// It returns 0 when (x, y) is out of bounds of the channel.
+func (c *Channel) FloatAt(x, y int) float32 {
+	if !(image.Point{x, y}.In(c.Rect)) {
+		return 0
+	}
+	i := c.PixOffset(x, y)
+	if c.Uint != nil {
+		return float32(c.Uint[i])
+	}
+	return c.Float[i]
+}
+
+// UintAt returns pixel value at (x, y) as a uint32.
+// For a subsampled channel, (x, y) is in the channel's coordinate.
+// Pixel values of a HALF or FLOAT channel are converted to uint32.
+// It returns 0 when (x, y) is out of bounds of the channel.
+func (c *Channel) UintAt(x, y int) uint32 {
+	if !(image.Point{x, y}.In(c.Rect)) {
+		return 0
+	}
+	i := c.PixOffset(x, y)
+	if c.Uint != nil {
+		return c.Uint[i]
+	}
+	return uint32(c.Float[i])
+}
+
+// channel returns the channel description of c, that is used in a header.
+func (c *Channel) channel() channel {
+	sx, sy := c.sampling()
+	ch := channel{
+		name:      c.Name,
+		pixelType: c.Type,
+		xSampling: int32(sx),
+		ySampling: int32(sy),
+	}
+	if c.PLinear {
+		ch.pLinear = 1
+	}
+	return ch
+}
+
+// Channel returns the named channel. It returns nil when the image doesn't have the channel.
+func (m *Image) Channel(name string) *Channel {
+	for _, c := range m.Channels {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// sortChannels sorts channels by their names, in the order of a channel list.
+func sortChannels(channels []*Channel) {
+	sort.SliceStable(channels, func(i, j int) bool {
+		return channels[i].Name < channels[j].Name
+	})
+}
+
+func (m *Image) ColorModel() color.Model {
+	return color.RGBA64Model
+}
+
+func (m *Image) Bounds() image.Rectangle {
+	return m.Rect
+}
+
+func (m *Image) At(x, y int) color.Color {
+	return m.RGBA64At(x, y)
+}
+
+// colorChannels are the channels that colors of an image are read from.
+// They are resolved once for sampling colors of many pixels.
+type colorChannels struct {
+	// r, g, b and a are R, G, B and A channels (or Y, RY, BY and A channels
+	// of a luminance/chroma image, that yw is the luminance weights of).
+	r, g, b, a *Channel
+	yc         bool
+	yw         [3]float32
+}
+
+// colorChannels returns the color channels of m.
+// They should be resolved again after Channels or the header of m are modified.
+func (m *Image) colorChannels() colorChannels {
+	cc := colorChannels{
+		a:  m.Channel("A"),
+		yc: m.isLuminanceChroma(),
+	}
+	if cc.yc {
+		cc.r, cc.g, cc.b = m.Channel("Y"), m.Channel("RY"), m.Channel("BY")
+		cc.yw = luminanceWeights(m.Header.Chromaticities())
+	} else {
+		cc.r, cc.g, cc.b = m.Channel("R"), m.Channel("G"), m.Channel("B")
+	}
+	return cc
+}
+
+// RGBA64At returns color at (x, y) from R, G, B and A channels.
+// Missing color channels are considered as 0, and missing alpha channel as 1.
+// Subsampled channels take the nearest sample on the upper left.
+//
+// Colors of a luminance/chroma image are converted from Y, RY and BY channels.
+func (m *Image) RGBA64At(x, y int) color.RGBA64 {
+	return m.colorChannels().rgba64At(x, y)
+}
+
+// rgba64At returns color at (x, y) like RGBA64At, from the channels.
+func (cc colorChannels) rgba64At(x, y int) color.RGBA64 {
+	sample := func(c *Channel, v float32) float32 {
+		if c != nil {
+			v = c.sampleAt(x, y)
+		}
+		return v
+	}
+	r, g, b := sample(cc.r, 0), sample(cc.g, 0), sample(cc.b, 0)
+	if cc.yc {
+		r, g, b = ycToRGB(cc.yw, r, g, b)
+	}
+	value := func(v float32) uint16 {
+		if v != v {
+			// NaN
+			v = 0
+		}
+		return uint16(clamp32(v, 0, 1)*0xFFFF + 0.5)
+	}
+	return color.RGBA64{
+		R: value(r),
+		G: value(g),
+		B: value(b),
+		A: value(sample(cc.a, 1)),
+	}
+}
@@ -0,0 +1,112 @@
+package exr
+
+import (
+	"image"
+	"sort"
+	"strings"
+)
+
+// Channels could be grouped into layers by dotted prefixes of their names.
+// For example, diffuse.R, diffuse.G and diffuse.B channels are R, G and B channels
+// of diffuse layer. Layers could be nested, such as left.specular.G.
+// Channels without a dot, such as R or Z, belong to the default layer,
+// those name is empty.
+
+// layerOf returns name of the layer that the named channel belongs to.
+func layerOf(name string) string {
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return ""
+	}
+	return name[:i]
+}
+
+// layerPrefix returns prefix of channel names in the layer.
+func layerPrefix(layer string) string {
+	if layer == "" {
+		return ""
+	}
+	return layer + "."
+}
+
+// Layers returns names of the layers that have channels directly, in sorted order.
+// The default layer has an empty name, and is included when
+// the image has channels without a dot in their names.
+func (m *Image) Layers() []string {
+	seen := make(map[string]bool)
+	var layers []string
+	for _, c := range m.Channels {
+		l := layerOf(c.Name)
+		if !seen[l] {
+			seen[l] = true
+			layers = append(layers, l)
+		}
+	}
+	sort.Strings(layers)
+	return layers
+}
+
+// Layer returns an image that has channels of the named layer,
+// those names don't have the layer prefix. For example, diffuse.R channel
+// of m becomes R channel of the diffuse layer. Channels of nested layers
+// are also included, so left.specular.G channel becomes specular.G channel of left layer.
+// For the default layer (""), it returns channels without a dot in their names.
+//
+// The returned image is an image.Image of the layer's R, G, B and A channels.
+// It shares the header and pixel values with m.
+// When m doesn't have the layer, it returns an image without channels.
+func (m *Image) Layer(name string) *Image {
+	l := &Image{
+		Header: m.Header,
+		Rect:   m.Rect,
+	}
+	prefix := layerPrefix(name)
+	for _, c := range m.Channels {
+		if name == "" {
+			if layerOf(c.Name) != "" {
+				continue
+			}
+		} else if !strings.HasPrefix(c.Name, prefix) {
+			continue
+		}
+		lc := *c
+		lc.Name = strings.TrimPrefix(c.Name, prefix)
+		l.Channels = append(l.Channels, &lc)
+	}
+	return l
+}
+
+// SetLayer sets channels of the named layer from l. Existing channels of the layer,
+// including channels of it's nested layers, are removed first.
+// Names of the new channels are prefixed with the layer name and a dot.
+//
+// When l is an *Image, it's channels are added with their own pixel types.
+// Otherwise, pixels of l are added as R, G, B and A channels of FLOAT type.
+// Pixels of l outside of bounds of m are dropped, and pixels of m outside of bounds of l are 0.
+// Pixel values are shared with l, when it has the same bounds with m.
+func (m *Image) SetLayer(name string, l image.Image) {
+	li, ok := l.(*Image)
+	if !ok {
+		li = rgbaImage(l, FLOAT)
+	}
+	li = li.Reframe(m.Rect)
+	prefix := layerPrefix(name)
+	channels := m.Channels[:0:0]
+	for _, c := range m.Channels {
+		if name == "" {
+			if layerOf(c.Name) == "" {
+				continue
+			}
+		} else if strings.HasPrefix(c.Name, prefix) {
+			continue
+		}
+		channels = append(channels, c)
+	}
+	for _, c := range li.Channels {
+		nc := *c
+		nc.Name = prefix + c.Name
+		channels = append(channels, &nc)
+	}
+	sortChannels(channels)
+	m.Channels = channels
+}
@@ -0,0 +1,102 @@
+package exr
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestLayers(t *testing.T) {
+	rect := image.Rect(0, 0, 2, 2)
+	constant := func(name string, v float32) *Channel {
+		return &Channel{Name: name, Type: HALF, XSampling: 1, YSampling: 1, Rect: rect, Float: []float32{v, v, v, v}}
+	}
+	m := &Image{
+		Header: make(Header),
+		Rect:   rect,
+		Channels: []*Channel{
+			constant("A", 1),
+			constant("Z", 5),
+			constant("diffuse.B", 0.25),
+			constant("diffuse.G", 0.5),
+			constant("diffuse.R", 1),
+			constant("left.specular.G", 0.75),
+		},
+	}
+	if got, want := m.Layers(), []string{"", "diffuse", "left.specular"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("layers: got %q, want %q", got, want)
+	}
+
+	cases := []struct {
+		layer string
+		want  []string
+	}{
+		{"", []string{"A", "Z"}},
+		{"diffuse", []string{"B", "G", "R"}},
+		{"left", []string{"specular.G"}},
+		{"left.specular", []string{"G"}},
+		{"diff", nil},
+	}
+	for _, c := range cases {
+		var got []string
+		for _, ch := range m.Layer(c.layer).Channels {
+			got = append(got, ch.Name)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("channels of layer %q: got %q, want %q", c.layer, got, c.want)
+		}
+	}
+
+	// A layer without alpha is opaque.
+	got := m.Layer("diffuse").RGBA64At(1, 1)
+	want := color.RGBA64{R: 0xFFFF, G: 0x8000, B: 0x4000, A: 0xFFFF}
+	if got != want {
+		t.Fatalf("color of diffuse layer: got %v, want %v", got, want)
+	}
+}
+
+func TestSetLayer(t *testing.T) {
+	rect := image.Rect(1, 1, 3, 3)
+	m := &Image{Header: make(Header), Rect: rect}
+
+	rgba := image.NewRGBA64(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			rgba.SetRGBA64(x, y, color.RGBA64{R: 0xFFFF, A: 0xFFFF})
+		}
+	}
+	m.SetLayer("diffuse", rgba)
+
+	depth := &Image{
+		Rect: image.Rect(0, 0, 2, 2),
+		Channels: []*Channel{
+			{Name: "Z", Type: FLOAT, XSampling: 1, YSampling: 1, Rect: image.Rect(0, 0, 2, 2), Float: []float32{1, 2, 3, 4}},
+		},
+	}
+	m.SetLayer("", depth)
+	m.SetLayer("old", depth)
+	m.SetLayer("old", &Image{Rect: rect})
+
+	var names []string
+	for _, c := range m.Channels {
+		names = append(names, c.Name)
+	}
+	if want := []string{"Z", "diffuse.A", "diffuse.B", "diffuse.G", "diffuse.R"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("channels: got %q, want %q", names, want)
+	}
+	if got, want := m.Channel("Z").Float, []float32{4, 0, 0, 0}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("reframed Z: got %v, want %v", got, want)
+	}
+
+	// Layers are written into a single part, and read back.
+	b := encodeBytes(t, m, nil)
+	d, err := decodeBytes(t, b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareChannels(t, d, m)
+	if got, want := d.Layer("diffuse").RGBA64At(2, 2), (color.RGBA64{R: 0xFFFF, A: 0xFFFF}); got != want {
+		t.Fatalf("decoded color of diffuse layer: got %v, want %v", got, want)
+	}
+}
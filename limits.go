@@ -0,0 +1,132 @@
+package exr
+
+import (
+	"fmt"
+	"image"
+)
+
+// A LimitError reports that the input needs more resources than the decoder's Limits allow.
+type LimitError string
+
+func (e LimitError) Error() string {
+	return "exr: limit exceeded: " + string(e)
+}
+
+// Limits are limits of the resources the decoder uses for an image.
+// The decoder checks them before it allocates memory for what a file claims,
+// such as size of an attribute or a chunk, so it is safe to decode
+// hostile or corrupted files, such as uploaded ones.
+//
+// A zero or negative field means no limit.
+type Limits struct {
+	// MaxWidth and MaxHeight are the maximum size of the data window of a part.
+	MaxWidth  int
+	MaxHeight int
+
+	// MaxAttributeSize is the maximum size of an attribute value in bytes.
+	MaxAttributeSize int
+
+	// MaxChunkSize is the maximum size of a chunk in bytes,
+	// both of it's compressed data and the uncompressed data.
+	MaxChunkSize int
+
+	// MaxAllocation is the maximum total size in bytes of the offset tables
+	// and the decoded pixel values of an image.
+	MaxAllocation int64
+
+	// MaxSamplesPerPixel is the maximum number of samples in a pixel of a deep image.
+	// It is checked with the maxSamplesPerPixel attribute.
+	MaxSamplesPerPixel int
+}
+
+// DefaultLimits are the limits used when DecodeOptions doesn't have Limits.
+// They are large enough for usual production images.
+var DefaultLimits = Limits{
+	MaxWidth:           1 << 16,
+	MaxHeight:          1 << 16,
+	MaxAttributeSize:   1 << 24,
+	MaxChunkSize:       1 << 28,
+	MaxAllocation:      1 << 32,
+	MaxSamplesPerPixel: 1 << 16,
+}
+
+// limitsOrDefault returns l, or DefaultLimits when l is nil.
+func limitsOrDefault(l *Limits) *Limits {
+	if l == nil {
+		return &DefaultLimits
+	}
+	return l
+}
+
+// checkAttributeSize checks the size of an attribute value.
+func (l *Limits) checkAttributeSize(name string, size int) error {
+	if l.MaxAttributeSize > 0 && size > l.MaxAttributeSize {
+		return LimitError(fmt.Sprintf("attribute %q has %d bytes, more than %d", name, size, l.MaxAttributeSize))
+	}
+	return nil
+}
+
+// checkChunkSize checks the size of a chunk's data.
+func (l *Limits) checkChunkSize(size int) error {
+	if l.MaxChunkSize > 0 && size > l.MaxChunkSize {
+		return LimitError(fmt.Sprintf("chunk has %d bytes, more than %d", size, l.MaxChunkSize))
+	}
+	return nil
+}
+
+// checkRect checks the size of a data window.
+func (l *Limits) checkRect(r image.Rectangle) error {
+	// Size is computed in int64, the rectangle could be as large as the box2i range.
+	w := int64(r.Max.X) - int64(r.Min.X)
+	h := int64(r.Max.Y) - int64(r.Min.Y)
+	if l.MaxWidth > 0 && w > int64(l.MaxWidth) {
+		return LimitError(fmt.Sprintf("image width %d is larger than %d", w, l.MaxWidth))
+	}
+	if l.MaxHeight > 0 && h > int64(l.MaxHeight) {
+		return LimitError(fmt.Sprintf("image height %d is larger than %d", h, l.MaxHeight))
+	}
+	return nil
+}
+
+// checkAllocation checks the total size of the allocations, that will be total bytes.
+func (l *Limits) checkAllocation(total int64) error {
+	if l.MaxAllocation > 0 && total > l.MaxAllocation {
+		return LimitError(fmt.Sprintf("image needs %d bytes, more than %d", total, l.MaxAllocation))
+	}
+	return nil
+}
+
+// checkHeader checks the data window and the samples per pixel of a part,
+// before the decoder allocates it's offset table.
+func (l *Limits) checkHeader(h Header) error {
+	if attr, ok := h["dataWindow"]; ok {
+		b, err := box2iFromBytes(attr.value)
+		if err != nil {
+			return err
+		}
+		if err := l.checkRect(b.rect()); err != nil {
+			return err
+		}
+	}
+	if attr, ok := h["maxSamplesPerPixel"]; ok && l.MaxSamplesPerPixel > 0 {
+		n, err := intFromBytes(attr.value)
+		if err != nil {
+			return err
+		}
+		if int64(n) > int64(l.MaxSamplesPerPixel) {
+			return LimitError(fmt.Sprintf("deep image has %d samples per pixel, more than %d", n, l.MaxSamplesPerPixel))
+		}
+	}
+	return nil
+}
+
+// pixelBytes returns size of the decoded pixel values of the channels in rect.
+// Pixel values take 4 bytes, as uint32 or float32.
+func pixelBytes(chans chlist, rect image.Rectangle) int64 {
+	var n int64
+	for _, ch := range chans {
+		r := sampledRect(rect, int(ch.xSampling), int(ch.ySampling))
+		n += 4 * int64(r.Dx()) * int64(r.Dy())
+	}
+	return n
+}
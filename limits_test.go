@@ -0,0 +1,108 @@
+package exr
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	rect := image.Rect(0, 0, 4, 6)
+	m := lineOrderImage(rect)
+	m.Header.SetComments(strings.Repeat("x", 100))
+	b := encodeBytes(t, m, nil)
+	// The offset table has 6 offsets of 8 bytes. Y has 4x6 pixels and RY has 2x3 pixels,
+	// those are decoded to 4 bytes each. A chunk of an even line has 4*4 + 2*2 bytes.
+	cases := []struct {
+		name     string
+		limits   Limits
+		channels []string
+		ok       bool
+	}{
+		{"default", DefaultLimits, nil, true},
+		{"no limits", Limits{}, nil, true},
+		{"exact", Limits{MaxWidth: 4, MaxHeight: 6, MaxAttributeSize: 100, MaxChunkSize: 20, MaxAllocation: 48 + 96 + 24}, nil, true},
+		{"width", Limits{MaxWidth: 3}, nil, false},
+		{"height", Limits{MaxHeight: 5}, nil, false},
+		{"attribute size", Limits{MaxAttributeSize: 99}, nil, false},
+		{"chunk size", Limits{MaxChunkSize: 19}, nil, false},
+		{"allocation", Limits{MaxAllocation: 48 + 96 + 24 - 1}, nil, false},
+		{"allocation of selected channels", Limits{MaxAllocation: 48 + 24}, []string{"RY"}, true},
+	}
+	for _, c := range cases {
+		l := c.limits
+		d, err := newDecoder(bytes.NewReader(b), int64(len(b)), &l)
+		if err == nil {
+			_, err = d.decodePart(0, &DecodeOptions{Channels: c.channels})
+		}
+		if c.ok {
+			if err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+			continue
+		}
+		if _, ok := err.(LimitError); !ok {
+			t.Fatalf("%s: got error %v, want LimitError", c.name, err)
+		}
+	}
+}
+
+func TestLimitsHostileHeader(t *testing.T) {
+	rect := image.Rect(0, 0, 2, 2)
+	valid := encodeBytes(t, lineOrderImage(rect), nil)
+	r := bufio.NewReader(bytes.NewReader(valid))
+	vf, err := readVersion(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, err := readHeaders(r, vf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A data window of 2^30 lines would allocate an offset table of 8 GiB.
+	h := headers[0].copy()
+	h.SetAttribute("dataWindow", "box2i", box2iToBytes(box2i{0, 0, 1, 1 << 30}))
+	b := append(versionToBytes(vf), headersToBytes(vf, []Header{h})...)
+	if _, err := newDecoder(bytes.NewReader(b), int64(len(b)), nil); err == nil {
+		t.Fatalf("huge data window: want an error")
+	} else if _, ok := err.(LimitError); !ok {
+		t.Fatalf("huge data window: got error %v, want LimitError", err)
+	}
+
+	// A grid of 65536x8192 tiles of 1x1 pixels would allocate an offset table of 4 GiB,
+	// within the limits, but the file is too small to have it.
+	tvf := vf
+	tvf.tiled = true
+	h = headers[0].copy()
+	h.SetAttribute("dataWindow", "box2i", box2iToBytes(box2i{0, 0, 1<<16 - 1, 1<<13 - 1}))
+	h.SetAttribute("tiles", "tiledesc", []byte{1, 0, 0, 0, 1, 0, 0, 0, 0})
+	b = append(versionToBytes(tvf), headersToBytes(tvf, []Header{h})...)
+	b = append(b, make([]byte, 64)...)
+	if _, err := newDecoder(bytes.NewReader(b), int64(len(b)), nil); err == nil {
+		t.Fatalf("huge tile grid: want an error")
+	} else if _, ok := err.(FormatError); !ok {
+		t.Fatalf("huge tile grid: got error %v, want FormatError", err)
+	}
+
+	// An attribute that claims 4 GiB of value.
+	b = append(versionToBytes(vf), []byte("comments\x00string\x00\xf0\xff\xff\xff")...)
+	if _, err := newDecoder(bytes.NewReader(b), int64(len(b)), nil); err == nil {
+		t.Fatalf("huge attribute: want an error")
+	} else if _, ok := err.(LimitError); !ok {
+		t.Fatalf("huge attribute: got error %v, want LimitError", err)
+	}
+
+	h = headers[0].copy()
+	h.SetInt("maxSamplesPerPixel", 100)
+	l := Limits{MaxSamplesPerPixel: 100}
+	if err := l.checkHeader(h); err != nil {
+		t.Fatal(err)
+	}
+	l.MaxSamplesPerPixel = 99
+	if _, ok := l.checkHeader(h).(LimitError); !ok {
+		t.Fatalf("maxSamplesPerPixel 100 with limit 99: want LimitError")
+	}
+}
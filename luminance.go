@@ -0,0 +1,227 @@
+package exr
+
+import (
+	"image"
+	"math"
+)
+
+// Luminance/chroma images store colors as luminance (Y) and two chroma channels,
+// RY = (R - Y) / Y and BY = (B - Y) / Y. Chroma channels are usually
+// subsampled by 2 in both directions, because human eyes are less sensitive
+// to chroma than luminance. Images that have only Y channel are grayscale.
+//
+// Luminance is a weighted sum of R, G and B. The weights are decided by
+// the chromaticities attribute of the header, or Rec.709 chromaticities
+// when the header doesn't have it.
+
+// isLuminanceChroma reports whether m stores colors in Y, RY and BY channels,
+// instead of R, G and B channels.
+func (m *Image) isLuminanceChroma() bool {
+	if m.Channel("Y") == nil {
+		return false
+	}
+	return m.Channel("R") == nil && m.Channel("G") == nil && m.Channel("B") == nil
+}
+
+// ycToRGB converts luminance and chroma to RGB, with luminance weights yw.
+func ycToRGB(yw [3]float32, y, ry, by float32) (r, g, b float32) {
+	if ry == 0 && by == 0 {
+		// Set the luminance explicitly, to avoid rounding errors.
+		return y, y, y
+	}
+	r = (ry + 1) * y
+	b = (by + 1) * y
+	g = (y - r*yw[0] - b*yw[2]) / yw[1]
+	return r, g, b
+}
+
+// rgbToYC converts RGB to luminance and chroma, with luminance weights yw.
+// Negative or non-finite color values are considered as 0.
+func rgbToYC(yw [3]float32, r, g, b float32) (y, ry, by float32) {
+	valid := func(v float32) float32 {
+		if v != v || v < 0 || math.IsInf(float64(v), 1) {
+			return 0
+		}
+		return v
+	}
+	r, g, b = valid(r), valid(g), valid(b)
+	if r == g && g == b {
+		// Set the luminance explicitly, to avoid rounding errors.
+		return g, 0, 0
+	}
+	y = r*yw[0] + g*yw[1] + b*yw[2]
+	chroma := func(v float32) float32 {
+		// Chroma values are kept in range of HALF.
+		if float32(math.Abs(float64(v-y))) < 65504*y {
+			return (v - y) / y
+		}
+		return 0
+	}
+	return y, chroma(r), chroma(b)
+}
+
+// ToRGB returns an image those colors are stored in R, G and B channels,
+// converted from Y, RY and BY channels of a luminance/chroma image.
+// Chroma channels are upsampled to the full resolution before the conversion.
+// Other channels, such as A, are shared with m.
+//
+// When m isn't a luminance/chroma image, it returns m itself.
+func (m *Image) ToRGB() *Image {
+	if !m.isLuminanceChroma() {
+		return m
+	}
+	yw := luminanceWeights(m.Header.Chromaticities())
+	yc := m.Channel("Y").Upsample(m.Rect)
+	typ := yc.Type
+	if typ == UINT {
+		typ = FLOAT
+	}
+	chroma := func(name string) *Channel {
+		if c := m.Channel(name); c != nil && c.Type != UINT {
+			return c.Upsample(m.Rect)
+		}
+		return nil
+	}
+	ryc := chroma("RY")
+	byc := chroma("BY")
+
+	u := &Image{
+		Header: m.Header,
+		Rect:   m.Rect,
+	}
+	for _, c := range m.Channels {
+		if c.Name != "Y" && c.Name != "RY" && c.Name != "BY" {
+			u.Channels = append(u.Channels, c)
+		}
+	}
+	rc := newChannel(channel{name: "R", pixelType: typ, xSampling: 1, ySampling: 1}, m.Rect)
+	gc := newChannel(channel{name: "G", pixelType: typ, xSampling: 1, ySampling: 1}, m.Rect)
+	bc := newChannel(channel{name: "B", pixelType: typ, xSampling: 1, ySampling: 1}, m.Rect)
+	u.Channels = append(u.Channels, rc, gc, bc)
+	sortChannels(u.Channels)
+
+	for i := range rc.Float {
+		var y, ry, by float32
+		if yc.Uint != nil {
+			y = float32(yc.Uint[i])
+		} else {
+			y = yc.Float[i]
+		}
+		if ryc != nil {
+			ry = ryc.Float[i]
+		}
+		if byc != nil {
+			by = byc.Float[i]
+		}
+		rc.Float[i], gc.Float[i], bc.Float[i] = ycToRGB(yw, y, ry, by)
+	}
+	return u
+}
+
+// ToLuminanceChroma returns an image those colors are stored in Y, RY and BY channels,
+// converted from R, G and B channels of m. RY and BY channels are subsampled
+// by 2 in each direction that the data window is divisible by 2.
+// Luminance weights are decided by the chromaticities of m's header.
+// Other channels, such as A, are shared with m.
+//
+// Pixel types of the new channels are the same with the R channel,
+// or FLOAT when it is a UINT channel.
+// When m doesn't have any of R, G and B channels, it returns m itself.
+func (m *Image) ToLuminanceChroma() *Image {
+	rc, gc, bc := m.Channel("R"), m.Channel("G"), m.Channel("B")
+	if rc == nil && gc == nil && bc == nil {
+		return m
+	}
+	yw := luminanceWeights(m.Header.Chromaticities())
+	typ := FLOAT
+	for _, c := range []*Channel{rc, gc, bc} {
+		if c != nil {
+			if c.Type != UINT {
+				typ = c.Type
+			}
+			break
+		}
+	}
+	plane := func(c *Channel) *Channel {
+		if c == nil {
+			return nil
+		}
+		return c.Upsample(m.Rect)
+	}
+	rc, gc, bc = plane(rc), plane(gc), plane(bc)
+	at := func(c *Channel, i int) float32 {
+		if c == nil {
+			return 0
+		}
+		if c.Uint != nil {
+			return float32(c.Uint[i])
+		}
+		return c.Float[i]
+	}
+
+	full := channel{pixelType: typ, xSampling: 1, ySampling: 1}
+	full.name = "Y"
+	yc := newChannel(full, m.Rect)
+	full.name = "RY"
+	ryc := newChannel(full, m.Rect)
+	full.name = "BY"
+	byc := newChannel(full, m.Rect)
+	for i := range yc.Float {
+		yc.Float[i], ryc.Float[i], byc.Float[i] = rgbToYC(yw, at(rc, i), at(gc, i), at(bc, i))
+	}
+
+	sx, sy := 1, 1
+	if modp(m.Rect.Min.X, 2) == 0 && modp(m.Rect.Dx(), 2) == 0 {
+		sx = 2
+	}
+	if modp(m.Rect.Min.Y, 2) == 0 && modp(m.Rect.Dy(), 2) == 0 {
+		sy = 2
+	}
+
+	u := &Image{
+		Header: m.Header,
+		Rect:   m.Rect,
+	}
+	for _, c := range m.Channels {
+		if c.Name != "R" && c.Name != "G" && c.Name != "B" {
+			u.Channels = append(u.Channels, c)
+		}
+	}
+	u.Channels = append(u.Channels, yc, ryc.subsample(sx, sy), byc.subsample(sx, sy))
+	sortChannels(u.Channels)
+	return u
+}
+
+// subsample returns a channel subsampled from the full resolution channel c,
+// with sampling rates sx and sy. Each sample is an average of
+// pixel values it covers. c should be a HALF or FLOAT channel.
+func (c *Channel) subsample(sx, sy int) *Channel {
+	if sx == 1 && sy == 1 {
+		return c
+	}
+	s := newChannel(channel{
+		name:      c.Name,
+		pixelType: c.Type,
+		xSampling: int32(sx),
+		ySampling: int32(sy),
+	}, c.Rect)
+	s.PLinear = c.PLinear
+	for y := s.Rect.Min.Y; y < s.Rect.Max.Y; y++ {
+		for x := s.Rect.Min.X; x < s.Rect.Max.X; x++ {
+			sum := float32(0)
+			n := 0
+			for py := y * sy; py < (y+1)*sy; py++ {
+				for px := x * sx; px < (x+1)*sx; px++ {
+					if (image.Point{px, py}).In(c.Rect) {
+						sum += c.Float[c.PixOffset(px, py)]
+						n++
+					}
+				}
+			}
+			if n > 0 {
+				s.Float[s.PixOffset(x, y)] = sum / float32(n)
+			}
+		}
+	}
+	return s
+}
@@ -0,0 +1,142 @@
+package exr
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLuminanceWeights(t *testing.T) {
+	// Rec.709 luminance weights.
+	want := [3]float32{0.2126, 0.7152, 0.0722}
+	got := luminanceWeights(Rec709Chromaticities)
+	for i := range want {
+		if math.Abs(float64(got[i]-want[i])) > 1e-4 {
+			t.Fatalf("luminanceWeights: got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestLuminanceChromaConversion(t *testing.T) {
+	yw := luminanceWeights(Rec709Chromaticities)
+	cases := []struct {
+		r, g, b float32
+	}{
+		{0, 0, 0},
+		{1, 1, 1},
+		{0.5, 0.25, 0.125},
+		{0.1, 0.9, 0.3},
+		{8, 2, 0.5},
+	}
+	for _, c := range cases {
+		y, ry, by := rgbToYC(yw, c.r, c.g, c.b)
+		r, g, b := ycToRGB(yw, y, ry, by)
+		for _, v := range [][2]float32{{r, c.r}, {g, c.g}, {b, c.b}} {
+			if math.Abs(float64(v[0]-v[1])) > 1e-5 {
+				t.Fatalf("rgb (%v, %v, %v): got (%v, %v, %v) after round trip", c.r, c.g, c.b, r, g, b)
+			}
+		}
+	}
+}
+
+func TestEncodeLuminanceChroma(t *testing.T) {
+	rect := image.Rect(0, 0, 8, 6)
+	src := image.NewRGBA64(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			// Colors of the same hue have the same chroma, so they survive chroma subsampling.
+			v := uint16(0x400*(x+8*y) + 0x400)
+			src.SetRGBA64(x, y, color.RGBA64{v, v / 2, v / 4, 0xFFFF})
+		}
+	}
+	path := encodeTemp(t, src, &Options{LuminanceChroma: true})
+	defer os.RemoveAll(filepath.Dir(path))
+	m, err := Decode(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := m.(*Image)
+	for _, name := range []string{"R", "G", "B"} {
+		if got.Channel(name) != nil {
+			t.Fatalf("channel %q should not be written", name)
+		}
+	}
+	for _, c := range []struct {
+		name   string
+		sx, sy int
+	}{
+		{"A", 1, 1},
+		{"BY", 2, 2},
+		{"RY", 2, 2},
+		{"Y", 1, 1},
+	} {
+		ch := got.Channel(c.name)
+		if ch == nil {
+			t.Fatalf("channel %q not found", c.name)
+		}
+		if ch.XSampling != c.sx || ch.YSampling != c.sy {
+			t.Fatalf("channel %q: sampling: got (%d, %d), want (%d, %d)", c.name, ch.XSampling, ch.YSampling, c.sx, c.sy)
+		}
+	}
+
+	rgb := got.ToRGB()
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			w := src.RGBA64At(x, y)
+			for _, c := range []struct {
+				name string
+				want uint16
+			}{
+				{"R", w.R},
+				{"G", w.G},
+				{"B", w.B},
+			} {
+				v := rgb.Channel(c.name).FloatAt(x, y)
+				if math.Abs(float64(v)-float64(c.want)/0xFFFF) > 1e-3 {
+					t.Fatalf("channel %q at (%d, %d): got %v, want %v", c.name, x, y, v, float64(c.want)/0xFFFF)
+				}
+			}
+			g := got.RGBA64At(x, y)
+			d := func(a, b uint16) int {
+				if a > b {
+					return int(a - b)
+				}
+				return int(b - a)
+			}
+			if d(g.R, w.R) > 0x80 || d(g.G, w.G) > 0x80 || d(g.B, w.B) > 0x80 || g.A != w.A {
+				t.Fatalf("color at (%d, %d): got %v, want %v", x, y, g, w)
+			}
+		}
+	}
+}
+
+func TestRGBA64AtChangedImage(t *testing.T) {
+	rect := image.Rect(0, 0, 1, 1)
+	plane := func(name string, v float32) *Channel {
+		return &Channel{Name: name, Type: FLOAT, XSampling: 1, YSampling: 1, Rect: rect, Float: []float32{v}}
+	}
+	m := &Image{Header: make(Header), Rect: rect, Channels: []*Channel{plane("R", 0.5)}}
+	if got := m.RGBA64At(0, 0); got != (color.RGBA64{0x8000, 0, 0, 0xFFFF}) {
+		t.Fatalf("rgb image: got %v", got)
+	}
+	m.Channels = append(m.Channels, plane("A", 0))
+	if got := m.RGBA64At(0, 0); got != (color.RGBA64{0x8000, 0, 0, 0}) {
+		t.Fatalf("channel added: got %v", got)
+	}
+	m.Channels[0].Name = "G"
+	if got := m.RGBA64At(0, 0); got != (color.RGBA64{0, 0x8000, 0, 0}) {
+		t.Fatalf("channel renamed: got %v", got)
+	}
+	m.Channels = []*Channel{plane("BY", 0), plane("RY", 1), plane("Y", 0.25)}
+	before := m.RGBA64At(0, 0)
+	if before.R != 0x8000 {
+		t.Fatalf("luminance/chroma image: got %v", before)
+	}
+	m.Header.SetChromaticities(ACESChromaticities)
+	if after := m.RGBA64At(0, 0); after.G == before.G {
+		t.Fatalf("chromaticities changed: green should change from %v", before.G)
+	}
+}
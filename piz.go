@@ -2,6 +2,7 @@ package exr
 
 import (
 	"encoding/binary"
+	"fmt"
 )
 
 // piz compressed data structure
@@ -14,95 +15,202 @@ import (
 // 	compressed data
 // ]
 
-func pizCompress(block blockInfo, raw []byte) []byte {
+// pizCompress compresses raw data of a block.
+// raw has the same form with the one pizDecompress returns,
+// each line of it has data of all channels, one channel after another.
+func pizCompress(block blockInfo, raw []byte) ([]byte, error) {
 	if len(raw)%2 != 0 {
-		panic("raw should []byte of size 2*n")
+		return nil, FormatError(fmt.Sprintf("piz: raw data should have even number of bytes, got %d", len(raw)))
+	}
+	if len(raw) != block.rawSize() {
+		return nil, FormatError(fmt.Sprintf("piz: raw data has %d bytes, want %d", len(raw), block.rawSize()))
+	}
+
+	// rearrange raw, so it has data of each channel one after another.
+	// it is the reverse of the rearrangement in pizDecompress.
+	starts := make([]int, len(block.channels))
+	n := 0
+	for i, ch := range block.channels {
+		starts[i] = n
+		nx, ny := block.channelSize(ch)
+		n += nx * ny * pixelSize(ch.pixelType)
+	}
+	data := make([]byte, len(raw))
+	n = 0
+	for y := block.y; y < block.y+block.height; y++ {
+		for i, ch := range block.channels {
+			if modp(y, int(ch.ySampling)) != 0 {
+				continue
+			}
+			nx, _ := block.channelSize(ch)
+			linesize := nx * pixelSize(ch.pixelType)
+			copy(data[starts[i]:], raw[n:n+linesize])
+			starts[i] += linesize
+			n += linesize
+		}
 	}
-	r := newByteReader(binary.LittleEndian, raw)
 
-	// build bitmap from raw data
-	bitm := newBitmap(1 << 16)
-	for i := 0; i < len(raw); i += 2 {
-		d := r.Uint16()
-		bitm.Set(d)
+	// build bitmap from the data
+	bitm, err := newBitmap(1 << 16)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(data); i += 2 {
+		bitm.Set(getUint16(data[i:]))
 	}
 	bitm.Unset(0) // don't include zero in bitmap
 
-	// apply forward lut to raw data
-	r = newByteReader(binary.LittleEndian, raw)
-	w := newByteWriter(binary.LittleEndian, raw)
-	lut := forwardLutFromBitmap(bitm)
-	for i := 0; i < len(raw); i += 2 {
-		d := r.Uint16()
-		w.Uint16(lut[d])
+	// apply forward lut to the data
+	lut, maxValue := forwardLutFromBitmap(bitm)
+	for i := 0; i < len(data); i += 2 {
+		setUint16(data[i:], lut[getUint16(data[i:])])
 	}
 
-	// wavlet encoding per channel
-	var n, m int
+	// wavlet encode each channel
+	// 32 bit channels are encoded as two interleaved 16 bit channels.
+	var m int
+	n = 0
 	for _, ch := range block.channels {
-		m += block.width * block.height * pixelSize(ch.pixelType)
-		_ = n // avoid n declared and not used error, temporarily
-		// TODO: applyWaveletEncode(raw[n:m], maxValue)
+		pixsize := pixelSize(ch.pixelType)
+		nx, ny := block.channelSize(ch)
+		m += nx * ny * pixsize
+		for j := 0; j < pixsize; j += 2 {
+			if err := wav2Encode(data[n+j:m], nx, pixsize, ny, nx*pixsize, maxValue); err != nil {
+				return nil, err
+			}
+		}
 		n = m
 	}
 
-	// write
-	compressed := make([]byte, len(raw)+12)
-	w = newByteWriter(binary.LittleEndian, compressed)
+	cdata, err := huffmanCompress(block, data)
+	if err != nil {
+		return nil, err
+	}
 
+	// write
 	minNonZero := bitm.MinByteIndex()
 	maxNonZero := bitm.MaxByteIndex()
-	w.Uint32(uint32(minNonZero))
-	w.Uint32(uint32(maxNonZero))
-	w.Bytes(bitm[minNonZero : maxNonZero+1])
-
-	cdata := huffmanCompress(block, raw)
-	w.Uint32(uint32(len(cdata)))
-	for _, d := range cdata {
-		w.Uint8(d)
+	size := 2 + 2 + 4 + len(cdata)
+	if minNonZero <= maxNonZero {
+		// otherwise, all data are zero and bitmap is omitted.
+		size += maxNonZero - minNonZero + 1
 	}
-	return compressed
+	compressed := make([]byte, size)
+	w := newByteWriter(binary.LittleEndian, compressed)
+	w.Uint16(uint16(minNonZero))
+	w.Uint16(uint16(maxNonZero))
+	if minNonZero <= maxNonZero {
+		w.Bytes(bitm[minNonZero : maxNonZero+1])
+	}
+	w.Uint32(uint32(len(cdata)))
+	w.Bytes(cdata)
+	return compressed, nil
 }
 
-func pizDecompress(block blockInfo, compressed []byte) []byte {
+// pizDecompress decompresses piz compressed data of a block.
+// It returns a FormatError when the data is corrupted.
+func pizDecompress(block blockInfo, compressed []byte) ([]byte, error) {
 	r := newByteReader(binary.LittleEndian, compressed)
 
 	// get bitmap info
+	if r.Remain() < 4 {
+		return nil, FormatError("piz: compressed data is too short to have the bitmap range")
+	}
 	minNonZero := int(r.Uint16())
 	maxNonZero := int(r.Uint16())
-	bitm := newBitmap(1 << 16)
-	copy(bitm[minNonZero:maxNonZero+1], r.Bytes(maxNonZero-minNonZero+1))
+	bitm, err := newBitmap(1 << 16)
+	if err != nil {
+		return nil, err
+	}
+	if maxNonZero >= len(bitm) {
+		return nil, FormatError(fmt.Sprintf("piz: bitmap range [%d, %d] exceeds the bitmap size %d", minNonZero, maxNonZero, len(bitm)))
+	}
+	if minNonZero <= maxNonZero {
+		// otherwise, all data are zero and bitmap is omitted.
+		if r.Remain() < maxNonZero-minNonZero+1 {
+			return nil, FormatError("piz: compressed data is too short to have the bitmap")
+		}
+		copy(bitm[minNonZero:maxNonZero+1], r.Bytes(maxNonZero-minNonZero+1))
+	}
+	lut, maxValue := reverseLutFromBitmap(bitm)
 
 	// decompress
+	if r.Remain() < 4 {
+		return nil, FormatError("piz: compressed data is too short to have the data length")
+	}
 	lc := int(r.Uint32())
+	if lc > r.Remain() {
+		return nil, FormatError(fmt.Sprintf("piz: data length %d exceeds the remaining %d bytes", lc, r.Remain()))
+	}
 	cdata := r.Bytes(lc)
-	raw := huffmanDecompress(block, cdata)
+	raw, err := huffmanDecompress(block, cdata)
+	if err != nil {
+		return nil, err
+	}
 
 	// wavlet decode each channel
+	// 32 bit channels are decoded as two interleaved 16 bit channels.
+	// then apply reverse lut. skipped channels are left encoded.
 	var n, m int
-	for _, ch := range block.channels {
+	for i, ch := range block.channels {
 		pixsize := pixelSize(ch.pixelType)
-		m += block.width * block.height * pixsize
-		wav2Decode(raw[n:m], block.width, pixsize, block.height, block.width*pixsize, maxNonZero)
+		nx, ny := block.channelSize(ch)
+		m += nx * ny * pixsize
+		if block.skip != nil && block.skip[i] {
+			n = m
+			continue
+		}
+		for j := 0; j < pixsize; j += 2 {
+			if err := wav2Decode(raw[n+j:m], nx, pixsize, ny, nx*pixsize, maxValue); err != nil {
+				return nil, err
+			}
+		}
+		for j := n; j < m; j += 2 {
+			setUint16(raw[j:], lut[getUint16(raw[j:])])
+		}
 		n = m
 	}
-	_ = n
 
-	// apply reverse lut
-	lut := reverseLutFromBitmap(bitm)
-	r = newByteReader(binary.LittleEndian, raw)
-	w := newByteWriter(binary.LittleEndian, raw)
-	for i := 0; i < len(raw); i += 2 {
-		d := r.Uint16()
-		w.Uint16(lut[d])
+	// raw has data of each channel one after another.
+	// rearrange it, so each line has data of all channels.
+	// subsampled channels don't have data in some lines.
+	starts := make([]int, len(block.channels))
+	n = 0
+	for i, ch := range block.channels {
+		starts[i] = n
+		nx, ny := block.channelSize(ch)
+		n += nx * ny * pixelSize(ch.pixelType)
 	}
-	return raw
+	out := make([]byte, 0, len(raw))
+	for y := block.y; y < block.y+block.height; y++ {
+		for i, ch := range block.channels {
+			if modp(y, int(ch.ySampling)) != 0 {
+				continue
+			}
+			nx, _ := block.channelSize(ch)
+			linesize := nx * pixelSize(ch.pixelType)
+			out = append(out, raw[starts[i]:starts[i]+linesize]...)
+			starts[i] += linesize
+		}
+	}
+	return out, nil
 }
 
-func wav2Decode(data []byte, nx, ox, ny, oy int, max int) {
-	w14 := false
-	if max < (1 << 14) {
-		w14 = true
+// wav2Decode decodes 2D wavelet encoded data in place.
+// nx and ny are number of data in x and y direction,
+// ox and oy are distance in bytes between neighboring data in x and y direction.
+// mx is the maximum value of the data, that decides the decoding method.
+// It returns an error when data is too short to have nx * ny data.
+func wav2Decode(data []byte, nx, ox, ny, oy int, mx uint16) error {
+	if nx <= 0 || ny <= 0 {
+		return nil
+	}
+	if (ny-1)*oy+(nx-1)*ox+2 > len(data) {
+		return FormatError(fmt.Sprintf("piz: wavelet data of %dx%d has only %d bytes", nx, ny, len(data)))
+	}
+	wdec := wdec16
+	if mx < (1 << 14) {
+		wdec = wdec14
 	}
 
 	// n is shorter side's length among width and height
@@ -111,23 +219,23 @@ func wav2Decode(data []byte, nx, ox, ny, oy int, max int) {
 		n = ny
 	}
 	// find a maximum number that is power of 2 smaller than n
-	m2 := 1
-	for m2 <= n {
-		m2 <<= 1
-	}
-	m2 >>= 1
-	m1 := m2 >> 1
-	for m1 >= 1 {
-		oy1 := m1 * oy
-		oy2 := m2 * oy
-		ox1 := m1 * ox
-		ox2 := m2 * ox
-		endy := ny * oy
+	p2 := 1
+	for p2 <= n {
+		p2 <<= 1
+	}
+	p2 >>= 1
+	p := p2 >> 1
+	for p >= 1 {
+		oy1 := p * oy
+		oy2 := p2 * oy
+		ox1 := p * ox
+		ox2 := p2 * ox
+		endy := oy * (ny - p2)
 		iy := 0
-		for ; iy <= endy-oy2; iy += oy2 {
-			endx := iy + oy
+		for ; iy <= endy; iy += oy2 {
+			endx := iy + ox*(nx-p2)
 			ix := iy
-			for ; ix <= endx-ox2; ix += ox2 {
+			for ; ix <= endx; ix += ox2 {
 				i00 := ix
 				i01 := ix + ox1
 				i10 := ix + oy1
@@ -136,45 +244,123 @@ func wav2Decode(data []byte, nx, ox, ny, oy int, max int) {
 				d01 := getUint16(data[i01:])
 				d10 := getUint16(data[i10:])
 				d11 := getUint16(data[i11:])
-				if w14 {
-					d00, d10 = wdec14(d00, d10)
-					d01, d11 = wdec14(d01, d11)
-					d00, d01 = wdec14(d00, d01)
-					d10, d11 = wdec14(d10, d11)
-				} else {
-					panic("not implemented yet")
-				}
+				d00, d10 = wdec(d00, d10)
+				d01, d11 = wdec(d01, d11)
+				d00, d01 = wdec(d00, d01)
+				d10, d11 = wdec(d10, d11)
 				setUint16(data[i00:], d00)
 				setUint16(data[i01:], d01)
 				setUint16(data[i10:], d10)
 				setUint16(data[i11:], d11)
 			}
-			if nx&m1 != 0 {
+			// odd column
+			if nx&p != 0 {
 				i00 := ix
 				i10 := ix + oy1
 				d00 := getUint16(data[i00:])
 				d10 := getUint16(data[i10:])
-				d00, d10 = wdec14(d00, d10)
+				d00, d10 = wdec(d00, d10)
 				setUint16(data[i00:], d00)
 				setUint16(data[i10:], d10)
 			}
 		}
-		if ny&m1 != 0 {
-			endx := iy + oy
+		// odd line
+		if ny&p != 0 {
+			endx := iy + ox*(nx-p2)
+			ix := iy
+			for ; ix <= endx; ix += ox2 {
+				i00 := ix
+				i01 := ix + ox1
+				d00 := getUint16(data[i00:])
+				d01 := getUint16(data[i01:])
+				d00, d01 = wdec(d00, d01)
+				setUint16(data[i00:], d00)
+				setUint16(data[i01:], d01)
+			}
+		}
+		p2 = p
+		p >>= 1
+	}
+	return nil
+}
+
+// wav2Encode encodes data with 2D wavelet in place.
+// nx and ny are number of data in x and y direction,
+// ox and oy are distance in bytes between neighboring data in x and y direction.
+// mx is the maximum value of the data, that decides the encoding method.
+// It returns an error when data is too short to have nx * ny data.
+func wav2Encode(data []byte, nx, ox, ny, oy int, mx uint16) error {
+	if nx <= 0 || ny <= 0 {
+		return nil
+	}
+	if (ny-1)*oy+(nx-1)*ox+2 > len(data) {
+		return FormatError(fmt.Sprintf("piz: wavelet data of %dx%d has only %d bytes", nx, ny, len(data)))
+	}
+	wenc := wenc16
+	if mx < (1 << 14) {
+		wenc = wenc14
+	}
+
+	// n is shorter side's length among width and height
+	n := nx
+	if n > ny {
+		n = ny
+	}
+	p := 1
+	p2 := 2
+	for p2 <= n {
+		oy1 := p * oy
+		oy2 := p2 * oy
+		ox1 := p * ox
+		ox2 := p2 * ox
+		endy := oy * (ny - p2)
+		iy := 0
+		for ; iy <= endy; iy += oy2 {
+			endx := iy + ox*(nx-p2)
 			ix := iy
-			for ; ix+ox2 <= endx; ix += ox2 {
+			for ; ix <= endx; ix += ox2 {
 				i00 := ix
 				i01 := ix + ox1
+				i10 := ix + oy1
+				i11 := ix + ox1 + oy1
 				d00 := getUint16(data[i00:])
 				d01 := getUint16(data[i01:])
-				d00, d01 = wdec14(d00, d01)
+				d10 := getUint16(data[i10:])
+				d11 := getUint16(data[i11:])
+				d00, d01 = wenc(d00, d01)
+				d10, d11 = wenc(d10, d11)
+				d00, d10 = wenc(d00, d10)
+				d01, d11 = wenc(d01, d11)
 				setUint16(data[i00:], d00)
 				setUint16(data[i01:], d01)
+				setUint16(data[i10:], d10)
+				setUint16(data[i11:], d11)
+			}
+			// odd column
+			if nx&p != 0 {
+				i00 := ix
+				i10 := ix + oy1
+				d00, d10 := wenc(getUint16(data[i00:]), getUint16(data[i10:]))
+				setUint16(data[i00:], d00)
+				setUint16(data[i10:], d10)
 			}
 		}
-		m2 = m1
-		m1 >>= 1
+		// odd line
+		if ny&p != 0 {
+			endx := iy + ox*(nx-p2)
+			ix := iy
+			for ; ix <= endx; ix += ox2 {
+				i00 := ix
+				i01 := ix + ox1
+				d00, d01 := wenc(getUint16(data[i00:]), getUint16(data[i01:]))
+				setUint16(data[i00:], d00)
+				setUint16(data[i01:], d01)
+			}
+		}
+		p = p2
+		p2 <<= 1
 	}
+	return nil
 }
 
 func getUint16(bs []byte) uint16 {
@@ -185,14 +371,50 @@ func setUint16(bs []byte, v uint16) {
 	binary.LittleEndian.PutUint16(bs, v)
 }
 
+// wenc14 encodes a and b to their average and difference.
+// It is used when data fits in 14 bits, and computed with signed 16 bit integers.
 func wenc14(a, b uint16) (avg, dlt uint16) {
-	avg = (a + b) >> 1
-	dlt = a - b
+	as := int(int16(a))
+	bs := int(int16(b))
+	avg = uint16(int16((as + bs) >> 1))
+	dlt = uint16(int16(as - bs))
 	return avg, dlt
 }
 
+// wdec14 decodes average and difference, encoded by wenc14.
 func wdec14(avg, dlt uint16) (a, b uint16) {
-	a = avg + (dlt & 1) + (dlt >> 1)
-	b = a - dlt
+	hi := int(int16(dlt))
+	ai := int(int16(avg)) + (hi & 1) + (hi >> 1)
+	a = uint16(int16(ai))
+	b = uint16(int16(ai - hi))
 	return a, b
 }
+
+const (
+	wavNBits   = 16
+	wavAOffset = 1 << (wavNBits - 1)
+	wavMOffset = 1 << (wavNBits - 1)
+	wavModMask = (1 << wavNBits) - 1
+)
+
+// wenc16 encodes a and b to their average and difference, with modulo arithmetic.
+// It is used when data doesn't fit in 14 bits.
+func wenc16(a, b uint16) (avg, dlt uint16) {
+	ao := (int(a) + wavAOffset) & wavModMask
+	m := (ao + int(b)) >> 1
+	d := ao - int(b)
+	if d < 0 {
+		m = (m + wavMOffset) & wavModMask
+	}
+	d &= wavModMask
+	return uint16(m), uint16(d)
+}
+
+// wdec16 decodes average and difference, encoded by wenc16.
+func wdec16(avg, dlt uint16) (a, b uint16) {
+	m := int(avg)
+	d := int(dlt)
+	bb := (m - (d >> 1)) & wavModMask
+	aa := (d + bb - wavAOffset) & wavModMask
+	return uint16(aa), uint16(bb)
+}
@@ -0,0 +1,324 @@
+package exr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+)
+
+func TestWavelet14(t *testing.T) {
+	for a := 0; a < 1<<14; a += 7 {
+		for b := 0; b < 1<<14; b += 13 {
+			avg, dlt := wenc14(uint16(a), uint16(b))
+			ga, gb := wdec14(avg, dlt)
+			if int(ga) != a || int(gb) != b {
+				t.Fatalf("wdec14(wenc14(%d, %d)): got (%d, %d)", a, b, ga, gb)
+			}
+		}
+	}
+	// The average is computed without overflow of 16 bit integers, like OpenEXR.
+	if avg, _ := wenc14(0x7000, 0x7000); avg != 0x7000 {
+		t.Fatalf("average of 0x7000 and 0x7000: got %#x, want 0x7000", avg)
+	}
+}
+
+func TestWavelet16(t *testing.T) {
+	for a := 0; a < 1<<16; a += 61 {
+		for b := 0; b < 1<<16; b += 59 {
+			avg, dlt := wenc16(uint16(a), uint16(b))
+			ga, gb := wdec16(avg, dlt)
+			if int(ga) != a || int(gb) != b {
+				t.Fatalf("wdec16(wenc16(%d, %d)): got (%d, %d)", a, b, ga, gb)
+			}
+		}
+	}
+}
+
+func TestWav2RoundTrip(t *testing.T) {
+	cases := []struct {
+		nx, ny int
+		ox     int // distance between neighboring data in bytes
+		mx     uint16
+	}{
+		{1, 1, 2, 100},
+		{3, 5, 2, 1<<14 - 1},
+		{16, 16, 2, 1<<14 - 1},
+		{17, 9, 2, 1<<16 - 1},
+		{64, 3, 2, 1<<16 - 1},
+		{7, 6, 4, 1<<16 - 1},
+	}
+	for _, c := range cases {
+		want := make([]byte, c.nx*c.ny*c.ox)
+		for i := 0; i < len(want); i += 2 {
+			setUint16(want[i:], uint16(i*7919%(int(c.mx)+1)))
+		}
+		data := append([]byte(nil), want...)
+		for j := 0; j < c.ox; j += 2 {
+			if err := wav2Encode(data[j:], c.nx, c.ox, c.ny, c.nx*c.ox, c.mx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if bytes.Equal(data, want) && c.nx*c.ny > 1 {
+			t.Fatalf("%dx%d: data isn't encoded", c.nx, c.ny)
+		}
+		for j := 0; j < c.ox; j += 2 {
+			if err := wav2Decode(data[j:], c.nx, c.ox, c.ny, c.nx*c.ox, c.mx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(data, want) {
+			t.Fatalf("%dx%d with distance %d and max value %d: got %v, want %v", c.nx, c.ny, c.ox, c.mx, data, want)
+		}
+	}
+}
+
+func TestPizRoundTrip(t *testing.T) {
+	half := channel{name: "A", pixelType: HALF, xSampling: 1, ySampling: 1}
+	float := channel{name: "B", pixelType: FLOAT, xSampling: 1, ySampling: 1}
+	uint := channel{name: "C", pixelType: UINT, xSampling: 1, ySampling: 1}
+	sampled := channel{name: "D", pixelType: HALF, xSampling: 2, ySampling: 2}
+	cases := []struct {
+		name     string
+		channels chlist
+		w, h, y  int
+		zero     bool
+	}{
+		{"half", chlist{half}, 5, 3, 0, false},
+		{"all pixel types", chlist{half, float, uint}, 17, 32, 0, false},
+		{"subsampled from an odd line", chlist{half, sampled}, 6, 5, -3, false},
+		{"zeros without bitmap", chlist{half, float}, 4, 4, 0, true},
+	}
+	for _, c := range cases {
+		block := newBlockInfo(PIZ_COMPRESSION, c.channels, 0, c.y, c.w, c.h)
+		raw := make([]byte, block.rawSize())
+		if !c.zero {
+			for i := range raw {
+				raw[i] = byte(i*i/3) & 0x3f
+			}
+		}
+		compressed, err := pizCompress(block, raw)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		got, err := pizDecompress(block, compressed)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if !bytes.Equal(got, raw) {
+			t.Fatalf("%s: got %v, want %v", c.name, got, raw)
+		}
+	}
+}
+
+func TestPizCompressWrongSize(t *testing.T) {
+	block := newBlockInfo(PIZ_COMPRESSION, chlist{{name: "A", pixelType: HALF, xSampling: 1, ySampling: 1}}, 0, 0, 4, 2)
+	for _, n := range []int{block.rawSize() - 1, block.rawSize() + 2} {
+		if _, err := pizCompress(block, make([]byte, n)); err == nil {
+			t.Fatalf("raw data of %d bytes: want an error", n)
+		} else if _, ok := err.(FormatError); !ok {
+			t.Fatalf("raw data of %d bytes: got %T error, want FormatError", n, err)
+		}
+	}
+	if err := wav2Encode(make([]byte, 10), 3, 2, 2, 6, 0xffff); err == nil {
+		t.Fatalf("short wavelet data: want an error")
+	} else if _, ok := err.(FormatError); !ok {
+		t.Fatalf("short wavelet data: got %T error, want FormatError", err)
+	}
+}
+
+// pizChunk returns the block and compressed data of the first chunk in image/scanline.exr,
+// that is a piz compressed image.
+func pizChunk(t testing.TB) (blockInfo, []byte) {
+	b, err := ioutil.ReadFile("image/scanline.exr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := newDecoder(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := d.partInfo(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.compression != PIZ_COMPRESSION {
+		t.Fatalf("image/scanline.exr: got %v, want PIZ_COMPRESSION", info.compression)
+	}
+	c, err := d.readChunk(0, d.offsets[0][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := info.blockIndex(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := d.readData(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.blockInfo(n), data
+}
+
+func TestPizDecompressCorrupt(t *testing.T) {
+	block, data := pizChunk(t)
+	if _, err := pizDecompress(block, data); err != nil {
+		t.Fatal(err)
+	}
+	minNonZero := int(binary.LittleEndian.Uint16(data[0:]))
+	maxNonZero := int(binary.LittleEndian.Uint16(data[2:]))
+	lcOffset := 4 + maxNonZero - minNonZero + 1
+
+	// Truncated data shouldn't panic. Data without the huffman header should be an error.
+	step := len(data)/100 + 1
+	for n := 0; n < len(data); n += step {
+		_, err := pizDecompress(block, data[:n])
+		if err == nil && n < lcOffset+4+20 {
+			t.Fatalf("truncated to %d bytes: want an error", n)
+		}
+		if _, ok := err.(FormatError); err != nil && !ok {
+			t.Fatalf("truncated to %d bytes: got %T error, want FormatError", n, err)
+		}
+	}
+
+	cases := []struct {
+		name   string
+		offset int
+		value  uint32
+		size   int
+	}{
+		{"maxNonZero", 2, 0xFFFF, 2},
+		{"data length", lcOffset, 0xFFFFFFFF, 4},
+		{"huffman dMin", lcOffset + 4, 0xFFFF, 4},
+		{"huffman dMax", lcOffset + 8, 0xFFFFFFFF, 4},
+		{"huffman data bits", lcOffset + 16, 0x7FFFFFFF, 4},
+	}
+	for _, c := range cases {
+		b := append([]byte(nil), data...)
+		if c.size == 2 {
+			binary.LittleEndian.PutUint16(b[c.offset:], uint16(c.value))
+		} else {
+			binary.LittleEndian.PutUint32(b[c.offset:], c.value)
+		}
+		_, err := pizDecompress(block, b)
+		if _, ok := err.(FormatError); !ok {
+			t.Fatalf("%s: got error %v, want FormatError", c.name, err)
+		}
+	}
+}
+
+// pizSeed returns a small block, it's raw data and piz compressed data.
+// The raw data is taken from pizChunk, but the fuzzer is too slow with the whole chunk.
+func pizSeed(t testing.TB) (blockInfo, []byte, []byte) {
+	chunk, data := pizChunk(t)
+	full, err := pizDecompress(chunk, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := fuzzBlock(PIZ_COMPRESSION, 32, 4, 0, 0b11)
+	raw := full[:block.rawSize()]
+	compressed, err := pizCompress(block, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block, raw, compressed
+}
+
+func FuzzPizDecompress(f *testing.F) {
+	block, _, data := pizSeed(f)
+	f.Add(data)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		raw, err := pizDecompress(block, data)
+		if err != nil {
+			if _, ok := err.(FormatError); !ok {
+				t.Fatalf("got %T error, want FormatError: %v", err, err)
+			}
+			return
+		}
+		if len(raw) != block.rawSize() {
+			t.Fatalf("decompressed data has %d bytes, want %d", len(raw), block.rawSize())
+		}
+	})
+}
+
+// fuzzBlock returns a block of size w x h at line y, that has channels chosen by bits of chans.
+func fuzzBlock(c compression, w, h, y int, chans uint8) blockInfo {
+	all := chlist{
+		{name: "A", pixelType: HALF, xSampling: 1, ySampling: 1},
+		{name: "B", pixelType: FLOAT, xSampling: 1, ySampling: 1},
+		{name: "C", pixelType: UINT, xSampling: 1, ySampling: 1},
+		{name: "D", pixelType: HALF, xSampling: 2, ySampling: 2},
+	}
+	var channels chlist
+	for i, ch := range all {
+		if chans&(1<<i) != 0 {
+			channels = append(channels, ch)
+		}
+	}
+	if len(channels) == 0 {
+		channels = all[:1]
+	}
+	return newBlockInfo(c, channels, 0, y, w, h)
+}
+
+func FuzzPizRoundTrip(f *testing.F) {
+	_, raw, _ := pizSeed(f)
+	f.Add(raw, uint8(31), uint8(3), int8(0), uint8(0b11))
+	f.Add(raw, uint8(8), uint8(8), int8(1), uint8(0b1111))
+	f.Add([]byte{}, uint8(0), uint8(0), int8(0), uint8(1))
+	f.Add([]byte{0, 0, 0, 0}, uint8(2), uint8(1), int8(-3), uint8(0b1000))
+	f.Fuzz(func(t *testing.T, b []byte, w, h uint8, y int8, chans uint8) {
+		block := fuzzBlock(PIZ_COMPRESSION, 1+int(w)%64, 1+int(h)%32, int(y), chans)
+		raw := make([]byte, block.rawSize())
+		copy(raw, b)
+		compressed, err := pizCompress(block, raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := pizDecompress(block, compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, raw) {
+			t.Fatalf("got %v, want %v", got, raw)
+		}
+	})
+}
+
+func FuzzWaveletRoundTrip(f *testing.F) {
+	_, raw, _ := pizSeed(f)
+	f.Add(raw, uint8(31), false)
+	f.Add(raw, uint8(7), true)
+	f.Fuzz(func(t *testing.T, b []byte, w uint8, w14 bool) {
+		nx := 1 + int(w)%64
+		ny := len(b) / 2 / nx
+		if ny == 0 {
+			return
+		}
+		want := make([]byte, nx*ny*2)
+		copy(want, b)
+		mx := uint16(0)
+		for i := 0; i < len(want); i += 2 {
+			d := getUint16(want[i:])
+			if w14 {
+				// wavelet of 14 bit data is computed differently.
+				d &= 1<<14 - 1
+				setUint16(want[i:], d)
+			}
+			if d > mx {
+				mx = d
+			}
+		}
+		data := make([]byte, len(want))
+		copy(data, want)
+		if err := wav2Encode(data, nx, 2, ny, nx*2, mx); err != nil {
+			t.Fatal(err)
+		}
+		if err := wav2Decode(data, nx, 2, ny, nx*2, mx); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Fatalf("%dx%d data with max value %d: got %v, want %v", nx, ny, mx, data, want)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package exr
+
+import (
+	"image"
+	"math"
+)
+
+// previewWidth is default width of a preview image generated by the encoder.
+const previewWidth = 100
+
+// Preview returns the preview image (thumbnail) stored in the header.
+// ok is false if the header doesn't have the preview attribute, or it's broken.
+//
+// Pixels of the preview image are gamma encoded 8 bit values,
+// that are ready to display.
+func (h Header) Preview() (m *image.RGBA, ok bool) {
+	attr, ok := h["preview"]
+	if !ok {
+		return nil, false
+	}
+	p, err := previewFromBytes(attr.value)
+	if err != nil {
+		return nil, false
+	}
+	m = image.NewRGBA(image.Rect(0, 0, int(p.width), int(p.height)))
+	copy(m.Pix, p.data)
+	return m, true
+}
+
+// SetPreview sets the preview image (thumbnail) of the header.
+func (h Header) SetPreview(m *image.RGBA) {
+	b := m.Bounds()
+	p := preview{
+		width:  int32(b.Dx()),
+		height: int32(b.Dy()),
+		data:   make([]byte, 0, 4*b.Dx()*b.Dy()),
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := m.PixOffset(b.Min.X, y)
+		p.data = append(p.data, m.Pix[i:i+4*b.Dx()]...)
+	}
+	h.SetAttribute("preview", "preview", previewToBytes(p))
+}
+
+// makePreview makes a preview image that has width pw
+// from pixel values of r, g, b, a channels, in the same way with OpenEXR's makePreview.
+// Pixels of the preview image are point sampled, tone mapped, and gamma encoded.
+//
+// Pixel values of each channel should be stored line by line, from the top.
+// When a is nil, the image is considered as opaque.
+func makePreview(width, height int, aspect float32, r, g, b, a []float32, pw int) *image.RGBA {
+	if aspect <= 0 {
+		aspect = 1
+	}
+	ph := int(float32(height)/(float32(width)*aspect)*float32(pw) + 0.5)
+	if ph < 1 {
+		ph = 1
+	}
+	fx := float32(1)
+	if pw > 1 {
+		fx = float32(width-1) / float32(pw-1)
+	}
+	fy := float32(1)
+	if ph > 1 {
+		fy = float32(height-1) / float32(ph-1)
+	}
+	// exposure is 0
+	m := float32(math.Pow(2, 2.47393))
+
+	at := func(c []float32, i int) float32 {
+		if c == nil {
+			return 0
+		}
+		return c[i]
+	}
+	p := image.NewRGBA(image.Rect(0, 0, pw, ph))
+	for y := 0; y < ph; y++ {
+		for x := 0; x < pw; x++ {
+			i := int(float32(y)*fy+0.5)*width + int(float32(x)*fx+0.5)
+			alpha := float32(1)
+			if a != nil {
+				alpha = a[i]
+			}
+			o := p.PixOffset(x, y)
+			p.Pix[o+0] = previewGamma(at(r, i), m)
+			p.Pix[o+1] = previewGamma(at(g, i), m)
+			p.Pix[o+2] = previewGamma(at(b, i), m)
+			p.Pix[o+3] = uint8(clamp32(alpha*255, 0, 255) + 0.5)
+		}
+	}
+	return p
+}
+
+// previewGamma converts a pixel value to an 8 bit value with gamma correction.
+// Values brighter than 1 are compressed with a knee function.
+func previewGamma(v, m float32) uint8 {
+	x := v * m
+	if x < 0 || x != x {
+		x = 0
+	}
+	if x > 1 {
+		x = 1 + knee(x-1, 0.184874)
+	}
+	return uint8(clamp32(float32(math.Pow(float64(x), 0.4545))*84.66, 0, 255))
+}
+
+func knee(x, f float32) float32 {
+	return float32(math.Log(float64(x*f+1)) / float64(f))
+}
+
+func clamp32(v, min, max float32) float32 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,92 @@
+package exr
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestHeaderPreview(t *testing.T) {
+	headers, err := DecodeHeader("image/scanline.exr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := headers[0].Preview()
+	if !ok {
+		t.Fatal("image/scanline.exr should have a preview image")
+	}
+	if got, want := p.Bounds(), image.Rect(0, 0, 100, 98); got != want {
+		t.Fatalf("preview bounds: got %v, want %v", got, want)
+	}
+
+	h := make(Header)
+	h.SetPreview(p)
+	got, ok := h.Preview()
+	if !ok {
+		t.Fatal("header should have a preview image after SetPreview")
+	}
+	if !bytes.Equal(got.Pix, p.Pix) {
+		t.Fatal("preview image changed after SetPreview")
+	}
+}
+
+func TestPreviewGamma(t *testing.T) {
+	m := float32(5.55555)
+	cases := []struct {
+		v    float32
+		want uint8
+	}{
+		{v: -1, want: 0},
+		{v: 0, want: 0},
+		{v: 0.18, want: 84},
+		{v: 1, want: 164},
+		{v: 1000, want: 255},
+	}
+	for _, c := range cases {
+		got := previewGamma(c.v, m)
+		if got != c.want {
+			t.Fatalf("previewGamma(%v): got %d, want %d", c.v, got, c.want)
+		}
+	}
+}
+
+func TestEncodePreview(t *testing.T) {
+	m := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			m.Set(x, y, color.Black)
+		}
+		for x := 100; x < 200; x++ {
+			m.Set(x, y, color.White)
+		}
+	}
+	buf := new(bytes.Buffer)
+	err := Encode(buf, m, &Options{Preview: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(buf)
+	vf, err := readVersion(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, err := readHeaders(r, vf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := headers[0].Preview()
+	if !ok {
+		t.Fatal("encoded image should have a preview image")
+	}
+	if got, want := p.Bounds(), image.Rect(0, 0, 100, 50); got != want {
+		t.Fatalf("preview bounds: got %v, want %v", got, want)
+	}
+	if got, want := p.RGBAAt(0, 0), (color.RGBA{0, 0, 0, 255}); got != want {
+		t.Fatalf("preview color at (0, 0): got %v, want %v", got, want)
+	}
+	if got, want := p.RGBAAt(99, 49), (color.RGBA{164, 164, 164, 255}); got != want {
+		t.Fatalf("preview color at (99, 49): got %v, want %v", got, want)
+	}
+}
@@ -135,32 +135,27 @@ func newBitReader(data []byte, n int) *bitReader {
 // If n % 8 != 0, returned slice's last byte contains left-aligned bits.
 // For example, if n == 9, returned slices is [oooooooo oxxxxxxx]
 // where o is meaningful, and x is meaningless bit. (all x should be 0)
-// If n is larger than number of remaining bits, still it will return
-// bytes for n bits with unreadable bits are filled with 0.
-//
-// Reader's Remain function can be used to validate returned data.
-func (r *bitReader) Read(n int) []byte {
+// If n is negative or larger than number of remaining bits,
+// it returns a FormatError without reading anything.
+func (r *bitReader) Read(n int) ([]byte, error) {
 	if n < 0 {
-		panic(fmt.Sprintf("invalid number of bits to read: %d", n))
+		return nil, FormatError(fmt.Sprintf("invalid number of bits to read: %d", n))
+	}
+	if n > r.Remain() || r.i+n > len(r.data)*8 {
+		return nil, FormatError(fmt.Sprintf("tried to read %d bits, but only %d bits are remaining", n, r.Remain()))
 	}
 	if n == 0 {
-		return []byte{}
+		return []byte{}, nil
 	}
 	// nhead is number of heading bits to clip.
 	nhead := r.i % 8
 	// buf is the reader's data zone we are interested.
 	min := r.i / 8
 	r.i += n
-	if r.i > r.n || r.i > len(r.data)*8 {
-		r.i = r.n
-	}
 	max := r.i / 8
 	if r.i%8 != 0 {
 		max++
 	}
-	if max > len(r.data) {
-		max = len(r.data)
-	}
 	buf := r.data[min:max]
 	// buf is shifted (unless nhead is 0),
 	// un-shift while writing it to output bytes.
@@ -184,7 +179,7 @@ func (r *bitReader) Read(n int) []byte {
 		c = out[len(out)-1]
 		out[len(out)-1] = (c >> ntrail) << ntrail
 	}
-	return out
+	return out, nil
 }
 
 func (r *bitReader) Seek(to int) {
@@ -192,7 +187,6 @@ func (r *bitReader) Seek(to int) {
 }
 
 // Remain returns number of remaining bits in the reader.
-// If it reads more than it have, it will return a negative number.
 func (r *bitReader) Remain() int {
 	return r.n - r.i
 }
@@ -232,25 +226,25 @@ func newBitWriter(n int) *bitWriter {
 // Write writes n bits to Writer.
 //
 // If n == 0, it does nothing.
-// If n < 0, it panics.
-// If n is greater than the writer's remaining buffer, it will panic.
-// If n is greater than size of input bytes, it will panic.
+// If n < 0, it returns an error.
+// If n is greater than the writer's remaining buffer, it returns an error.
+// If n is greater than size of input bytes, it returns an error.
 // If n % 8 != 0, trailing bytes and bits are discarded.
 //
 // Writer's Remain function can be used to check number of bits are remaining
 // in the writer's data buffer.
-func (w *bitWriter) Write(n int, bs []byte) {
+func (w *bitWriter) Write(n int, bs []byte) error {
 	if n == 0 {
-		return
+		return nil
 	}
 	if n < 0 {
-		panic(fmt.Sprintf("invalid number of bits to write: %d", n))
+		return fmt.Errorf("invalid number of bits to write: %d", n)
 	}
 	if n > len(bs)*8 {
-		panic(fmt.Sprintf("tried to write more bits than the input bytes offer"))
+		return fmt.Errorf("tried to write %d bits, but the input bytes offer only %d bits", n, len(bs)*8)
 	}
 	if n > w.n-w.i {
-		panic(fmt.Sprintf("tried to write more bits than the writer can have"))
+		return fmt.Errorf("tried to write %d bits, but the writer can have only %d bits more", n, w.n-w.i)
 	}
 	// discard trailing bytes and bits which is not for this writing
 	nbyte := n / 8
@@ -274,6 +268,7 @@ func (w *bitWriter) Write(n int, bs []byte) {
 		i += 8
 	}
 	w.i = w.i + n
+	return nil
 }
 
 // Data returns the writer's data written so far.
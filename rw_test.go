@@ -39,27 +39,16 @@ func TestBitReader(t *testing.T) {
 				[]byte{0b00110011, 0b01010101},
 			},
 		},
-		{
-			// read more than the reader have
-			nreads: []int{50},
-			want: [][]byte{
-				[]byte{
-					0b00000000,
-					0b11111111,
-					0b00001111,
-					0b00110011,
-					0b01010101,
-					0b00000000,
-					0b00000000,
-				},
-			},
-		},
 	}
 	for i, c := range cases {
 		r.Seek(0)
 		got := make([][]byte, 0)
 		for _, n := range c.nreads {
-			got = append(got, r.Read(n))
+			b, err := r.Read(n)
+			if err != nil {
+				t.Fatalf("read[%d]: %v", i, err)
+			}
+			got = append(got, b)
 		}
 		n := r.Remain()
 		if n != 0 {
@@ -71,6 +60,64 @@ func TestBitReader(t *testing.T) {
 	}
 }
 
+func FuzzBitReader(f *testing.F) {
+	f.Add([]byte{0b00000000, 0b11111111, 0b00001111, 0b00110011, 0b01010101}, 40, []byte{6, 6, 6, 6, 6, 6, 4})
+	f.Add([]byte{0b11111111, 0b00001111}, 16, []byte{10, 7, 50, 0xff})
+	f.Fuzz(func(t *testing.T, data []byte, nBits int, reads []byte) {
+		r := newBitReader(data, nBits)
+		i := 0 // bit index of the reader, that is tracked independently
+		for _, c := range reads {
+			n := int(int8(c))
+			remain := r.Remain()
+			b, err := r.Read(n)
+			if err != nil {
+				if _, ok := err.(FormatError); !ok {
+					t.Fatalf("read %d bits: got %T error, want FormatError: %v", n, err, err)
+				}
+				if r.Remain() != remain {
+					t.Fatalf("read %d bits: failed read moved the reader", n)
+				}
+				continue
+			}
+			if i+n > nBits || i+n > len(data)*8 {
+				t.Fatalf("read %d bits at %d: want an error, data has %d bits", n, i, nBits)
+			}
+			if len(b) != (n+7)/8 {
+				t.Fatalf("read %d bits: got %d bytes", n, len(b))
+			}
+			for j := 0; j < len(b)*8; j++ {
+				got := b[j/8] >> (7 - j%8) & 1
+				want := byte(0)
+				if j < n {
+					want = data[(i+j)/8] >> (7 - (i+j)%8) & 1
+				}
+				if got != want {
+					t.Fatalf("read %d bits at %d: bit %d: got %d, want %d", n, i, j, got, want)
+				}
+			}
+			i += n
+			if r.Remain() != remain-n {
+				t.Fatalf("read %d bits: %d bits are remaining, want %d", n, r.Remain(), remain-n)
+			}
+		}
+	})
+}
+
+func TestBitReaderOverRead(t *testing.T) {
+	r := newBitReader([]byte{0b11111111, 0b00001111}, 16)
+	if _, err := r.Read(10); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{7, 50, -1} {
+		if _, err := r.Read(n); err == nil {
+			t.Fatalf("read %d bits: want an error", n)
+		}
+	}
+	if n := r.Remain(); n != 6 {
+		t.Fatalf("failed reads should not move the reader: %d bits are remaining, want 6", n)
+	}
+}
+
 type bitSlice struct {
 	n int
 	b []byte
@@ -136,7 +183,9 @@ func TestBitWriter(t *testing.T) {
 	for i, c := range cases {
 		w := newBitWriter(40)
 		for _, b := range c.bits {
-			w.Write(b.n, b.b)
+			if err := w.Write(b.n, b.b); err != nil {
+				t.Fatalf("write[%d]: %v", i, err)
+			}
 		}
 		n := w.Remain()
 		if n != 0 {
@@ -0,0 +1,153 @@
+package exr
+
+import "image"
+
+// Channels could be subsampled in x and y direction, such as chroma channels.
+// A channel that has x sampling rate sx and y sampling rate sy has samples
+// only at pixels (x, y) where x % sx == 0 and y % sy == 0.
+//
+// Pixel values of a subsampled channel are stored at it's native resolution.
+// The sample at pixel (x, y) has coordinate (x / sx, y / sy) in the channel.
+
+// divp returns x / y rounded towards negative infinity. y should be positive.
+func divp(x, y int) int {
+	if x >= 0 {
+		return x / y
+	}
+	return -((y - 1 - x) / y)
+}
+
+// modp returns x - y * divp(x, y). y should be positive.
+func modp(x, y int) int {
+	return x - y*divp(x, y)
+}
+
+// numSamples returns number of samples of a channel that has sampling rate s,
+// between coordinate a and b (inclusive).
+func numSamples(s, a, b int) int {
+	if s <= 1 {
+		return b - a + 1
+	}
+	a1 := divp(a, s)
+	b1 := divp(b, s)
+	n := b1 - a1
+	if a1*s >= a {
+		n++
+	}
+	return n
+}
+
+// sampledRect returns the rectangle in a channel's coordinate,
+// that covers samples in r (in image coordinate).
+func sampledRect(r image.Rectangle, xSampling, ySampling int) image.Rectangle {
+	if xSampling < 1 {
+		xSampling = 1
+	}
+	if ySampling < 1 {
+		ySampling = 1
+	}
+	return image.Rect(
+		divp(r.Min.X+xSampling-1, xSampling),
+		divp(r.Min.Y+ySampling-1, ySampling),
+		divp(r.Max.X-1, xSampling)+1,
+		divp(r.Max.Y-1, ySampling)+1,
+	)
+}
+
+// sampling returns x and y sampling rates of the channel.
+func (c *Channel) sampling() (int, int) {
+	sx, sy := c.XSampling, c.YSampling
+	if sx < 1 {
+		sx = 1
+	}
+	if sy < 1 {
+		sy = 1
+	}
+	return sx, sy
+}
+
+// sampleAt returns pixel value of the channel at (x, y) in image coordinate.
+// For a subsampled channel, it returns the nearest sample on the upper left.
+func (c *Channel) sampleAt(x, y int) float32 {
+	sx, sy := c.sampling()
+	return c.FloatAt(divp(x, sx), divp(y, sy))
+}
+
+// Upsample returns a channel that has pixel values in rect (in image coordinate),
+// upsampled from the subsampled channel c.
+//
+// HALF and FLOAT channels are linearly interpolated between samples.
+// UINT channels, such as object IDs, take the nearest sample on the upper left.
+// When c isn't subsampled, it returns c itself.
+func (c *Channel) Upsample(rect image.Rectangle) *Channel {
+	sx, sy := c.sampling()
+	if sx == 1 && sy == 1 {
+		return c
+	}
+	u := newChannel(channel{
+		name:      c.Name,
+		pixelType: c.Type,
+		xSampling: 1,
+		ySampling: 1,
+	}, rect)
+	u.PLinear = c.PLinear
+	if c.Rect.Empty() {
+		return u
+	}
+	// clampX and clampY clamp sample coordinates in bounds of the channel.
+	clampX := func(x int) int {
+		if x < c.Rect.Min.X {
+			return c.Rect.Min.X
+		}
+		if x >= c.Rect.Max.X {
+			return c.Rect.Max.X - 1
+		}
+		return x
+	}
+	clampY := func(y int) int {
+		if y < c.Rect.Min.Y {
+			return c.Rect.Min.Y
+		}
+		if y >= c.Rect.Max.Y {
+			return c.Rect.Max.Y - 1
+		}
+		return y
+	}
+	i := 0
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		y0 := divp(y, sy)
+		ty := float32(modp(y, sy)) / float32(sy)
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			x0 := divp(x, sx)
+			if c.Type == UINT {
+				u.Uint[i] = c.Uint[c.PixOffset(clampX(x0), clampY(y0))]
+				i++
+				continue
+			}
+			tx := float32(modp(x, sx)) / float32(sx)
+			v00 := c.Float[c.PixOffset(clampX(x0), clampY(y0))]
+			v01 := c.Float[c.PixOffset(clampX(x0+1), clampY(y0))]
+			v10 := c.Float[c.PixOffset(clampX(x0), clampY(y0+1))]
+			v11 := c.Float[c.PixOffset(clampX(x0+1), clampY(y0+1))]
+			v0 := v00 + (v01-v00)*tx
+			v1 := v10 + (v11-v10)*tx
+			u.Float[i] = v0 + (v1-v0)*ty
+			i++
+		}
+	}
+	return u
+}
+
+// Upsample returns an image those subsampled channels are upsampled
+// to the full resolution. Channels that aren't subsampled are shared with m.
+func (m *Image) Upsample() *Image {
+	u := &Image{
+		Header:   m.Header,
+		Rect:     m.Rect,
+		Channels: make([]*Channel, len(m.Channels)),
+	}
+	for i, c := range m.Channels {
+		u.Channels[i] = c.Upsample(m.Rect)
+	}
+	return u
+}
@@ -0,0 +1,92 @@
+package exr
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNumSamples(t *testing.T) {
+	cases := []struct {
+		s, a, b int
+		want    int
+	}{
+		{s: 1, a: 0, b: 9, want: 10},
+		{s: 2, a: 0, b: 9, want: 5},
+		{s: 2, a: 1, b: 9, want: 4},
+		{s: 2, a: -3, b: 2, want: 3},
+		{s: 3, a: -3, b: -1, want: 1},
+		{s: 2, a: 3, b: 3, want: 0},
+	}
+	for _, c := range cases {
+		got := numSamples(c.s, c.a, c.b)
+		if got != c.want {
+			t.Fatalf("numSamples(%d, %d, %d): got %d, want %d", c.s, c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestSubsampledChannels(t *testing.T) {
+	rect := image.Rect(-2, 0, 4, 4)
+	y := &Channel{Name: "Y", Type: HALF, Rect: rect, Float: make([]float32, 6*4)}
+	for i := range y.Float {
+		y.Float[i] = float32(i)
+	}
+	// 2x2 subsampled channels have 3x2 samples.
+	ry := &Channel{Name: "RY", Type: HALF, XSampling: 2, YSampling: 2, Rect: image.Rect(-1, 0, 2, 2), Float: []float32{0, 2, 4, 8, 10, 12}}
+	id := &Channel{Name: "id", Type: UINT, XSampling: 2, YSampling: 1, Rect: image.Rect(-1, 0, 2, 4), Uint: []uint32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}}
+	want := &Image{
+		Header:   make(Header),
+		Rect:     rect,
+		Channels: []*Channel{ry, y, id},
+	}
+	path := encodeTemp(t, want, nil)
+	defer os.RemoveAll(filepath.Dir(path))
+	m, err := Decode(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := m.(*Image)
+	for _, wc := range want.Channels {
+		gc := got.Channel(wc.Name)
+		if gc == nil {
+			t.Fatalf("channel %q not found", wc.Name)
+		}
+		if gc.Rect != wc.Rect {
+			t.Fatalf("channel %q: bounds: got %v, want %v", wc.Name, gc.Rect, wc.Rect)
+		}
+		for y := wc.Rect.Min.Y; y < wc.Rect.Max.Y; y++ {
+			for x := wc.Rect.Min.X; x < wc.Rect.Max.X; x++ {
+				if g, w := gc.FloatAt(x, y), wc.FloatAt(x, y); g != w {
+					t.Fatalf("channel %q at (%d, %d): got %v, want %v", wc.Name, x, y, g, w)
+				}
+			}
+		}
+	}
+
+	u := got.Upsample()
+	upsampled := []struct {
+		name string
+		x, y int
+		want float32
+	}{
+		{"RY", -2, 0, 0},
+		{"RY", -1, 0, 1},
+		{"RY", 0, 1, 6},
+		{"RY", 1, 1, 7},
+		{"RY", 3, 3, 12}, // clamped at the edge
+		{"id", -1, 0, 1},
+		{"id", 1, 2, 8},
+		{"Y", 3, 3, 23},
+	}
+	for _, c := range upsampled {
+		ch := u.Channel(c.name)
+		if ch.Rect != rect {
+			t.Fatalf("upsampled channel %q: bounds: got %v, want %v", c.name, ch.Rect, rect)
+		}
+		if got := ch.FloatAt(c.x, c.y); got != c.want {
+			t.Fatalf("upsampled channel %q at (%d, %d): got %v, want %v", c.name, c.x, c.y, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+package exr
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+	"time"
+)
+
+// Standard attributes are optional attributes defined by OpenEXR,
+// those have well known names and types. Getters return ok false when
+// the header doesn't have the attribute, or it has a different type.
+// Setters check the value when the attribute has a valid range.
+//
+// chromaticities, envmap and multiView attributes are handled by
+// Chromaticities, Envmap and MultiView methods.
+
+// stringAttribute returns the named string attribute.
+func (h Header) stringAttribute(name string) (string, bool) {
+	attr, ok := h[name]
+	if !ok || attr.typ != "string" {
+		return "", false
+	}
+	return string(attr.value), true
+}
+
+// setFloatInRange sets the named float attribute, when v is in [min, max].
+func (h Header) setFloatInRange(name string, v float32, min, max float64) error {
+	if v != v || float64(v) < min || float64(v) > max {
+		return fmt.Errorf("exr: %s out of range [%v, %v]: %v", name, min, max, v)
+	}
+	h.SetFloat(name, v)
+	return nil
+}
+
+// Owner returns the owner attribute, that is the name of the owner of the image.
+func (h Header) Owner() (string, bool) {
+	return h.stringAttribute("owner")
+}
+
+// SetOwner sets the owner attribute.
+func (h Header) SetOwner(v string) {
+	h.SetString("owner", v)
+}
+
+// Comments returns the comments attribute, that is additional information about the image.
+func (h Header) Comments() (string, bool) {
+	return h.stringAttribute("comments")
+}
+
+// SetComments sets the comments attribute.
+func (h Header) SetComments(v string) {
+	h.SetString("comments", v)
+}
+
+// capDateLayout is the layout of the capDate attribute for time.Parse.
+const capDateLayout = "2006:01:02 15:04:05"
+
+// CapDate returns the capDate attribute, that is the date when the image was
+// created or captured, in local time. It has "YYYY:MM:DD hh:mm:ss" form.
+func (h Header) CapDate() (string, bool) {
+	return h.stringAttribute("capDate")
+}
+
+// SetCapDate sets the capDate attribute. It returns an error when v
+// is not a valid date of "YYYY:MM:DD hh:mm:ss" form.
+func (h Header) SetCapDate(v string) error {
+	if _, err := time.Parse(capDateLayout, v); err != nil {
+		return fmt.Errorf("exr: invalid capDate %q: want \"YYYY:MM:DD hh:mm:ss\"", v)
+	}
+	h.SetString("capDate", v)
+	return nil
+}
+
+// CaptureTime returns the time when the image was captured,
+// from the capDate and utcOffset attributes. The time is in a zone of the offset.
+// It is in UTC when the header doesn't have the utcOffset attribute.
+// ok is false when the header doesn't have a valid capDate attribute.
+func (h Header) CaptureTime() (t time.Time, ok bool) {
+	v, ok := h.CapDate()
+	if !ok {
+		return time.Time{}, false
+	}
+	loc := time.UTC
+	if off, ok := h.UTCOffset(); ok {
+		// UTC = local time + utcOffset
+		loc = time.FixedZone("", -int(off))
+	}
+	t, err := time.ParseInLocation(capDateLayout, v, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// SetCaptureTime sets the capDate and utcOffset attributes from t.
+func (h Header) SetCaptureTime(t time.Time) {
+	_, off := t.Zone()
+	h.SetString("capDate", t.Format(capDateLayout))
+	h.SetFloat("utcOffset", float32(-off))
+}
+
+// UTCOffset returns the utcOffset attribute, that is the offset of local time
+// of capDate from UTC, in seconds. UTC is local time + utcOffset.
+func (h Header) UTCOffset() (float32, bool) {
+	return h.floatAttribute("utcOffset")
+}
+
+// SetUTCOffset sets the utcOffset attribute. It should be in a day.
+func (h Header) SetUTCOffset(v float32) error {
+	return h.setFloatInRange("utcOffset", v, -86400, 86400)
+}
+
+// Longitude returns the longitude attribute, that is the location where the image
+// was captured, in degrees east of Greenwich.
+func (h Header) Longitude() (float32, bool) {
+	return h.floatAttribute("longitude")
+}
+
+// SetLongitude sets the longitude attribute. It should be in [-180, 180].
+func (h Header) SetLongitude(v float32) error {
+	return h.setFloatInRange("longitude", v, -180, 180)
+}
+
+// Latitude returns the latitude attribute, that is the location where the image
+// was captured, in degrees north of the equator.
+func (h Header) Latitude() (float32, bool) {
+	return h.floatAttribute("latitude")
+}
+
+// SetLatitude sets the latitude attribute. It should be in [-90, 90].
+func (h Header) SetLatitude(v float32) error {
+	return h.setFloatInRange("latitude", v, -90, 90)
+}
+
+// Altitude returns the altitude attribute, that is the location where the image
+// was captured, in meters above sea level.
+func (h Header) Altitude() (float32, bool) {
+	return h.floatAttribute("altitude")
+}
+
+// SetAltitude sets the altitude attribute.
+func (h Header) SetAltitude(v float32) error {
+	return h.setFloatInRange("altitude", v, -math.MaxFloat32, math.MaxFloat32)
+}
+
+// Focus returns the focus attribute, that is the camera's focus distance in meters.
+func (h Header) Focus() (float32, bool) {
+	return h.floatAttribute("focus")
+}
+
+// SetFocus sets the focus attribute. It should not be negative, and could be infinity.
+func (h Header) SetFocus(v float32) error {
+	return h.setFloatInRange("focus", v, 0, math.Inf(1))
+}
+
+// ExpTime returns the expTime attribute, that is the exposure time in seconds.
+func (h Header) ExpTime() (float32, bool) {
+	return h.floatAttribute("expTime")
+}
+
+// SetExpTime sets the expTime attribute. It should not be negative.
+func (h Header) SetExpTime(v float32) error {
+	return h.setFloatInRange("expTime", v, 0, math.MaxFloat32)
+}
+
+// Aperture returns the aperture attribute, that is the camera's lens aperture in f-number.
+func (h Header) Aperture() (float32, bool) {
+	return h.floatAttribute("aperture")
+}
+
+// SetAperture sets the aperture attribute. It should be positive.
+func (h Header) SetAperture(v float32) error {
+	return h.setFloatInRange("aperture", v, math.SmallestNonzeroFloat32, math.MaxFloat32)
+}
+
+// ISOSpeed returns the isoSpeed attribute, that is the ISO speed of the film or sensor.
+func (h Header) ISOSpeed() (float32, bool) {
+	return h.floatAttribute("isoSpeed")
+}
+
+// SetISOSpeed sets the isoSpeed attribute. It should be positive.
+func (h Header) SetISOSpeed(v float32) error {
+	return h.setFloatInRange("isoSpeed", v, math.SmallestNonzeroFloat32, math.MaxFloat32)
+}
+
+// WhiteLuminance returns the whiteLuminance attribute, that is the luminance
+// in candelas per square meter of white (1, 1, 1) pixels.
+func (h Header) WhiteLuminance() (float32, bool) {
+	return h.floatAttribute("whiteLuminance")
+}
+
+// SetWhiteLuminance sets the whiteLuminance attribute. It should be positive.
+func (h Header) SetWhiteLuminance(v float32) error {
+	return h.setFloatInRange("whiteLuminance", v, math.SmallestNonzeroFloat32, math.MaxFloat32)
+}
+
+// XDensity returns the xDensity attribute, that is the horizontal output density
+// in pixels per inch. The vertical density is xDensity * pixelAspectRatio.
+func (h Header) XDensity() (float32, bool) {
+	return h.floatAttribute("xDensity")
+}
+
+// SetXDensity sets the xDensity attribute. It should be positive.
+func (h Header) SetXDensity(v float32) error {
+	return h.setFloatInRange("xDensity", v, math.SmallestNonzeroFloat32, math.MaxFloat32)
+}
+
+// DWACompressionLevel returns the dwaCompressionLevel attribute,
+// that is the quality level of DWAA and DWAB compressions.
+func (h Header) DWACompressionLevel() (float32, bool) {
+	return h.floatAttribute("dwaCompressionLevel")
+}
+
+// SetDWACompressionLevel sets the dwaCompressionLevel attribute. It should not be negative.
+func (h Header) SetDWACompressionLevel(v float32) error {
+	return h.setFloatInRange("dwaCompressionLevel", v, 0, math.MaxFloat32)
+}
+
+// AdoptedNeutral returns the adoptedNeutral attribute, that is the CIE (x, y)
+// coordinates of the color, that should be displayed as neutral.
+func (h Header) AdoptedNeutral() (x, y float32, ok bool) {
+	attr, ok := h["adoptedNeutral"]
+	if !ok || attr.typ != "v2f" {
+		return 0, 0, false
+	}
+	v, err := v2fFromBytes(attr.value)
+	if err != nil {
+		return 0, 0, false
+	}
+	return v[0], v[1], true
+}
+
+// SetAdoptedNeutral sets the adoptedNeutral attribute.
+func (h Header) SetAdoptedNeutral(x, y float32) {
+	h.SetAttribute("adoptedNeutral", "v2f", v2fToBytes(v2f{x, y}))
+}
+
+// RenderingTransform returns the renderingTransform attribute, that is the name
+// of a CTL function, that transforms the image for display.
+func (h Header) RenderingTransform() (string, bool) {
+	return h.stringAttribute("renderingTransform")
+}
+
+// SetRenderingTransform sets the renderingTransform attribute.
+func (h Header) SetRenderingTransform(v string) {
+	h.SetString("renderingTransform", v)
+}
+
+// LookModTransform returns the lookModTransform attribute, that is the name
+// of a CTL function, that applies a look modification to the image.
+func (h Header) LookModTransform() (string, bool) {
+	return h.stringAttribute("lookModTransform")
+}
+
+// SetLookModTransform sets the lookModTransform attribute.
+func (h Header) SetLookModTransform(v string) {
+	h.SetString("lookModTransform", v)
+}
+
+// wrapModes are the valid wrap modes of the wrapmodes attribute.
+var wrapModes = []string{"black", "clamp", "periodic", "mirror"}
+
+// Wrapmodes returns the wrapmodes attribute, that tells how texture lookups
+// out of the data window are handled. It has a wrap mode, or wrap modes of
+// horizontal and vertical direction separated by a comma, such as "clamp,periodic".
+func (h Header) Wrapmodes() (string, bool) {
+	return h.stringAttribute("wrapmodes")
+}
+
+// SetWrapmodes sets the wrapmodes attribute. Wrap modes should be one of
+// black, clamp, periodic or mirror.
+func (h Header) SetWrapmodes(v string) error {
+	modes := strings.Split(v, ",")
+	if len(modes) > 2 {
+		return fmt.Errorf("exr: invalid wrapmodes %q: want at most 2 wrap modes", v)
+	}
+	for _, m := range modes {
+		valid := false
+		for _, w := range wrapModes {
+			if m == w {
+				valid = true
+			}
+		}
+		if !valid {
+			return fmt.Errorf("exr: invalid wrapmodes %q: unknown wrap mode %q", v, m)
+		}
+	}
+	h.SetString("wrapmodes", v)
+	return nil
+}
+
+// Rational is a rational number N/D.
+type Rational struct {
+	N int32
+	D uint32
+}
+
+// Float64 returns the value of the rational number.
+func (r Rational) Float64() float64 {
+	return float64(r.N) / float64(r.D)
+}
+
+// FramesPerSecond returns the framesPerSecond attribute, that is the playback
+// frame rate of an image sequence, such as 24000/1001.
+func (h Header) FramesPerSecond() (Rational, bool) {
+	attr, ok := h["framesPerSecond"]
+	if !ok || attr.typ != "rational" {
+		return Rational{}, false
+	}
+	r, err := rationalFromBytes(attr.value)
+	if err != nil {
+		return Rational{}, false
+	}
+	return Rational{N: r.a, D: r.b}, true
+}
+
+// SetFramesPerSecond sets the framesPerSecond attribute. It should be positive.
+func (h Header) SetFramesPerSecond(r Rational) error {
+	if r.N <= 0 || r.D == 0 {
+		return fmt.Errorf("exr: invalid framesPerSecond %d/%d: want a positive rate", r.N, r.D)
+	}
+	h.SetAttribute("framesPerSecond", "rational", rationalToBytes(rational{a: r.N, b: r.D}))
+	return nil
+}
+
+// m44fAttribute returns the named m44f attribute.
+func (h Header) m44fAttribute(name string) ([16]float32, bool) {
+	attr, ok := h[name]
+	if !ok || attr.typ != "m44f" {
+		return [16]float32{}, false
+	}
+	m, err := m44fFromBytes(attr.value)
+	if err != nil {
+		return [16]float32{}, false
+	}
+	return m, true
+}
+
+// WorldToCamera returns the worldToCamera attribute, that transforms points
+// from the world space to the camera space of a rendered image. Elements are
+// in row major order, and a point is transformed as a row vector multiplied by it.
+func (h Header) WorldToCamera() ([16]float32, bool) {
+	return h.m44fAttribute("worldToCamera")
+}
+
+// SetWorldToCamera sets the worldToCamera attribute.
+func (h Header) SetWorldToCamera(m [16]float32) {
+	h.SetAttribute("worldToCamera", "m44f", m44fToBytes(m))
+}
+
+// WorldToNDC returns the worldToNDC attribute, that transforms points
+// from the world space to the normalized device coordinate space of a rendered image,
+// in the same form with WorldToCamera.
+func (h Header) WorldToNDC() ([16]float32, bool) {
+	return h.m44fAttribute("worldToNDC")
+}
+
+// SetWorldToNDC sets the worldToNDC attribute.
+func (h Header) SetWorldToNDC(m [16]float32) {
+	h.SetAttribute("worldToNDC", "m44f", m44fToBytes(m))
+}
+
+// TimeCode returns the timeCode attribute, that is the time code of the image.
+// The fields could be out of their ranges in a broken file. Use Validate to check them.
+func (h Header) TimeCode() (Timecode, bool) {
+	return h.timecodeAttribute("timeCode")
+}
+
+// SetTimeCode sets the timeCode attribute.
+// It returns an error when the fields are out of their ranges.
+func (h Header) SetTimeCode(tc Timecode) error {
+	if err := tc.Validate(); err != nil {
+		return err
+	}
+	h.SetAttribute("timeCode", "timecode", timecodeToBytes(tc.pack()))
+	return nil
+}
+
+// KeyCode returns the keyCode attribute, that identifies the film frame of the image.
+// The fields could be out of their ranges in a broken file. Use Validate to check them.
+func (h Header) KeyCode() (Keycode, bool) {
+	return h.keycodeAttribute("keyCode")
+}
+
+// SetKeyCode sets the keyCode attribute.
+// It returns an error when the fields are out of their ranges.
+func (h Header) SetKeyCode(k Keycode) error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
+	h.SetAttribute("keyCode", "keycode", keycodeToBytes(k.pack()))
+	return nil
+}
+
+// OriginalDataWindow returns the originalDataWindow attribute, that is the data window
+// of the image before it was cropped, such as by removing empty pixels.
+func (h Header) OriginalDataWindow() (image.Rectangle, bool) {
+	return h.box2iAttribute("originalDataWindow")
+}
+
+// SetOriginalDataWindow sets the originalDataWindow attribute.
+func (h Header) SetOriginalDataWindow(r image.Rectangle) {
+	h.SetAttribute("originalDataWindow", "box2i", box2iToBytes(box2iFromRect(r)))
+}
+
+type deepImageState uint8
+
+const (
+	DEEPIMAGESTATE_MESSY = deepImageState(iota)
+	DEEPIMAGESTATE_SORTED
+	DEEPIMAGESTATE_NON_OVERLAPPING
+	DEEPIMAGESTATE_TIDY
+)
+
+func (s deepImageState) String() string {
+	switch s {
+	case DEEPIMAGESTATE_MESSY:
+		return "DEEPIMAGESTATE_MESSY"
+	case DEEPIMAGESTATE_SORTED:
+		return "DEEPIMAGESTATE_SORTED"
+	case DEEPIMAGESTATE_NON_OVERLAPPING:
+		return "DEEPIMAGESTATE_NON_OVERLAPPING"
+	case DEEPIMAGESTATE_TIDY:
+		return "DEEPIMAGESTATE_TIDY"
+	default:
+		return "UNKNOWN_DEEPIMAGESTATE"
+	}
+}
+
+// DeepImageState returns the deepImageState attribute, that tells whether samples
+// of a deep image are sorted and overlapping.
+func (h Header) DeepImageState() (deepImageState, bool) {
+	attr, ok := h["deepImageState"]
+	if !ok || attr.typ != "deepImageState" || len(attr.value) != 1 {
+		return 0, false
+	}
+	return deepImageState(attr.value[0]), true
+}
+
+// SetDeepImageState sets the deepImageState attribute.
+func (h Header) SetDeepImageState(s deepImageState) error {
+	if s > DEEPIMAGESTATE_TIDY {
+		return fmt.Errorf("exr: unknown deepImageState: %d", s)
+	}
+	h.SetAttribute("deepImageState", "deepImageState", []byte{byte(s)})
+	return nil
+}
@@ -0,0 +1,177 @@
+package exr
+
+import (
+	"image"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStandardAttributes(t *testing.T) {
+	h := make(Header)
+	if _, ok := h.Owner(); ok {
+		t.Fatalf("got a missing owner attribute")
+	}
+	h.SetOwner("coldmine")
+	h.SetComments("test image")
+	h.SetRenderingTransform("transform_RRT")
+	h.SetLookModTransform("look_warm")
+	h.SetAdoptedNeutral(0.3127, 0.329)
+	h.SetOriginalDataWindow(image.Rect(-1, -2, 3, 4))
+	m := [16]float32{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 5, 6, 7, 1}
+	h.SetWorldToCamera(m)
+	h.SetWorldToNDC(m)
+
+	strs := []struct {
+		name string
+		get  func() (string, bool)
+		want string
+	}{
+		{"owner", h.Owner, "coldmine"},
+		{"comments", h.Comments, "test image"},
+		{"renderingTransform", h.RenderingTransform, "transform_RRT"},
+		{"lookModTransform", h.LookModTransform, "look_warm"},
+	}
+	for _, c := range strs {
+		if got, ok := c.get(); !ok || got != c.want {
+			t.Fatalf("%s: got %q (%v), want %q", c.name, got, ok, c.want)
+		}
+	}
+	if x, y, ok := h.AdoptedNeutral(); !ok || x != 0.3127 || y != 0.329 {
+		t.Fatalf("adoptedNeutral: got (%v, %v) (%v)", x, y, ok)
+	}
+	if r, ok := h.OriginalDataWindow(); !ok || r != image.Rect(-1, -2, 3, 4) {
+		t.Fatalf("originalDataWindow: got %v (%v)", r, ok)
+	}
+	if got, ok := h.WorldToCamera(); !ok || got != m {
+		t.Fatalf("worldToCamera: got %v (%v)", got, ok)
+	}
+	if got, ok := h.WorldToNDC(); !ok || got != m {
+		t.Fatalf("worldToNDC: got %v (%v)", got, ok)
+	}
+
+	// An attribute of a different type is not returned.
+	h.SetFloat("owner", 1)
+	if _, ok := h.Owner(); ok {
+		t.Fatalf("got a float owner attribute")
+	}
+
+	floats := []struct {
+		name  string
+		set   func(float32) error
+		get   func() (float32, bool)
+		valid float32
+		bad   []float32
+	}{
+		{"utcOffset", h.SetUTCOffset, h.UTCOffset, -32400, []float32{100000}},
+		{"longitude", h.SetLongitude, h.Longitude, 126.97, []float32{-181, 180.5}},
+		{"latitude", h.SetLatitude, h.Latitude, 37.56, []float32{-90.1, 91}},
+		{"altitude", h.SetAltitude, h.Altitude, -10, []float32{float32(math.Inf(1))}},
+		{"focus", h.SetFocus, h.Focus, float32(math.Inf(1)), []float32{-1}},
+		{"expTime", h.SetExpTime, h.ExpTime, 1.0 / 48, []float32{-0.1}},
+		{"aperture", h.SetAperture, h.Aperture, 2.8, []float32{0}},
+		{"isoSpeed", h.SetISOSpeed, h.ISOSpeed, 800, []float32{-100}},
+		{"whiteLuminance", h.SetWhiteLuminance, h.WhiteLuminance, 100, []float32{0}},
+		{"xDensity", h.SetXDensity, h.XDensity, 72, []float32{-72}},
+		{"dwaCompressionLevel", h.SetDWACompressionLevel, h.DWACompressionLevel, 45, []float32{-1}},
+	}
+	for _, c := range floats {
+		if err := c.set(c.valid); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got, ok := c.get(); !ok || got != c.valid {
+			t.Fatalf("%s: got %v (%v), want %v", c.name, got, ok, c.valid)
+		}
+		for _, v := range append(c.bad, float32(math.NaN())) {
+			if err := c.set(v); err == nil {
+				t.Fatalf("%s: set an invalid value %v", c.name, v)
+			} else if !strings.HasPrefix(err.Error(), "exr: ") {
+				t.Fatalf("%s: error isn't prefixed by \"exr: \": %v", c.name, err)
+			}
+		}
+		if got, _ := c.get(); got != c.valid {
+			t.Fatalf("%s: invalid value changed the attribute to %v", c.name, got)
+		}
+	}
+
+	if err := h.SetWrapmodes("clamp,periodic"); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := h.Wrapmodes(); !ok || got != "clamp,periodic" {
+		t.Fatalf("wrapmodes: got %q (%v)", got, ok)
+	}
+	for _, v := range []string{"", "repeat", "clamp,", "black,clamp,mirror"} {
+		if err := h.SetWrapmodes(v); err == nil {
+			t.Fatalf("set invalid wrapmodes %q", v)
+		}
+	}
+
+	fps := Rational{N: 24000, D: 1001}
+	if err := h.SetFramesPerSecond(fps); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := h.FramesPerSecond(); !ok || got != fps || math.Abs(got.Float64()-23.976) > 1e-3 {
+		t.Fatalf("framesPerSecond: got %v (%v), want %v", got, ok, fps)
+	}
+	if err := h.SetFramesPerSecond(Rational{N: 24}); err == nil {
+		t.Fatalf("set framesPerSecond with zero denominator")
+	}
+
+	if err := h.SetDeepImageState(DEEPIMAGESTATE_TIDY); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := h.DeepImageState(); !ok || got != DEEPIMAGESTATE_TIDY {
+		t.Fatalf("deepImageState: got %v (%v)", got, ok)
+	}
+	if err := h.SetDeepImageState(4); err == nil {
+		t.Fatalf("set an unknown deepImageState")
+	}
+
+	tc := Timecode{Hours: 1, Minutes: 2, Seconds: 3, Frame: 4}
+	if err := h.SetTimeCode(tc); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := h.TimeCode(); !ok || got != tc {
+		t.Fatalf("timeCode: got %v (%v), want %v", got, ok, tc)
+	}
+	k := Keycode{FilmMfcCode: 1, FilmType: 2, Prefix: 3, Count: 4, PerfOffset: 5, PerfsPerFrame: 4, PerfsPerCount: 64}
+	if err := h.SetKeyCode(k); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := h.KeyCode(); !ok || got != k {
+		t.Fatalf("keyCode: got %v (%v), want %v", got, ok, k)
+	}
+}
+
+func TestCapDate(t *testing.T) {
+	h := make(Header)
+	for _, v := range []string{"2020-01-02 03:04:05", "2020:13:02 03:04:05", "2020:01:02 24:00:00", "2020:01:02"} {
+		if err := h.SetCapDate(v); err == nil {
+			t.Fatalf("set invalid capDate %q", v)
+		}
+	}
+	if _, ok := h.CaptureTime(); ok {
+		t.Fatalf("got capture time without capDate")
+	}
+	if err := h.SetCapDate("2020:01:02 03:04:05"); err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if got, ok := h.CaptureTime(); !ok || !got.Equal(want) {
+		t.Fatalf("capture time without utcOffset: got %v, want %v", got, want)
+	}
+
+	// Local time in UTC+9 is 9 hours later than UTC.
+	kst := time.FixedZone("KST", 9*60*60)
+	h.SetCaptureTime(time.Date(2020, 1, 2, 12, 4, 5, 0, kst))
+	if got, _ := h.CapDate(); got != "2020:01:02 12:04:05" {
+		t.Fatalf("capDate: got %q", got)
+	}
+	if got, _ := h.UTCOffset(); got != -9*60*60 {
+		t.Fatalf("utcOffset: got %v, want %v", got, -9*60*60)
+	}
+	if got, ok := h.CaptureTime(); !ok || !got.Equal(want) {
+		t.Fatalf("capture time: got %v, want %v", got, want)
+	}
+}
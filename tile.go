@@ -0,0 +1,136 @@
+package exr
+
+// levelMode specifies how many levels a tiled image has.
+type levelMode uint8
+
+const (
+	ONE_LEVEL = levelMode(iota)
+	MIPMAP_LEVELS
+	RIPMAP_LEVELS
+)
+
+func (m levelMode) String() string {
+	switch m {
+	case ONE_LEVEL:
+		return "ONE_LEVEL"
+	case MIPMAP_LEVELS:
+		return "MIPMAP_LEVELS"
+	case RIPMAP_LEVELS:
+		return "RIPMAP_LEVELS"
+	default:
+		return "UNKNOWN_LEVEL_MODE"
+	}
+}
+
+// levelRoundingMode specifies how a size of a level is rounded,
+// when it is not divisible by 2.
+type levelRoundingMode uint8
+
+const (
+	ROUND_DOWN = levelRoundingMode(iota)
+	ROUND_UP
+)
+
+func (m levelRoundingMode) String() string {
+	switch m {
+	case ROUND_DOWN:
+		return "ROUND_DOWN"
+	case ROUND_UP:
+		return "ROUND_UP"
+	default:
+		return "UNKNOWN_LEVEL_ROUNDING_MODE"
+	}
+}
+
+// levelMode returns level mode of the tile description.
+// It is stored in lower 4 bits of mode.
+func (t tiledesc) levelMode() levelMode {
+	return levelMode(t.mode & 0x0F)
+}
+
+// roundingMode returns level rounding mode of the tile description.
+// It is stored in upper 4 bits of mode.
+func (t tiledesc) roundingMode() levelRoundingMode {
+	return levelRoundingMode(t.mode >> 4)
+}
+
+// log2 returns integer log2 of n, rounded by the rounding mode.
+func log2(n int, rmode levelRoundingMode) int {
+	l := 0
+	for (1 << uint(l+1)) <= n {
+		l++
+	}
+	if rmode == ROUND_UP && (1<<uint(l)) < n {
+		l++
+	}
+	return l
+}
+
+// numLevels returns number of levels in x and y direction.
+// For MIPMAP_LEVELS, they are the same.
+func numLevels(t tiledesc, width, height int) (int, int) {
+	switch t.levelMode() {
+	case MIPMAP_LEVELS:
+		size := width
+		if height > size {
+			size = height
+		}
+		n := log2(size, t.roundingMode()) + 1
+		return n, n
+	case RIPMAP_LEVELS:
+		return log2(width, t.roundingMode()) + 1, log2(height, t.roundingMode()) + 1
+	default:
+		return 1, 1
+	}
+}
+
+// levelSize returns size of a level from the size of the base level.
+func levelSize(size, level int, rmode levelRoundingMode) int {
+	d := 1 << uint(level)
+	s := size / d
+	if rmode == ROUND_UP && s*d < size {
+		s++
+	}
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
+// numTilesInLevel returns number of tiles in x and y direction in a level.
+func numTilesInLevel(t tiledesc, width, height, lx, ly int) (int, int) {
+	w := levelSize(width, lx, t.roundingMode())
+	h := levelSize(height, ly, t.roundingMode())
+	tw := int(t.xSize)
+	th := int(t.ySize)
+	return (w + tw - 1) / tw, (h + th - 1) / th
+}
+
+// numTiles returns total number of tiles in a tiled image with the data window.
+func numTiles(t tiledesc, dataWindow box2i) int {
+	width := int(dataWindow.xMax) - int(dataWindow.xMin) + 1
+	height := int(dataWindow.yMax) - int(dataWindow.yMin) + 1
+	if t.xSize == 0 || t.ySize == 0 || width <= 0 || height <= 0 {
+		return 0
+	}
+	nx, ny := numLevels(t, width, height)
+	n := 0
+	switch t.levelMode() {
+	case MIPMAP_LEVELS:
+		for l := 0; l < nx; l++ {
+			tx, ty := numTilesInLevel(t, width, height, l, l)
+			n += tx * ty
+		}
+	case RIPMAP_LEVELS:
+		for ly := 0; ly < ny; ly++ {
+			for lx := 0; lx < nx; lx++ {
+				tx, ty := numTilesInLevel(t, width, height, lx, ly)
+				n += tx * ty
+			}
+		}
+	default:
+		tx, ty := numTilesInLevel(t, width, height, 0, 0)
+		n = tx * ty
+	}
+	return n
+}
@@ -0,0 +1,41 @@
+package exr
+
+import "testing"
+
+func TestNumTiles(t *testing.T) {
+	cases := []struct {
+		tiles      tiledesc
+		dataWindow box2i
+		want       int
+	}{
+		{
+			tiles:      tiledesc{xSize: 64, ySize: 64, mode: uint8(ONE_LEVEL)},
+			dataWindow: box2i{0, 0, 127, 99},
+			want:       2 * 2,
+		},
+		{
+			// levels: 100x50, 50x25, 25x12, 12x6, 6x3, 3x1, 1x1
+			tiles:      tiledesc{xSize: 32, ySize: 32, mode: uint8(MIPMAP_LEVELS)},
+			dataWindow: box2i{0, 0, 99, 49},
+			want:       4*2 + 2*1 + 1 + 1 + 1 + 1 + 1,
+		},
+		{
+			// levels: 100x50, 50x25, 25x13, 13x7, 7x4, 4x2, 2x1, 1x1
+			tiles:      tiledesc{xSize: 32, ySize: 32, mode: uint8(MIPMAP_LEVELS) | uint8(ROUND_UP)<<4},
+			dataWindow: box2i{0, 0, 99, 49},
+			want:       4*2 + 2*1 + 1 + 1 + 1 + 1 + 1 + 1,
+		},
+		{
+			// x levels: 4, 2, 1; y levels: 2, 1
+			tiles:      tiledesc{xSize: 1, ySize: 1, mode: uint8(RIPMAP_LEVELS)},
+			dataWindow: box2i{-2, -1, 1, 0},
+			want:       (4 + 2 + 1) * (2 + 1),
+		},
+	}
+	for i, c := range cases {
+		got := numTiles(c.tiles, c.dataWindow)
+		if got != c.want {
+			t.Fatalf("numTiles[%d]: got %d, want %d", i, got, c.want)
+		}
+	}
+}
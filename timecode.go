@@ -0,0 +1,243 @@
+package exr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Timecode is a SMPTE 12M time code, that is stored in a timecode attribute
+// such as timeCode. It is packed in the same way with OpenEXR,
+// that is the packing of 60 field television.
+type Timecode struct {
+	Hours   int // 0 - 23
+	Minutes int // 0 - 59
+	Seconds int // 0 - 59
+	Frame   int // 0 - 29
+
+	DropFrame  bool
+	ColorFrame bool
+	FieldPhase bool
+
+	// BGF0, BGF1 and BGF2 are binary group flags,
+	// those tell how the binary groups are used.
+	BGF0 bool
+	BGF1 bool
+	BGF2 bool
+
+	// UserData has 8 binary groups of 4 bits. The first group is in the lowest bits.
+	UserData uint32
+}
+
+// Bits of the time and flags word of a timecode attribute.
+const (
+	tcDropFrame  = 1 << 6
+	tcColorFrame = 1 << 7
+	tcFieldPhase = 1 << 15
+	tcBGF0       = 1 << 23
+	tcBGF1       = 1 << 30
+	tcBGF2       = 1 << 31
+)
+
+// ParseTimecode parses "hh:mm:ss:ff" formed string, such as "01:02:03:04", to a Timecode.
+// Frames could be separated with ';' instead, to indicate a drop frame time code.
+// Flags and user data are left as zero.
+func ParseTimecode(s string) (Timecode, error) {
+	var tc Timecode
+	v := s
+	if i := strings.LastIndex(v, ";"); i >= 0 {
+		tc.DropFrame = true
+		v = v[:i] + ":" + v[i+1:]
+	}
+	var extra string
+	n, _ := fmt.Sscanf(v, "%d:%d:%d:%d%s", &tc.Hours, &tc.Minutes, &tc.Seconds, &tc.Frame, &extra)
+	if n != 4 {
+		return Timecode{}, fmt.Errorf("exr: invalid timecode %q: want hh:mm:ss:ff", s)
+	}
+	if err := tc.Validate(); err != nil {
+		return Timecode{}, err
+	}
+	return tc, nil
+}
+
+// String returns the time code in "hh:mm:ss:ff" form.
+// Frames of a drop frame time code are separated with ';' instead.
+func (t Timecode) String() string {
+	sep := ":"
+	if t.DropFrame {
+		sep = ";"
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%02d", t.Hours, t.Minutes, t.Seconds, sep, t.Frame)
+}
+
+// Validate checks the time code fields are in their ranges.
+func (t Timecode) Validate() error {
+	for _, f := range []struct {
+		name  string
+		v     int
+		limit int
+	}{
+		{"hours", t.Hours, 23},
+		{"minutes", t.Minutes, 59},
+		{"seconds", t.Seconds, 59},
+		{"frame", t.Frame, 29},
+	} {
+		if f.v < 0 || f.v > f.limit {
+			return fmt.Errorf("exr: timecode %s out of range [0, %d]: %d", f.name, f.limit, f.v)
+		}
+	}
+	return nil
+}
+
+// BinaryGroup returns i-th binary group of the user data, where i is 1 to 8.
+func (t Timecode) BinaryGroup(i int) uint32 {
+	return (t.UserData >> (4 * uint(i-1))) & 0xF
+}
+
+// SetBinaryGroup sets i-th binary group of the user data, where i is 1 to 8.
+// Only the lowest 4 bits of v are used.
+func (t *Timecode) SetBinaryGroup(i int, v uint32) {
+	shift := 4 * uint(i-1)
+	t.UserData = t.UserData&^(0xF<<shift) | (v&0xF)<<shift
+}
+
+// pack returns the time code in the form of a timecode attribute.
+// The fields should be validated.
+func (t Timecode) pack() timecode {
+	bcd := func(v int) uint32 {
+		return uint32((v/10)<<4 | v%10)
+	}
+	w := bcd(t.Frame) | bcd(t.Seconds)<<8 | bcd(t.Minutes)<<16 | bcd(t.Hours)<<24
+	for _, f := range []struct {
+		set bool
+		bit uint32
+	}{
+		{t.DropFrame, tcDropFrame},
+		{t.ColorFrame, tcColorFrame},
+		{t.FieldPhase, tcFieldPhase},
+		{t.BGF0, tcBGF0},
+		{t.BGF1, tcBGF1},
+		{t.BGF2, tcBGF2},
+	} {
+		if f.set {
+			w |= f.bit
+		}
+	}
+	return timecode{timeAndFlags: w, userData: t.UserData}
+}
+
+// unpackTimecode returns the fields of a timecode attribute.
+// BCD digits out of 0 - 9 are kept as they are, so the result should be validated.
+func unpackTimecode(tc timecode) Timecode {
+	w := tc.timeAndFlags
+	bcd := func(shift, tensBits uint) int {
+		units := int(w>>shift) & 0xF
+		tens := int(w>>(shift+4)) & (1<<tensBits - 1)
+		return tens*10 + units
+	}
+	return Timecode{
+		Hours:      bcd(24, 2),
+		Minutes:    bcd(16, 3),
+		Seconds:    bcd(8, 3),
+		Frame:      bcd(0, 2),
+		DropFrame:  w&tcDropFrame != 0,
+		ColorFrame: w&tcColorFrame != 0,
+		FieldPhase: w&tcFieldPhase != 0,
+		BGF0:       w&tcBGF0 != 0,
+		BGF1:       w&tcBGF1 != 0,
+		BGF2:       w&tcBGF2 != 0,
+		UserData:   tc.userData,
+	}
+}
+
+// timecodeAttribute returns the named timecode attribute.
+func (h Header) timecodeAttribute(name string) (Timecode, bool) {
+	attr, ok := h[name]
+	if !ok || attr.typ != "timecode" {
+		return Timecode{}, false
+	}
+	t, err := timecodeFromBytes(attr.value)
+	if err != nil {
+		return Timecode{}, false
+	}
+	return unpackTimecode(t), true
+}
+
+// Keycode is a motion picture film frame identifier, that is stored
+// in a keycode attribute such as keyCode.
+type Keycode struct {
+	FilmMfcCode   int // film manufacturer code, 0 - 99
+	FilmType      int // film type code, 0 - 99
+	Prefix        int // prefix to identify the film roll, 0 - 999999
+	Count         int // count, increments once every PerfsPerCount perforations, 0 - 9999
+	PerfOffset    int // offset of the frame in perforations from the zero frame reference mark, 0 - 119
+	PerfsPerFrame int // number of perforations per frame, 1 - 15
+	PerfsPerCount int // number of perforations per count, 20 - 120
+}
+
+// Validate checks the key code fields are in their ranges.
+func (k Keycode) Validate() error {
+	for _, f := range []struct {
+		name     string
+		v        int
+		min, max int
+	}{
+		{"filmMfcCode", k.FilmMfcCode, 0, 99},
+		{"filmType", k.FilmType, 0, 99},
+		{"prefix", k.Prefix, 0, 999999},
+		{"count", k.Count, 0, 9999},
+		{"perfOffset", k.PerfOffset, 0, 119},
+		{"perfsPerFrame", k.PerfsPerFrame, 1, 15},
+		{"perfsPerCount", k.PerfsPerCount, 20, 120},
+	} {
+		if f.v < f.min || f.v > f.max {
+			return fmt.Errorf("exr: keycode %s out of range [%d, %d]: %d", f.name, f.min, f.max, f.v)
+		}
+	}
+	return nil
+}
+
+// String returns the key code in "mfc type prefix count+perfOffset" form,
+// such as "12 34 567890 1234+05".
+func (k Keycode) String() string {
+	return fmt.Sprintf("%02d %02d %06d %04d+%02d", k.FilmMfcCode, k.FilmType, k.Prefix, k.Count, k.PerfOffset)
+}
+
+// pack returns the key code in the form of a keycode attribute.
+// The fields should be validated.
+func (k Keycode) pack() keycode {
+	return keycode{
+		filmMfcCode:   int32(k.FilmMfcCode),
+		filmType:      int32(k.FilmType),
+		prefix:        int32(k.Prefix),
+		count:         int32(k.Count),
+		perfOffset:    int32(k.PerfOffset),
+		perfsPerFrame: int32(k.PerfsPerFrame),
+		perfsPerCount: int32(k.PerfsPerCount),
+	}
+}
+
+// unpackKeycode returns the fields of a keycode attribute.
+func unpackKeycode(kc keycode) Keycode {
+	return Keycode{
+		FilmMfcCode:   int(kc.filmMfcCode),
+		FilmType:      int(kc.filmType),
+		Prefix:        int(kc.prefix),
+		Count:         int(kc.count),
+		PerfOffset:    int(kc.perfOffset),
+		PerfsPerFrame: int(kc.perfsPerFrame),
+		PerfsPerCount: int(kc.perfsPerCount),
+	}
+}
+
+// keycodeAttribute returns the named keycode attribute.
+func (h Header) keycodeAttribute(name string) (Keycode, bool) {
+	attr, ok := h[name]
+	if !ok || attr.typ != "keycode" {
+		return Keycode{}, false
+	}
+	kc, err := keycodeFromBytes(attr.value)
+	if err != nil {
+		return Keycode{}, false
+	}
+	return unpackKeycode(kc), true
+}
@@ -0,0 +1,112 @@
+package exr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTimecode(t *testing.T) {
+	cases := []struct {
+		s    string
+		tc   Timecode
+		word uint32
+	}{
+		{"01:02:03:04", Timecode{Hours: 1, Minutes: 2, Seconds: 3, Frame: 4}, 0x01020304},
+		{"23:59:59:29", Timecode{Hours: 23, Minutes: 59, Seconds: 59, Frame: 29}, 0x23595929},
+		{"10:20:30;15", Timecode{Hours: 10, Minutes: 20, Seconds: 30, Frame: 15, DropFrame: true}, 0x10203055},
+	}
+	for _, c := range cases {
+		tc, err := ParseTimecode(c.s)
+		if err != nil {
+			t.Fatalf("parse %q: %v", c.s, err)
+		}
+		if tc != c.tc {
+			t.Fatalf("parse %q: got %+v, want %+v", c.s, tc, c.tc)
+		}
+		if got := tc.String(); got != c.s {
+			t.Fatalf("format %+v: got %q, want %q", tc, got, c.s)
+		}
+		if got := tc.pack().timeAndFlags; got != c.word {
+			t.Fatalf("pack %q: got %#08x, want %#08x", c.s, got, c.word)
+		}
+	}
+
+	for _, s := range []string{"24:00:00:00", "00:60:00:00", "00:00:60:00", "00:00:00:30", "1:2:3", "01:02:03:04x", "-1:00:00:00"} {
+		if _, err := ParseTimecode(s); err == nil {
+			t.Fatalf("parsed invalid timecode %q", s)
+		} else if !strings.HasPrefix(err.Error(), "exr: ") {
+			t.Fatalf("timecode %q: error isn't prefixed by \"exr: \": %v", s, err)
+		}
+	}
+
+	// All flags and binary groups survive packing.
+	tc := Timecode{
+		Hours: 12, Minutes: 34, Seconds: 56, Frame: 7,
+		DropFrame: true, ColorFrame: true, FieldPhase: true,
+		BGF0: true, BGF1: false, BGF2: true,
+	}
+	for i := 1; i <= 8; i++ {
+		tc.SetBinaryGroup(i, uint32(i+7))
+	}
+	if got, want := tc.UserData, uint32(0xFEDCBA98); got != want {
+		t.Fatalf("user data: got %#08x, want %#08x", got, want)
+	}
+	if got := tc.BinaryGroup(3); got != 10 {
+		t.Fatalf("binary group 3: got %d, want 10", got)
+	}
+	if got, want := tc.pack().timeAndFlags, uint32(0x92B4D6C7); got != want {
+		t.Fatalf("pack with flags: got %#08x, want %#08x", got, want)
+	}
+	h := make(Header)
+	if err := h.SetTimeCode(tc); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := h.TimeCode()
+	if !ok || got != tc {
+		t.Fatalf("timeCode attribute: got %+v (%v), want %+v", got, ok, tc)
+	}
+	if _, ok := make(Header).TimeCode(); ok {
+		t.Fatalf("got a missing timecode attribute")
+	}
+	if err := h.SetTimeCode(Timecode{Frame: 30}); err == nil {
+		t.Fatalf("set an invalid timecode")
+	}
+}
+
+func TestKeycode(t *testing.T) {
+	valid := Keycode{FilmMfcCode: 12, FilmType: 34, Prefix: 567890, Count: 1234, PerfOffset: 5, PerfsPerFrame: 4, PerfsPerCount: 64}
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := valid.String(), "12 34 567890 1234+05"; got != want {
+		t.Fatalf("string: got %q, want %q", got, want)
+	}
+	h := make(Header)
+	if err := h.SetKeyCode(valid); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := h.KeyCode(); !ok || got != valid {
+		t.Fatalf("keyCode attribute: got %+v (%v), want %+v", got, ok, valid)
+	}
+
+	cases := []func(k *Keycode){
+		func(k *Keycode) { k.FilmMfcCode = 100 },
+		func(k *Keycode) { k.FilmType = -1 },
+		func(k *Keycode) { k.Prefix = 1000000 },
+		func(k *Keycode) { k.Count = 10000 },
+		func(k *Keycode) { k.PerfOffset = 120 },
+		func(k *Keycode) { k.PerfsPerFrame = 0 },
+		func(k *Keycode) { k.PerfsPerCount = 19 },
+		func(k *Keycode) { k.PerfsPerCount = 121 },
+	}
+	for i, modify := range cases {
+		k := valid
+		modify(&k)
+		if err := k.Validate(); err == nil {
+			t.Fatalf("case %d: validated an invalid keycode %+v", i, k)
+		}
+		if err := h.SetKeyCode(k); err == nil {
+			t.Fatalf("case %d: set an invalid keycode %+v", i, k)
+		}
+	}
+}
@@ -1,10 +1,8 @@
 package exr
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
-	"log"
 	"math"
 )
 
@@ -21,16 +19,25 @@ type box2i struct {
 	yMax int32
 }
 
-func box2iFromBytes(b []byte) box2i {
+func box2iFromBytes(b []byte) (box2i, error) {
 	if len(b) != 16 {
-		log.Fatal("box2iFromBytes: need bytes of length 16")
+		return box2i{}, FormatError("box2i: need bytes of length 16")
 	}
 	return box2i{
 		xMin: int32(parse.Uint32(b[0:4])),
 		yMin: int32(parse.Uint32(b[4:8])),
 		xMax: int32(parse.Uint32(b[8:12])),
 		yMax: int32(parse.Uint32(b[12:16])),
-	}
+	}, nil
+}
+
+func box2iToBytes(b box2i) []byte {
+	bs := make([]byte, 16)
+	parse.PutUint32(bs[0:4], uint32(b.xMin))
+	parse.PutUint32(bs[4:8], uint32(b.yMin))
+	parse.PutUint32(bs[8:12], uint32(b.xMax))
+	parse.PutUint32(bs[12:16], uint32(b.yMax))
+	return bs
 }
 
 type box2f struct {
@@ -40,16 +47,16 @@ type box2f struct {
 	yMax float32
 }
 
-func box2fFromBytes(b []byte) box2f {
+func box2fFromBytes(b []byte) (box2f, error) {
 	if len(b) != 16 {
-		log.Fatal("box2fFromBytes: need bytes of length 16")
+		return box2f{}, FormatError("box2f: need bytes of length 16")
 	}
 	return box2f{
 		xMin: math.Float32frombits(parse.Uint32(b[0:4])),
 		yMin: math.Float32frombits(parse.Uint32(b[4:8])),
 		xMax: math.Float32frombits(parse.Uint32(b[8:12])),
 		yMax: math.Float32frombits(parse.Uint32(b[12:16])),
-	}
+	}, nil
 }
 
 type pixelType int32
@@ -101,72 +108,93 @@ func (ch channel) String() string {
 
 type chlist []channel
 
-func chlistFromBytes(b []byte) chlist {
+func chlistFromBytes(b []byte) (chlist, error) {
 	chans := make(chlist, 0)
-	buf := bufio.NewReader(bytes.NewBuffer(b))
 	for {
-		nameByte, err := buf.ReadBytes(0x00)
-		if err != nil {
-			log.Fatal(err)
+		if len(b) == 0 {
+			return nil, FormatError("chlist: missing null byte at the end of the channel list")
 		}
-		name := string(nameByte[:len(nameByte)-1])
-
-		channelBytes, err := read(buf, 16)
-		if err != nil {
-			log.Fatal(err)
+		if b[0] == 0x00 {
+			break
+		}
+		end := bytes.IndexByte(b, 0x00)
+		if end < 0 {
+			return nil, FormatError("chlist: channel name is not null terminated")
+		}
+		name := string(b[:end])
+		b = b[end+1:]
+		if len(b) < 16 {
+			return nil, FormatError(fmt.Sprintf("chlist: channel %q: truncated channel description", name))
 		}
-		pixelType := pixelType(parse.Uint32(channelBytes[:4]))
-		pLinear := uint8(channelBytes[4])
-		// channelBytes[5:8] are place holders.
-		xSampling := int32(parse.Uint32(channelBytes[8:12]))
-		ySampling := int32(parse.Uint32(channelBytes[12:]))
 		ch := channel{
 			name:      name,
-			pixelType: pixelType,
-			pLinear:   pLinear,
-			xSampling: xSampling,
-			ySampling: ySampling,
+			pixelType: pixelType(parse.Uint32(b[:4])),
+			pLinear:   uint8(b[4]),
+			// b[5:8] are place holders.
+			xSampling: int32(parse.Uint32(b[8:12])),
+			ySampling: int32(parse.Uint32(b[12:16])),
 		}
 		chans = append(chans, ch)
-		if buf.Buffered() == 1 {
-			nullByte, err := buf.Peek(1)
-			if err != nil {
-				log.Fatal(err)
-			}
-			if nullByte[0] != 0x00 {
-				log.Fatal(FormatError("channels are must seperated by a null byte"))
-			}
-			break
-		}
+		b = b[16:]
 	}
-	return chans
+	if len(b) != 1 {
+		return nil, FormatError(fmt.Sprintf("chlist: %d bytes after the end of the channel list", len(b)-1))
+	}
+	return chans, nil
 }
 
-type chromaticities struct {
-	redX   float32
-	redY   float32
-	greenX float32
-	greenY float32
-	blueX  float32
-	blueY  float32
-	whiteX float32
-	whiteY float32
+func chlistToBytes(chans chlist) []byte {
+	b := make([]byte, 0)
+	for _, ch := range chans {
+		b = append(b, ch.name...)
+		b = append(b, 0x00)
+		channelBytes := make([]byte, 16)
+		parse.PutUint32(channelBytes[:4], uint32(ch.pixelType))
+		channelBytes[4] = ch.pLinear
+		// channelBytes[5:8] are place holders.
+		parse.PutUint32(channelBytes[8:12], uint32(ch.xSampling))
+		parse.PutUint32(channelBytes[12:], uint32(ch.ySampling))
+		b = append(b, channelBytes...)
+	}
+	b = append(b, 0x00)
+	return b
 }
 
-func chromaticitiesFromBytes(b []byte) chromaticities {
+// Chromaticities are CIE xy coordinates of the RGB primaries and the white point
+// of an image's color space.
+type Chromaticities struct {
+	RedX   float32
+	RedY   float32
+	GreenX float32
+	GreenY float32
+	BlueX  float32
+	BlueY  float32
+	WhiteX float32
+	WhiteY float32
+}
+
+func chromaticitiesFromBytes(b []byte) (Chromaticities, error) {
 	if len(b) != 32 {
-		log.Fatal("chromaticitiesFromBytes: need bytes of length 32")
+		return Chromaticities{}, FormatError("chromaticities: need bytes of length 32")
 	}
-	return chromaticities{
-		redX:   math.Float32frombits(parse.Uint32(b[0:4])),
-		redY:   math.Float32frombits(parse.Uint32(b[4:8])),
-		greenX: math.Float32frombits(parse.Uint32(b[8:12])),
-		greenY: math.Float32frombits(parse.Uint32(b[12:16])),
-		blueX:  math.Float32frombits(parse.Uint32(b[16:20])),
-		blueY:  math.Float32frombits(parse.Uint32(b[20:24])),
-		whiteX: math.Float32frombits(parse.Uint32(b[24:28])),
-		whiteY: math.Float32frombits(parse.Uint32(b[28:32])),
+	return Chromaticities{
+		RedX:   math.Float32frombits(parse.Uint32(b[0:4])),
+		RedY:   math.Float32frombits(parse.Uint32(b[4:8])),
+		GreenX: math.Float32frombits(parse.Uint32(b[8:12])),
+		GreenY: math.Float32frombits(parse.Uint32(b[12:16])),
+		BlueX:  math.Float32frombits(parse.Uint32(b[16:20])),
+		BlueY:  math.Float32frombits(parse.Uint32(b[20:24])),
+		WhiteX: math.Float32frombits(parse.Uint32(b[24:28])),
+		WhiteY: math.Float32frombits(parse.Uint32(b[28:32])),
+	}, nil
+}
+
+func chromaticitiesToBytes(c Chromaticities) []byte {
+	b := make([]byte, 32)
+	for i, v := range []float32{c.RedX, c.RedY, c.GreenX, c.GreenY, c.BlueX, c.BlueY, c.WhiteX, c.WhiteY} {
+		parse.PutUint32(b[4*i:], math.Float32bits(v))
 	}
+	return b
 }
 
 type compression uint8
@@ -205,20 +233,43 @@ func (t compression) String() string {
 	}
 }
 
-func compressionFromBytes(b []byte) compression {
+func compressionFromBytes(b []byte) (compression, error) {
 	if len(b) != 1 {
-		log.Fatal("compressionFromBytes: need bytes of length 1")
+		return 0, FormatError("compression: need bytes of length 1")
 	}
-	return compression(b[0])
+	return compression(b[0]), nil
 }
 
 type envmap uint8
 
-func envmapFromBytes(b []byte) envmap {
+const (
+	ENVMAP_LATLONG = envmap(iota)
+	ENVMAP_CUBE
+)
+
+func (e envmap) String() string {
+	switch e {
+	case ENVMAP_LATLONG:
+		return "ENVMAP_LATLONG"
+	case ENVMAP_CUBE:
+		return "ENVMAP_CUBE"
+	default:
+		return "UNKNOWN_ENVMAP"
+	}
+}
+
+func envmapFromBytes(b []byte) (envmap, error) {
 	if len(b) != 1 {
-		log.Fatal("envmapFromBytes: need bytes of length 1")
+		return 0, FormatError("envmap: need bytes of length 1")
+	}
+	return envmap(b[0]), nil
+}
+
+func intFromBytes(b []byte) (int32, error) {
+	if len(b) != 4 {
+		return 0, FormatError("int: need bytes of length 4")
 	}
-	return envmap(b[0])
+	return int32(parse.Uint32(b)), nil
 }
 
 type keycode struct {
@@ -231,9 +282,9 @@ type keycode struct {
 	perfsPerCount int32
 }
 
-func keycodeFromBytes(b []byte) keycode {
+func keycodeFromBytes(b []byte) (keycode, error) {
 	if len(b) != 28 {
-		log.Fatal("keycodeFromBytes: need bytes of length 28")
+		return keycode{}, FormatError("keycode: need bytes of length 28")
 	}
 	return keycode{
 		filmMfcCode:   int32(parse.Uint32(b[:4])),
@@ -243,7 +294,15 @@ func keycodeFromBytes(b []byte) keycode {
 		perfOffset:    int32(parse.Uint32(b[16:20])),
 		perfsPerFrame: int32(parse.Uint32(b[20:24])),
 		perfsPerCount: int32(parse.Uint32(b[24:28])),
+	}, nil
+}
+
+func keycodeToBytes(k keycode) []byte {
+	b := make([]byte, 28)
+	for i, v := range []int32{k.filmMfcCode, k.filmType, k.prefix, k.count, k.perfOffset, k.perfsPerFrame, k.perfsPerCount} {
+		parse.PutUint32(b[4*i:], uint32(v))
 	}
+	return b
 }
 
 type lineOrder uint8
@@ -267,18 +326,18 @@ func (l lineOrder) String() string {
 	}
 }
 
-func lineOrderFromBytes(b []byte) lineOrder {
+func lineOrderFromBytes(b []byte) (lineOrder, error) {
 	if len(b) != 1 {
-		log.Fatal("lineOrderFromBytes: need bytes of length 1")
+		return 0, FormatError("lineOrder: need bytes of length 1")
 	}
-	return lineOrder(b[0])
+	return lineOrder(b[0]), nil
 }
 
 type m33f [9]float32
 
-func m33fFromBytes(b []byte) m33f {
+func m33fFromBytes(b []byte) (m33f, error) {
 	if len(b) != 36 {
-		log.Fatal("m33fFromBytes: need bytes of length 36")
+		return m33f{}, FormatError("m33f: need bytes of length 36")
 	}
 	return [9]float32{
 		math.Float32frombits(parse.Uint32(b[:4])),
@@ -290,14 +349,14 @@ func m33fFromBytes(b []byte) m33f {
 		math.Float32frombits(parse.Uint32(b[24:28])),
 		math.Float32frombits(parse.Uint32(b[28:32])),
 		math.Float32frombits(parse.Uint32(b[32:36])),
-	}
+	}, nil
 }
 
 type m44f [16]float32
 
-func m44fFromBytes(b []byte) m44f {
+func m44fFromBytes(b []byte) (m44f, error) {
 	if len(b) != 64 {
-		log.Fatal("m44fFromBytes: need bytes of length 64")
+		return m44f{}, FormatError("m44f: need bytes of length 64")
 	}
 	return [16]float32{
 		math.Float32frombits(parse.Uint32(b[:4])),
@@ -316,7 +375,15 @@ func m44fFromBytes(b []byte) m44f {
 		math.Float32frombits(parse.Uint32(b[52:56])),
 		math.Float32frombits(parse.Uint32(b[56:60])),
 		math.Float32frombits(parse.Uint32(b[60:64])),
+	}, nil
+}
+
+func m44fToBytes(m m44f) []byte {
+	b := make([]byte, 64)
+	for i, v := range m {
+		parse.PutUint32(b[4*i:], math.Float32bits(v))
 	}
+	return b
 }
 
 type preview struct {
@@ -325,12 +392,27 @@ type preview struct {
 	data   []byte
 }
 
-func previewFromBytes(b []byte) preview {
-	return preview{
+func previewFromBytes(b []byte) (preview, error) {
+	if len(b) < 8 {
+		return preview{}, FormatError("preview: need bytes of length 8 at least")
+	}
+	p := preview{
 		width:  int32(parse.Uint32(b[:4])),
 		height: int32(parse.Uint32(b[4:8])),
 		data:   b[8:],
 	}
+	if int64(len(p.data)) != 4*int64(p.width)*int64(p.height) {
+		return preview{}, FormatError("preview: length of data doesn't match to the preview size")
+	}
+	return p, nil
+}
+
+func previewToBytes(p preview) []byte {
+	b := make([]byte, 8+len(p.data))
+	parse.PutUint32(b[:4], uint32(p.width))
+	parse.PutUint32(b[4:8], uint32(p.height))
+	copy(b[8:], p.data)
+	return b
 }
 
 type rational struct {
@@ -338,14 +420,51 @@ type rational struct {
 	b uint32
 }
 
-func rationalFromBytes(b []byte) rational {
+func rationalFromBytes(b []byte) (rational, error) {
 	if len(b) != 8 {
-		log.Fatal("rationalFromBytes: need bytes of length 8")
+		return rational{}, FormatError("rational: need bytes of length 8")
 	}
 	return rational{
 		a: int32(parse.Uint32(b[:4])),
 		b: parse.Uint32(b[4:8]),
+	}, nil
+}
+
+func rationalToBytes(r rational) []byte {
+	b := make([]byte, 8)
+	parse.PutUint32(b[:4], uint32(r.a))
+	parse.PutUint32(b[4:8], r.b)
+	return b
+}
+
+// stringvectorFromBytes parses a stringvector attribute, such as multiView.
+// Each string is stored with it's length in front of it.
+func stringvectorFromBytes(b []byte) ([]string, error) {
+	var ss []string
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, FormatError("stringvector: truncated string length")
+		}
+		n := int(parse.Uint32(b[:4]))
+		b = b[4:]
+		if n < 0 || n > len(b) {
+			return nil, FormatError(fmt.Sprintf("stringvector: string length %d exceeds the value", n))
+		}
+		ss = append(ss, string(b[:n]))
+		b = b[n:]
+	}
+	return ss, nil
+}
+
+func stringvectorToBytes(ss []string) []byte {
+	b := make([]byte, 0)
+	for _, s := range ss {
+		n := make([]byte, 4)
+		parse.PutUint32(n, uint32(len(s)))
+		b = append(b, n...)
+		b = append(b, s...)
 	}
+	return b
 }
 
 type tiledesc struct {
@@ -354,15 +473,15 @@ type tiledesc struct {
 	mode  uint8
 }
 
-func tiledescFromBytes(b []byte) tiledesc {
+func tiledescFromBytes(b []byte) (tiledesc, error) {
 	if len(b) != 9 {
-		log.Fatal("tiledescFromBytes: need bytes of length 9")
+		return tiledesc{}, FormatError("tiledesc: need bytes of length 9")
 	}
 	return tiledesc{
 		xSize: parse.Uint32(b[:4]),
 		ySize: parse.Uint32(b[4:8]),
 		mode:  b[8],
-	}
+	}, nil
 }
 
 type timecode struct {
@@ -370,62 +489,76 @@ type timecode struct {
 	userData     uint32
 }
 
-func timecodeFromBytes(b []byte) timecode {
+func timecodeFromBytes(b []byte) (timecode, error) {
 	if len(b) != 8 {
-		log.Fatal("timecodeFromBytes: need bytes of length 8")
+		return timecode{}, FormatError("timecode: need bytes of length 8")
 	}
 	return timecode{
 		timeAndFlags: parse.Uint32(b[:4]),
 		userData:     parse.Uint32(b[4:8]),
-	}
+	}, nil
+}
+
+func timecodeToBytes(t timecode) []byte {
+	b := make([]byte, 8)
+	parse.PutUint32(b[:4], t.timeAndFlags)
+	parse.PutUint32(b[4:8], t.userData)
+	return b
 }
 
 type v2i [2]int32
 
-func v2iFromBytes(b []byte) v2i {
+func v2iFromBytes(b []byte) (v2i, error) {
 	if len(b) != 8 {
-		log.Fatal("v2iFromBytes: need bytes of length 8")
+		return v2i{}, FormatError("v2i: need bytes of length 8")
 	}
 	return v2i{
 		int32(parse.Uint32(b[:4])),
 		int32(parse.Uint32(b[4:8])),
-	}
+	}, nil
 }
 
 type v2f [2]float32
 
-func v2fFromBytes(b []byte) v2f {
+func v2fFromBytes(b []byte) (v2f, error) {
 	if len(b) != 8 {
-		log.Fatal("v2fFromBytes: need bytes of length 8")
+		return v2f{}, FormatError("v2f: need bytes of length 8")
 	}
 	return v2f{
 		math.Float32frombits(parse.Uint32(b[:4])),
 		math.Float32frombits(parse.Uint32(b[4:8])),
-	}
+	}, nil
+}
+
+func v2fToBytes(v v2f) []byte {
+	b := make([]byte, 8)
+	parse.PutUint32(b[:4], math.Float32bits(v[0]))
+	parse.PutUint32(b[4:8], math.Float32bits(v[1]))
+	return b
 }
 
 type v3i [3]int32
 
-func v3iFromBytes(b []byte) v3i {
+func v3iFromBytes(b []byte) (v3i, error) {
 	if len(b) != 12 {
-		log.Fatal("v3iFromBytes: need bytes of length 12")
+		return v3i{}, FormatError("v3i: need bytes of length 12")
 	}
 	return v3i{
 		int32(parse.Uint32(b[:4])),
 		int32(parse.Uint32(b[4:8])),
 		int32(parse.Uint32(b[8:12])),
-	}
+	}, nil
 }
 
 type v3f [3]float32
 
-func v3fFromBytes(b []byte) v3f {
+func v3fFromBytes(b []byte) (v3f, error) {
 	if len(b) != 12 {
-		log.Fatal("v3fFromBytes: need bytes of length 12")
+		return v3f{}, FormatError("v3f: need bytes of length 12")
 	}
 	return v3f{
 		math.Float32frombits(parse.Uint32(b[:4])),
 		math.Float32frombits(parse.Uint32(b[4:8])),
 		math.Float32frombits(parse.Uint32(b[8:12])),
-	}
+	}, nil
 }
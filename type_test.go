@@ -0,0 +1,131 @@
+package exr
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestFromBytesWrongSize(t *testing.T) {
+	cases := []struct {
+		typ   string
+		parse func(b []byte) error
+		size  int
+	}{
+		{"box2i", func(b []byte) error { _, err := box2iFromBytes(b); return err }, 16},
+		{"box2f", func(b []byte) error { _, err := box2fFromBytes(b); return err }, 16},
+		{"chromaticities", func(b []byte) error { _, err := chromaticitiesFromBytes(b); return err }, 32},
+		{"compression", func(b []byte) error { _, err := compressionFromBytes(b); return err }, 1},
+		{"envmap", func(b []byte) error { _, err := envmapFromBytes(b); return err }, 1},
+		{"int", func(b []byte) error { _, err := intFromBytes(b); return err }, 4},
+		{"keycode", func(b []byte) error { _, err := keycodeFromBytes(b); return err }, 28},
+		{"lineOrder", func(b []byte) error { _, err := lineOrderFromBytes(b); return err }, 1},
+		{"m33f", func(b []byte) error { _, err := m33fFromBytes(b); return err }, 36},
+		{"m44f", func(b []byte) error { _, err := m44fFromBytes(b); return err }, 64},
+		{"rational", func(b []byte) error { _, err := rationalFromBytes(b); return err }, 8},
+		{"tiledesc", func(b []byte) error { _, err := tiledescFromBytes(b); return err }, 9},
+		{"timecode", func(b []byte) error { _, err := timecodeFromBytes(b); return err }, 8},
+		{"v2i", func(b []byte) error { _, err := v2iFromBytes(b); return err }, 8},
+		{"v2f", func(b []byte) error { _, err := v2fFromBytes(b); return err }, 8},
+		{"v3i", func(b []byte) error { _, err := v3iFromBytes(b); return err }, 12},
+		{"v3f", func(b []byte) error { _, err := v3fFromBytes(b); return err }, 12},
+	}
+	for _, c := range cases {
+		if err := c.parse(make([]byte, c.size)); err != nil {
+			t.Fatalf("%s of %d bytes: %v", c.typ, c.size, err)
+		}
+		for _, n := range []int{0, c.size - 1, c.size + 1} {
+			err := c.parse(make([]byte, n))
+			if _, ok := err.(FormatError); !ok {
+				t.Fatalf("%s of %d bytes: got error %v, want FormatError", c.typ, n, err)
+			}
+		}
+	}
+}
+
+func TestChlistFromBytes(t *testing.T) {
+	want := chlist{
+		{name: "B", pixelType: HALF, xSampling: 1, ySampling: 1},
+		{name: "G", pixelType: FLOAT, pLinear: 1, xSampling: 2, ySampling: 2},
+	}
+	b := chlistToBytes(want)
+	got, err := chlistFromBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, err := chlistFromBytes([]byte{0}); err != nil || len(got) != 0 {
+		t.Fatalf("empty channel list: got (%v, %v), want no channels", got, err)
+	}
+	for _, c := range []struct {
+		name string
+		b    []byte
+	}{
+		{"empty", nil},
+		{"no null byte at the end", b[:len(b)-1]},
+		{"truncated channel", b[:len(b)-5]},
+		{"no null byte after name", []byte("R")},
+		{"bytes after the end", append(b, 0)},
+	} {
+		if _, err := chlistFromBytes(c.b); err == nil {
+			t.Fatalf("%s: want an error", c.name)
+		} else if _, ok := err.(FormatError); !ok {
+			t.Fatalf("%s: got %T error, want FormatError", c.name, err)
+		}
+	}
+}
+
+func TestPreviewFromBytes(t *testing.T) {
+	p := preview{width: 2, height: 1, data: []byte{1, 2, 3, 4, 5, 6, 7, 8}}
+	b := previewToBytes(p)
+	if got, err := previewFromBytes(b); err != nil || !reflect.DeepEqual(got, p) {
+		t.Fatalf("got (%v, %v), want %v", got, err, p)
+	}
+	for _, b := range [][]byte{b[:4], b[:len(b)-1]} {
+		if _, err := previewFromBytes(b); err == nil {
+			t.Fatalf("preview of %d bytes: want an error", len(b))
+		}
+	}
+	h := make(Header)
+	h.SetAttribute("preview", "preview", b[:len(b)-1])
+	if _, ok := h.Preview(); ok {
+		t.Fatalf("Preview of a broken attribute: ok should be false")
+	}
+}
+
+func FuzzChlistFromBytes(f *testing.F) {
+	for _, b := range testFiles(f) {
+		r := bufio.NewReader(bytes.NewReader(b))
+		vf, err := readVersion(r)
+		if err != nil {
+			f.Fatal(err)
+		}
+		headers, err := readHeaders(r, vf, nil)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, h := range headers {
+			f.Add(h["channels"].value)
+		}
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		chans, err := chlistFromBytes(b)
+		if err != nil {
+			if _, ok := err.(FormatError); !ok {
+				t.Fatalf("got %T error, want FormatError: %v", err, err)
+			}
+			return
+		}
+		// Reserved bytes aren't kept, compare the parsed channels.
+		got, err := chlistFromBytes(chlistToBytes(chans))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, chans) {
+			t.Fatalf("got %v, want %v", got, chans)
+		}
+	})
+}
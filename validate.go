@@ -0,0 +1,232 @@
+package exr
+
+import (
+	"fmt"
+	"math"
+)
+
+// Names of attributes and types are at most 31 bytes,
+// or 255 bytes when the long name bit of the version field is on.
+const (
+	maxShortNameLen = 31
+	maxLongNameLen  = 255
+)
+
+// versionFlags are the known flag bits of the version field.
+const versionFlags = 0x200 | 0x400 | 0x800 | 0x1000
+
+// requiredAttributes are the attributes that every header should have.
+var requiredAttributes = []string{
+	"channels",
+	"compression",
+	"dataWindow",
+	"displayWindow",
+	"lineOrder",
+	"pixelAspectRatio",
+	"screenWindowCenter",
+	"screenWindowWidth",
+}
+
+// attributeTypes are the types of the attributes, those decide the layout of a part.
+var attributeTypes = map[string]string{
+	"channels":           "chlist",
+	"chunkCount":         "int",
+	"compression":        "compression",
+	"dataWindow":         "box2i",
+	"displayWindow":      "box2i",
+	"lineOrder":          "lineOrder",
+	"maxSamplesPerPixel": "int",
+	"multiView":          "stringvector",
+	"name":               "string",
+	"pixelAspectRatio":   "float",
+	"screenWindowCenter": "v2f",
+	"screenWindowWidth":  "float",
+	"tiles":              "tiledesc",
+	"type":               "string",
+	"version":            "int",
+	"view":               "string",
+}
+
+// typeSizes are the value sizes of the fixed size types.
+var typeSizes = map[string]int{
+	"box2f":          16,
+	"box2i":          16,
+	"chromaticities": 32,
+	"compression":    1,
+	"deepImageState": 1,
+	"double":         8,
+	"envmap":         1,
+	"float":          4,
+	"int":            4,
+	"keycode":        28,
+	"lineOrder":      1,
+	"m33f":           36,
+	"m44f":           64,
+	"rational":       8,
+	"tiledesc":       9,
+	"timecode":       8,
+	"v2f":            8,
+	"v2i":            8,
+	"v3f":            12,
+	"v3i":            12,
+}
+
+// partTypes are the valid values of the type attribute.
+var partTypes = []string{"scanlineimage", "tiledimage", "deepscanline", "deeptile"}
+
+// attributeError returns a FormatError of the named attribute in i-th part.
+func attributeError(i int, name, format string, args ...interface{}) error {
+	return FormatError(fmt.Sprintf("part %d: attribute %q: %s", i, name, fmt.Sprintf(format, args...)))
+}
+
+// validateVersion checks the version field.
+func validateVersion(versionNum uint32) error {
+	if v := versionNum & 0xFF; v != 2 {
+		return FormatError(fmt.Sprintf("version field: unsupported version %d, want 2", v))
+	}
+	if unknown := versionNum &^ (0xFF | versionFlags); unknown != 0 {
+		return FormatError(fmt.Sprintf("version field: unknown flags %#x", unknown))
+	}
+	return nil
+}
+
+// validateHeaders checks the headers of an image follow the rules of the version field,
+// and have the required attributes with valid values.
+// Each failure is reported as a FormatError with the attribute name.
+func validateHeaders(vf VersionField, headers []Header) error {
+	maxNameLen := maxShortNameLen
+	if vf.longName {
+		maxNameLen = maxLongNameLen
+	}
+	names := make(map[string]int)
+	for i, h := range headers {
+		for _, name := range h.Names() {
+			attr := h[name]
+			if len(attr.name) > maxNameLen {
+				return attributeError(i, attr.name, "name is longer than %d bytes", maxNameLen)
+			}
+			if attr.typ == "" || len(attr.typ) > maxNameLen {
+				return attributeError(i, attr.name, "invalid type name %q", attr.typ)
+			}
+			if want, ok := attributeTypes[attr.name]; ok && attr.typ != want {
+				return attributeError(i, attr.name, "type is %q, want %q", attr.typ, want)
+			}
+			if size, ok := typeSizes[attr.typ]; ok && len(attr.value) != size {
+				return attributeError(i, attr.name, "%s value has %d bytes, want %d", attr.typ, len(attr.value), size)
+			}
+		}
+
+		required := requiredAttributes
+		if vf.multiPart {
+			required = append(required, "name", "type", "chunkCount")
+		} else if vf.deep {
+			required = append(required, "type")
+		}
+		typ := "scanlineimage"
+		if vf.tiled {
+			typ = "tiledimage"
+		}
+		if attr, ok := h["type"]; ok {
+			typ = string(attr.value)
+			valid := false
+			for _, t := range partTypes {
+				if typ == t {
+					valid = true
+				}
+			}
+			if !valid {
+				return attributeError(i, "type", "unknown part type %q", typ)
+			}
+			deep := typ == "deepscanline" || typ == "deeptile"
+			if !vf.multiPart && deep != vf.deep {
+				return attributeError(i, "type", "part type %q doesn't match the non-image bit of the version field", typ)
+			}
+			if !vf.multiPart && !vf.deep && (typ == "tiledimage") != vf.tiled {
+				return attributeError(i, "type", "part type %q doesn't match the tiled bit of the version field", typ)
+			}
+		}
+		if typ == "tiledimage" || typ == "deeptile" {
+			required = append(required, "tiles")
+		}
+		for _, name := range required {
+			if _, ok := h[name]; !ok {
+				return attributeError(i, name, "missing required attribute")
+			}
+		}
+
+		// Sizes of the fixed size values are checked above, so they are parsed without errors.
+		if vf.multiPart {
+			name := string(h["name"].value)
+			if j, ok := names[name]; ok {
+				return attributeError(i, "name", "part name %q is also used by part %d", name, j)
+			}
+			names[name] = i
+			if n, _ := intFromBytes(h["chunkCount"].value); n < 0 {
+				return attributeError(i, "chunkCount", "negative chunk count %d", n)
+			}
+		}
+		for _, name := range []string{"dataWindow", "displayWindow"} {
+			b, _ := box2iFromBytes(h[name].value)
+			if b.xMin > b.xMax || b.yMin > b.yMax {
+				return attributeError(i, name, "min (%d, %d) is greater than max (%d, %d)", b.xMin, b.yMin, b.xMax, b.yMax)
+			}
+		}
+		if c, _ := compressionFromBytes(h["compression"].value); c > B44A_COMPRESSION {
+			return attributeError(i, "compression", "unknown compression %d", c)
+		}
+		if l, _ := lineOrderFromBytes(h["lineOrder"].value); l > RANDOM_Y {
+			return attributeError(i, "lineOrder", "unknown line order %d", l)
+		}
+		if v := math.Float32frombits(parse.Uint32(h["pixelAspectRatio"].value)); !(v >= 1e-6 && v <= 1e6) {
+			return attributeError(i, "pixelAspectRatio", "invalid aspect ratio %v", v)
+		}
+		if v := math.Float32frombits(parse.Uint32(h["screenWindowWidth"].value)); !(v >= 0) || math.IsInf(float64(v), 0) {
+			return attributeError(i, "screenWindowWidth", "invalid width %v", v)
+		}
+		if attr, ok := h["tiles"]; ok {
+			t, _ := tiledescFromBytes(attr.value)
+			if t.xSize < 1 || t.ySize < 1 || t.xSize > math.MaxInt32 || t.ySize > math.MaxInt32 {
+				return attributeError(i, "tiles", "invalid tile size %dx%d", t.xSize, t.ySize)
+			}
+			if t.levelMode() > RIPMAP_LEVELS {
+				return attributeError(i, "tiles", "unknown level mode %d", t.levelMode())
+			}
+			if t.roundingMode() > ROUND_UP {
+				return attributeError(i, "tiles", "unknown level rounding mode %d", t.roundingMode())
+			}
+		}
+		chans, err := chlistFromBytes(h["channels"].value)
+		if fe, ok := err.(FormatError); ok {
+			return attributeError(i, "channels", "%s", string(fe))
+		} else if err != nil {
+			return err
+		}
+		if err := validateChannels(i, chans, maxNameLen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateChannels checks the channels of a channel list in i-th part.
+// Channels should have unique names, sorted in increasing order.
+func validateChannels(i int, chans chlist, maxNameLen int) error {
+	for n, ch := range chans {
+		if len(ch.name) > maxNameLen {
+			return attributeError(i, "channels", "channel name %q is longer than %d bytes", ch.name, maxNameLen)
+		}
+		if n > 0 && ch.name == chans[n-1].name {
+			return attributeError(i, "channels", "duplicate channel name %q", ch.name)
+		}
+		if n > 0 && ch.name < chans[n-1].name {
+			return attributeError(i, "channels", "channel %q is not sorted after %q", ch.name, chans[n-1].name)
+		}
+		if ch.pixelType < UINT || ch.pixelType > FLOAT {
+			return attributeError(i, "channels", "channel %q: unknown pixel type %d", ch.name, ch.pixelType)
+		}
+		if ch.xSampling < 1 || ch.ySampling < 1 {
+			return attributeError(i, "channels", "channel %q: invalid sampling (%d, %d)", ch.name, ch.xSampling, ch.ySampling)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package exr
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestValidateVersion(t *testing.T) {
+	cases := []struct {
+		v  uint32
+		ok bool
+	}{
+		{2, true},
+		{2 | 0x200 | 0x400, true},
+		{2 | 0x1000 | 0x800, true},
+		{1, false},
+		{3 | 0x200, false},
+		{2 | 0x2000, false},
+		{2 | 0x100, false},
+	}
+	for _, c := range cases {
+		err := validateVersion(c.v)
+		if (err == nil) != c.ok {
+			t.Fatalf("version field %#x: got error %v, want ok %v", c.v, err, c.ok)
+		}
+		if err != nil && !strings.Contains(err.Error(), "version field") {
+			t.Fatalf("version field %#x: error doesn't name the version field: %v", c.v, err)
+		}
+	}
+}
+
+func TestValidateHeaders(t *testing.T) {
+	rect := image.Rect(0, 0, 2, 2)
+	m := &Image{
+		Header: make(Header),
+		Rect:   rect,
+		Channels: []*Channel{
+			{Name: "G", Type: HALF, XSampling: 1, YSampling: 1, Rect: rect, Float: make([]float32, 4)},
+			{Name: "R", Type: HALF, XSampling: 1, YSampling: 1, Rect: rect, Float: make([]float32, 4)},
+		},
+	}
+	valid := encodeBytes(t, m, nil)
+	r := bufio.NewReader(bytes.NewReader(valid))
+	vf, err := readVersion(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, err := readHeaders(r, vf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chlist := func(names ...string) []byte {
+		var chans chlist
+		for _, n := range names {
+			chans = append(chans, channel{name: n, pixelType: HALF, xSampling: 1, ySampling: 1})
+		}
+		return chlistToBytes(chans)
+	}
+
+	cases := []struct {
+		name   string
+		attr   string // attribute that should be named in the error, or "" when valid
+		modify func(vf *VersionField, h Header)
+	}{
+		{"valid", "", func(vf *VersionField, h Header) {}},
+		{"long attribute name", "a.long.attribute.name.of.32.bytes", func(vf *VersionField, h Header) {
+			h.SetFloat("a.long.attribute.name.of.32.bytes", 1)
+		}},
+		{"long attribute name with long name bit", "", func(vf *VersionField, h Header) {
+			h.SetFloat("a.long.attribute.name.of.32.bytes", 1)
+			vf.longName = true
+		}},
+		{"long channel name", "channels", func(vf *VersionField, h Header) {
+			h.SetAttribute("channels", "chlist", chlist("G", "R", "a.long.channel.name.of.32.bytes."))
+		}},
+		{"long type name", "custom", func(vf *VersionField, h Header) {
+			h.SetAttribute("custom", "a_long_type_name_that_has_32bytes", nil)
+		}},
+		{"missing dataWindow", "dataWindow", func(vf *VersionField, h Header) {
+			h.Delete("dataWindow")
+		}},
+		{"missing displayWindow", "displayWindow", func(vf *VersionField, h Header) {
+			h.Delete("displayWindow")
+		}},
+		{"missing tiles", "tiles", func(vf *VersionField, h Header) {
+			vf.tiled = true
+		}},
+		{"missing part name", "name", func(vf *VersionField, h Header) {
+			vf.multiPart = true
+			h.SetString("type", "scanlineimage")
+			h.SetInt("chunkCount", 2)
+		}},
+		{"missing chunkCount", "chunkCount", func(vf *VersionField, h Header) {
+			vf.multiPart = true
+			h.SetString("name", "rgba")
+			h.SetString("type", "scanlineimage")
+		}},
+		{"unknown part type", "type", func(vf *VersionField, h Header) {
+			h.SetString("type", "volume")
+		}},
+		{"deep type without deep bit", "type", func(vf *VersionField, h Header) {
+			h.SetString("type", "deepscanline")
+		}},
+		{"wrong attribute type", "dataWindow", func(vf *VersionField, h Header) {
+			h.SetAttribute("dataWindow", "box2f", make([]byte, 16))
+		}},
+		{"wrong attribute size", "lineOrder", func(vf *VersionField, h Header) {
+			h.SetAttribute("lineOrder", "lineOrder", []byte{0, 0})
+		}},
+		{"dataWindow min > max", "dataWindow", func(vf *VersionField, h Header) {
+			h.SetAttribute("dataWindow", "box2i", box2iToBytes(box2i{2, 0, 1, 1}))
+		}},
+		{"displayWindow min > max", "displayWindow", func(vf *VersionField, h Header) {
+			h.SetAttribute("displayWindow", "box2i", box2iToBytes(box2i{0, 2, 1, 1}))
+		}},
+		{"zero tile size", "tiles", func(vf *VersionField, h Header) {
+			vf.tiled = true
+			h.SetAttribute("tiles", "tiledesc", []byte{0, 0, 0, 0, 1, 0, 0, 0, 0})
+		}},
+		{"unknown level mode", "tiles", func(vf *VersionField, h Header) {
+			vf.tiled = true
+			h.SetAttribute("tiles", "tiledesc", []byte{1, 0, 0, 0, 1, 0, 0, 0, 3})
+		}},
+		{"unknown rounding mode", "tiles", func(vf *VersionField, h Header) {
+			vf.tiled = true
+			h.SetAttribute("tiles", "tiledesc", []byte{1, 0, 0, 0, 1, 0, 0, 0, 0x21})
+		}},
+		{"duplicate channels", "channels", func(vf *VersionField, h Header) {
+			h.SetAttribute("channels", "chlist", chlist("G", "R", "R"))
+		}},
+		{"unsorted channels", "channels", func(vf *VersionField, h Header) {
+			h.SetAttribute("channels", "chlist", chlist("R", "G"))
+		}},
+		{"truncated channels", "channels", func(vf *VersionField, h Header) {
+			b := chlist("G", "R")
+			h.SetAttribute("channels", "chlist", b[:len(b)-1])
+		}},
+		{"bytes after channels", "channels", func(vf *VersionField, h Header) {
+			h.SetAttribute("channels", "chlist", append(chlist("G", "R"), 0))
+		}},
+		{"unknown compression", "compression", func(vf *VersionField, h Header) {
+			h.SetAttribute("compression", "compression", []byte{10})
+		}},
+		{"unknown line order", "lineOrder", func(vf *VersionField, h Header) {
+			h.SetAttribute("lineOrder", "lineOrder", []byte{3})
+		}},
+		{"zero pixel aspect ratio", "pixelAspectRatio", func(vf *VersionField, h Header) {
+			h.SetPixelAspectRatio(0)
+		}},
+	}
+	for _, c := range cases {
+		vf := vf
+		h := headers[0].copy()
+		c.modify(&vf, h)
+		b := append(versionToBytes(vf), headersToBytes(vf, []Header{h})...)
+		r := bufio.NewReader(bytes.NewReader(b))
+		rvf, err := readVersion(r)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		_, err = readHeaders(r, rvf, nil)
+		if c.attr == "" {
+			if err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+			continue
+		}
+		if _, ok := err.(FormatError); !ok {
+			t.Fatalf("%s: got error %v, want a FormatError", c.name, err)
+		}
+		if !strings.Contains(err.Error(), "\""+c.attr+"\"") {
+			t.Fatalf("%s: error doesn't name attribute %q: %v", c.name, c.attr, err)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package exr
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+)
+
+// A multi-view image has images of several views of a scene, such as a stereo image
+// that has a view for each eye. It is stored in one of two layouts.
+//
+// In a single part image, the multiView attribute lists the views, and the first one
+// is the default view. The view of a channel is the second to last component
+// of it's name, such as left in left.R or forward.left.u. Channels those names
+// don't have a dot, such as R, belong to the default view. Other channels, those
+// second to last component is not a view, such as disparityL.x, don't belong to any view.
+//
+// In a multi-part image, each part belongs to the view of it's view attribute,
+// and names of it's channels don't have the view.
+
+// Names of the views of a stereo image.
+const (
+	LeftView  = "left"
+	RightView = "right"
+)
+
+// MultiView returns names of the views in the multiView attribute.
+// The first one is the default view. It returns nil when the header doesn't have
+// the attribute, or the attribute is broken.
+func (h Header) MultiView() []string {
+	attr, ok := h["multiView"]
+	if !ok {
+		return nil
+	}
+	views, err := stringvectorFromBytes(attr.value)
+	if err != nil {
+		return nil
+	}
+	return views
+}
+
+// SetMultiView sets the multiView attribute of the header.
+func (h Header) SetMultiView(views []string) {
+	h.SetAttribute("multiView", "stringvector", stringvectorToBytes(views))
+}
+
+// View returns the view attribute, that is the view of a part in a multi-part image.
+// It returns an empty string when the header doesn't have the attribute.
+func (h Header) View() string {
+	attr, ok := h["view"]
+	if !ok {
+		return ""
+	}
+	return string(attr.value)
+}
+
+// SetView sets the view attribute of the header.
+func (h Header) SetView(view string) {
+	h.SetString("view", view)
+}
+
+// viewOf returns the view of the named channel, in a single part image of the views.
+// It returns an empty string when the channel doesn't belong to any view.
+func viewOf(name string, views []string) string {
+	if len(views) == 0 {
+		return ""
+	}
+	s := strings.Split(name, ".")
+	if len(s) == 1 {
+		return views[0]
+	}
+	v := s[len(s)-2]
+	for _, view := range views {
+		if v == view {
+			return v
+		}
+	}
+	return ""
+}
+
+// removeView returns the channel name without it's view component.
+// The channel should belong to a view.
+func removeView(name string) string {
+	s := strings.Split(name, ".")
+	if len(s) == 1 {
+		return name
+	}
+	return strings.Join(append(s[:len(s)-2:len(s)-2], s[len(s)-1]), ".")
+}
+
+// insertView returns the channel name with the view component,
+// as the reverse of removeView. Names those don't have a dot keep
+// unchanged in the default view.
+func insertView(name, view string, isDefault bool) string {
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		if isDefault {
+			return name
+		}
+		return view + "." + name
+	}
+	return name[:i] + "." + view + name[i:]
+}
+
+// Views returns names of the views in the multiView attribute of the image's header.
+// The first one is the default view.
+func (m *Image) Views() []string {
+	return m.Header.MultiView()
+}
+
+// View returns an image of the named view, that has channels of the view
+// without the view component in their names. For example, left.R and
+// forward.left.u channels become R and forward.u channels of left view.
+// It shares pixel values with m, and has a copy of m's header
+// without the multiView attribute.
+//
+// For a part of a multi-part image, it returns m itself when the part belongs to the view.
+// It returns nil when m doesn't have the view.
+func (m *Image) View(name string) *Image {
+	views := m.Views()
+	if views == nil {
+		if name != "" && m.Header.View() == name {
+			return m
+		}
+		return nil
+	}
+	if !hasView(views, name) {
+		return nil
+	}
+	h := m.Header.copy()
+	h.Delete("multiView")
+	v := &Image{
+		Header: h,
+		Rect:   m.Rect,
+	}
+	for _, c := range m.Channels {
+		if viewOf(c.Name, views) != name {
+			continue
+		}
+		vc := *c
+		vc.Name = removeView(c.Name)
+		v.Channels = append(v.Channels, &vc)
+	}
+	sortChannels(v.Channels)
+	return v
+}
+
+func hasView(views []string, view string) bool {
+	for _, v := range views {
+		if v == view {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeView reads the named view of a multi-view exr image from the file,
+// in either layout. Channels of o are names in the view, such as R instead of left.R.
+//
+// Parts of a multi-part image that belong to the view are merged into an image,
+// those bounds are the union of their data windows. It has a copy of the first
+// part's header. Like Decode, it returns a non-nil image with an *IncompleteError.
+func DecodeView(path, view string, o *DecodeOptions) (*Image, error) {
+	if o == nil {
+		o = &DecodeOptions{}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	d, err := newDecoder(f, fi.Size(), o.Limits)
+	if err != nil {
+		return nil, err
+	}
+
+	if views := d.headers[0].MultiView(); views != nil {
+		if !hasView(views, view) {
+			return nil, fmt.Errorf("exr: image doesn't have view %q", view)
+		}
+		m, err := d.decodeChannels(0, o, func(name string) bool {
+			if viewOf(name, views) != view {
+				return false
+			}
+			return len(o.Channels) == 0 || channelSelected(removeView(name), o.Channels)
+		})
+		if m == nil {
+			return nil, err
+		}
+		return o.reframe(m.View(view)), err
+	}
+
+	var parts []*Image
+	var incomplete *IncompleteError
+	for i, h := range d.headers {
+		if h.View() != view {
+			continue
+		}
+		m, err := d.decodePart(i, o)
+		if m == nil {
+			return nil, err
+		}
+		if err != nil {
+			ie, ok := err.(*IncompleteError)
+			if !ok {
+				return nil, err
+			}
+			incomplete = mergeIncomplete(incomplete, ie)
+		}
+		parts = append(parts, m)
+	}
+	if parts == nil {
+		return nil, fmt.Errorf("exr: image doesn't have view %q", view)
+	}
+	var rect image.Rectangle
+	var chans chlist
+	for _, p := range parts {
+		rect = rect.Union(p.Rect)
+		for _, c := range p.Channels {
+			chans = append(chans, channel{xSampling: int32(c.XSampling), ySampling: int32(c.YSampling)})
+		}
+	}
+	// Parts are checked one by one while decoded, the merged image should be checked again.
+	if err := d.limits.checkRect(rect); err != nil {
+		return nil, err
+	}
+	if err := d.limits.checkAllocation(d.tableSize + pixelBytes(chans, rect)); err != nil {
+		return nil, err
+	}
+	m := &Image{
+		Header: parts[0].Header.copy(),
+		Rect:   rect,
+	}
+	for _, p := range parts {
+		for _, c := range p.Reframe(rect).Channels {
+			if m.Channel(c.Name) != nil {
+				return nil, FormatError(fmt.Sprintf("channel %q is in multiple parts of view %q", c.Name, view))
+			}
+			m.Channels = append(m.Channels, c)
+		}
+	}
+	sortChannels(m.Channels)
+	if incomplete != nil {
+		return o.reframe(m), incomplete
+	}
+	return o.reframe(m), nil
+}
+
+// mergeIncomplete returns an *IncompleteError that reports the chunks of both errors.
+// a could be nil.
+func mergeIncomplete(a, b *IncompleteError) *IncompleteError {
+	if a == nil {
+		return b
+	}
+	return &IncompleteError{Chunks: append(a.Chunks, b.Chunks...)}
+}
+
+// viewImages returns the images as *Image, after validating the views.
+func viewImages(views []string, images []image.Image, o *Options) ([]*Image, error) {
+	if len(views) == 0 || len(views) != len(images) {
+		return nil, fmt.Errorf("exr: got %d views and %d images, want the same non-zero numbers", len(views), len(images))
+	}
+	seen := make(map[string]bool)
+	for _, v := range views {
+		if v == "" || strings.Contains(v, ".") || seen[v] {
+			return nil, fmt.Errorf("exr: invalid or duplicate view name %q", v)
+		}
+		seen[v] = true
+	}
+	typ := FLOAT
+	if o.Half {
+		typ = HALF
+	}
+	ms := make([]*Image, len(images))
+	for i, m := range images {
+		img, ok := m.(*Image)
+		if !ok {
+			img = rgbaImage(m, typ)
+		}
+		ms[i] = img
+	}
+	return ms, nil
+}
+
+// EncodeViews writes images of the views to w, as a single part multi-view image.
+// The first view is the default view. For example, left and right images
+// of a stereo image are written with views of []string{LeftView, RightView}.
+//
+// Channels of each image are renamed to have their view, such as right.R or forward.right.u.
+// Channels of the default view those names don't have a dot keep their names.
+// All images are written in bounds of the first image, and it's header
+// is used when it is an *Image. Options are applied like Encode.
+func EncodeViews(w io.Writer, views []string, images []image.Image, o *Options) error {
+	if o == nil {
+		o = &Options{}
+	}
+	ms, err := viewImages(views, images, o)
+	if err != nil {
+		return err
+	}
+	h := ms[0].Header.copy()
+	h.Delete("view")
+	h.SetMultiView(views)
+	m := &Image{
+		Header: h,
+		Rect:   ms[0].Rect,
+	}
+	for i, v := range ms {
+		for _, c := range v.Reframe(m.Rect).Channels {
+			vc := *c
+			vc.Name = insertView(c.Name, views[i], i == 0)
+			m.Channels = append(m.Channels, &vc)
+		}
+	}
+	return Encode(w, m, o)
+}
+
+// EncodeViewParts writes images of the views to w, as a multi-part image
+// that has a part for each view. Each part is named after it's view,
+// and has the view attribute. Options are applied to each part like Encode.
+func EncodeViewParts(w io.Writer, views []string, images []image.Image, o *Options) error {
+	if o == nil {
+		o = &Options{}
+	}
+	ms, err := viewImages(views, images, o)
+	if err != nil {
+		return err
+	}
+	parts := make([]*encoder, len(ms))
+	for i, m := range ms {
+		e, err := newImageEncoder(m, o)
+		if err != nil {
+			return err
+		}
+		e.header.Delete("multiView")
+		e.header.SetString("name", views[i])
+		e.header.SetView(views[i])
+		parts[i] = e
+	}
+	return encodeParts(w, parts, true)
+}
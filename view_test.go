@@ -0,0 +1,211 @@
+package exr
+
+import (
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestViewChannelNames(t *testing.T) {
+	views := []string{"right", "left"}
+	cases := []struct {
+		name    string
+		view    string
+		removed string
+	}{
+		{"R", "right", "R"},
+		{"left.R", "left", "R"},
+		{"forward.left.u", "left", "forward.u"},
+		{"forward.right.u", "right", "forward.u"},
+		{"disparityL.x", "", ""},
+		{"center.R", "", ""},
+	}
+	for _, c := range cases {
+		if got := viewOf(c.name, views); got != c.view {
+			t.Fatalf("view of %q: got %q, want %q", c.name, got, c.view)
+		}
+		if c.view == "" {
+			continue
+		}
+		if got := removeView(c.name); got != c.removed {
+			t.Fatalf("%q without view: got %q, want %q", c.name, got, c.removed)
+		}
+		if got := insertView(c.removed, c.view, c.view == views[0]); got != c.name {
+			t.Fatalf("%q with view %q: got %q, want %q", c.removed, c.view, got, c.name)
+		}
+	}
+
+	hs, err := DecodeHeader("image/singlepart.exr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hs[0].MultiView(); !reflect.DeepEqual(got, views) {
+		t.Fatalf("singlepart.exr multiView: got %q, want %q", got, views)
+	}
+	var left []string
+	chans, err := chlistFromBytes(hs[0]["channels"].value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range chans {
+		if viewOf(ch.name, views) == LeftView {
+			left = append(left, removeView(ch.name))
+		}
+	}
+	if want := []string{"forward.u", "forward.v", "A", "B", "G", "R", "Z", "whitebarmask.mask"}; !reflect.DeepEqual(left, want) {
+		t.Fatalf("singlepart.exr channels of left view: got %q, want %q", left, want)
+	}
+
+	hs, err = DecodeHeader("image/multipart.exr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hs[0].View(), RightView; got != want {
+		t.Fatalf("multipart.exr view of the first part: got %q, want %q", got, want)
+	}
+}
+
+// writeTemp writes a file with write, and returns path of the file.
+// The caller should remove the file after use.
+func writeTemp(t *testing.T, write func(w io.Writer) error) string {
+	dir, err := ioutil.TempDir("", "exr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "test.exr")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := write(f); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// stereoImages returns left and right images, those have different pixel values.
+func stereoImages(rect image.Rectangle) (left, right *Image) {
+	eye := func(v float32) *Image {
+		n := rect.Dx() * rect.Dy()
+		plane := func(v float32) []float32 {
+			p := make([]float32, n)
+			for i := range p {
+				p[i] = v + float32(i)
+			}
+			return p
+		}
+		return &Image{
+			Header: make(Header),
+			Rect:   rect,
+			Channels: []*Channel{
+				{Name: "G", Type: HALF, XSampling: 1, YSampling: 1, Rect: rect, Float: plane(v)},
+				{Name: "R", Type: HALF, XSampling: 1, YSampling: 1, Rect: rect, Float: plane(v + 100)},
+				{Name: "forward.u", Type: FLOAT, XSampling: 1, YSampling: 1, Rect: rect, Float: plane(v + 200)},
+			},
+		}
+	}
+	return eye(1), eye(1000)
+}
+
+func TestEncodeViews(t *testing.T) {
+	rect := image.Rect(0, 0, 3, 2)
+	left, right := stereoImages(rect)
+	path := writeTemp(t, func(w io.Writer) error {
+		return EncodeViews(w, []string{LeftView, RightView}, []image.Image{left, right}, nil)
+	})
+	defer os.RemoveAll(filepath.Dir(path))
+
+	hs, err := DecodeHeader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hs) != 1 {
+		t.Fatalf("got %d parts, want 1", len(hs))
+	}
+	var names []string
+	chans, err := chlistFromBytes(hs[0]["channels"].value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range chans {
+		names = append(names, ch.name)
+	}
+	want := []string{"G", "R", "forward.left.u", "forward.right.u", "right.G", "right.R"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("channels: got %q, want %q", names, want)
+	}
+
+	m, err := DecodeWithOptions(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Views(), []string{LeftView, RightView}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("views: got %q, want %q", got, want)
+	}
+	compareChannels(t, m.View(LeftView), left)
+	compareChannels(t, m.View(RightView), right)
+	if m.View("center") != nil {
+		t.Fatalf("got an image of a missing view")
+	}
+
+	r, err := DecodeView(path, RightView, &DecodeOptions{Channels: []string{"forward"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Channels) != 1 || r.Channels[0].Name != "forward.u" {
+		t.Fatalf("channels of the selected right view: got %v", r.Channels)
+	}
+	compareChannels(t, r, &Image{Channels: right.Channels[2:]})
+}
+
+func TestEncodeViewParts(t *testing.T) {
+	left, right := stereoImages(image.Rect(0, 0, 3, 2))
+	path := writeTemp(t, func(w io.Writer) error {
+		return EncodeViewParts(w, []string{LeftView, RightView}, []image.Image{left, right}, nil)
+	})
+	defer os.RemoveAll(filepath.Dir(path))
+
+	hs, err := DecodeHeader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hs) != 2 {
+		t.Fatalf("got %d parts, want 2", len(hs))
+	}
+	for i, view := range []string{LeftView, RightView} {
+		if got := hs[i].View(); got != view {
+			t.Fatalf("view of part %d: got %q, want %q", i, got, view)
+		}
+		if _, _, ok := hs[i].Attribute("multiView"); ok {
+			t.Fatalf("part %d has multiView attribute", i)
+		}
+	}
+
+	for view, want := range map[string]*Image{LeftView: left, RightView: right} {
+		m, err := DecodeView(path, view, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Rect != want.Rect {
+			t.Fatalf("bounds of %s view: got %v, want %v", view, m.Rect, want.Rect)
+		}
+		compareChannels(t, m, want)
+	}
+	if _, err := DecodeView(path, "center", nil); err == nil {
+		t.Fatalf("decoded a missing view")
+	}
+
+	// The first part is also decoded as a single view image.
+	m, err := DecodeWithOptions(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.View(LeftView) != m || m.View(RightView) != nil {
+		t.Fatalf("first part is not the left view")
+	}
+}
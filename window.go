@@ -0,0 +1,154 @@
+package exr
+
+import (
+	"image"
+	"math"
+)
+
+// The data window of an image is the region that has pixel values,
+// and the display window is the region that is meant to be displayed.
+// They could differ: the data window could be smaller than the display window,
+// or larger, to have extra pixels around it (overscan).
+// Both could have negative origins.
+//
+// Coordinates of the windows are inclusive in exr files,
+// while image.Rectangle excludes the maximum point.
+
+// rect returns the box in image.Rectangle form.
+func (b box2i) rect() image.Rectangle {
+	return image.Rect(int(b.xMin), int(b.yMin), int(b.xMax)+1, int(b.yMax)+1)
+}
+
+// box2iFromRect returns a box that covers the same pixels with r.
+func box2iFromRect(r image.Rectangle) box2i {
+	return box2i{
+		xMin: int32(r.Min.X),
+		yMin: int32(r.Min.Y),
+		xMax: int32(r.Max.X - 1),
+		yMax: int32(r.Max.Y - 1),
+	}
+}
+
+// box2iAttribute returns the named box2i attribute in image.Rectangle form.
+func (h Header) box2iAttribute(name string) (image.Rectangle, bool) {
+	attr, ok := h[name]
+	if !ok || attr.typ != "box2i" {
+		return image.Rectangle{}, false
+	}
+	b, err := box2iFromBytes(attr.value)
+	if err != nil {
+		return image.Rectangle{}, false
+	}
+	return b.rect(), true
+}
+
+// floatAttribute returns the named float attribute.
+func (h Header) floatAttribute(name string) (float32, bool) {
+	attr, ok := h[name]
+	if !ok || attr.typ != "float" || len(attr.value) != 4 {
+		return 0, false
+	}
+	return math.Float32frombits(parse.Uint32(attr.value)), true
+}
+
+// DataWindow returns the data window of the header.
+// It returns an empty rectangle when the header doesn't have the attribute.
+func (h Header) DataWindow() image.Rectangle {
+	r, _ := h.box2iAttribute("dataWindow")
+	return r
+}
+
+// DisplayWindow returns the display window of the header.
+// It returns the data window when the header doesn't have the attribute.
+func (h Header) DisplayWindow() image.Rectangle {
+	if r, ok := h.box2iAttribute("displayWindow"); ok {
+		return r
+	}
+	return h.DataWindow()
+}
+
+// SetDisplayWindow sets the display window of the header.
+func (h Header) SetDisplayWindow(r image.Rectangle) {
+	h.SetAttribute("displayWindow", "box2i", box2iToBytes(box2iFromRect(r)))
+}
+
+// PixelAspectRatio returns width divided by height of a pixel,
+// when the image is displayed. It returns 1 when the header doesn't have the attribute.
+func (h Header) PixelAspectRatio() float32 {
+	if v, ok := h.floatAttribute("pixelAspectRatio"); ok {
+		return v
+	}
+	return 1
+}
+
+// SetPixelAspectRatio sets the pixel aspect ratio of the header.
+func (h Header) SetPixelAspectRatio(v float32) {
+	h.SetFloat("pixelAspectRatio", v)
+}
+
+// ScreenWindowCenter returns center of the screen window,
+// that is the region of the display window projected on the image plane
+// at distance 1 from the camera. It returns (0, 0) when the header doesn't have the attribute.
+func (h Header) ScreenWindowCenter() (x, y float32) {
+	attr, ok := h["screenWindowCenter"]
+	if !ok || attr.typ != "v2f" {
+		return 0, 0
+	}
+	v, err := v2fFromBytes(attr.value)
+	if err != nil {
+		return 0, 0
+	}
+	return v[0], v[1]
+}
+
+// SetScreenWindowCenter sets center of the screen window of the header.
+func (h Header) SetScreenWindowCenter(x, y float32) {
+	h.SetAttribute("screenWindowCenter", "v2f", v2fToBytes(v2f{x, y}))
+}
+
+// ScreenWindowWidth returns width of the screen window.
+// It returns 1 when the header doesn't have the attribute.
+func (h Header) ScreenWindowWidth() float32 {
+	if v, ok := h.floatAttribute("screenWindowWidth"); ok {
+		return v
+	}
+	return 1
+}
+
+// SetScreenWindowWidth sets width of the screen window of the header.
+func (h Header) SetScreenWindowWidth(v float32) {
+	h.SetFloat("screenWindowWidth", v)
+}
+
+// Reframe returns an image those bounds are r, that has the same channels with m.
+// Pixels of m outside of r are dropped, and pixels in r outside of m are 0.
+// It is useful to get pixels in the display window.
+//
+// The header of the returned image is shared with m.
+// When r is the same with bounds of m, it returns m itself.
+func (m *Image) Reframe(r image.Rectangle) *Image {
+	if r == m.Rect {
+		return m
+	}
+	u := &Image{
+		Header:   m.Header,
+		Rect:     r,
+		Channels: make([]*Channel, len(m.Channels)),
+	}
+	for i, c := range m.Channels {
+		nc := newChannel(c.channel(), r)
+		nc.PLinear = c.PLinear
+		in := nc.Rect.Intersect(c.Rect)
+		for y := in.Min.Y; y < in.Max.Y; y++ {
+			src := c.PixOffset(in.Min.X, y)
+			dst := nc.PixOffset(in.Min.X, y)
+			if c.Uint != nil {
+				copy(nc.Uint[dst:dst+in.Dx()], c.Uint[src:src+in.Dx()])
+			} else {
+				copy(nc.Float[dst:dst+in.Dx()], c.Float[src:src+in.Dx()])
+			}
+		}
+		u.Channels[i] = nc
+	}
+	return u
+}
@@ -0,0 +1,123 @@
+package exr
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHeaderWindows(t *testing.T) {
+	h := make(Header)
+	if got := h.PixelAspectRatio(); got != 1 {
+		t.Fatalf("default pixelAspectRatio: got %v, want 1", got)
+	}
+	if x, y := h.ScreenWindowCenter(); x != 0 || y != 0 {
+		t.Fatalf("default screenWindowCenter: got (%v, %v), want (0, 0)", x, y)
+	}
+	if got := h.ScreenWindowWidth(); got != 1 {
+		t.Fatalf("default screenWindowWidth: got %v, want 1", got)
+	}
+	h.SetAttribute("dataWindow", "box2i", box2iToBytes(box2i{-2, -1, 3, 4}))
+	if got, want := h.DisplayWindow(), image.Rect(-2, -1, 4, 5); got != want {
+		t.Fatalf("displayWindow without the attribute: got %v, want %v", got, want)
+	}
+	h.SetDisplayWindow(image.Rect(0, 0, 1920, 1080))
+	h.SetPixelAspectRatio(2)
+	h.SetScreenWindowCenter(0.5, -0.5)
+	h.SetScreenWindowWidth(3)
+	if got, want := h.DisplayWindow(), image.Rect(0, 0, 1920, 1080); got != want {
+		t.Fatalf("displayWindow: got %v, want %v", got, want)
+	}
+	if got := h.PixelAspectRatio(); got != 2 {
+		t.Fatalf("pixelAspectRatio: got %v, want 2", got)
+	}
+	if x, y := h.ScreenWindowCenter(); x != 0.5 || y != -0.5 {
+		t.Fatalf("screenWindowCenter: got (%v, %v), want (0.5, -0.5)", x, y)
+	}
+	if got := h.ScreenWindowWidth(); got != 3 {
+		t.Fatalf("screenWindowWidth: got %v, want 3", got)
+	}
+
+	hs, err := DecodeHeader("image/singlepart.exr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hs[0].DataWindow(), image.Rect(654, 245, 1565, 1121); got != want {
+		t.Fatalf("singlepart.exr dataWindow: got %v, want %v", got, want)
+	}
+	if got, want := hs[0].DisplayWindow(), image.Rect(0, 0, 2048, 1556); got != want {
+		t.Fatalf("singlepart.exr displayWindow: got %v, want %v", got, want)
+	}
+}
+
+func TestDecodeDisplayWindow(t *testing.T) {
+	// The data window has a negative origin, and overscan around the display window.
+	rect := image.Rect(-4, -2, 6, 4)
+	value := func(x, y int) float32 {
+		return float32(100*y + x)
+	}
+	y := &Channel{Name: "Y", Type: FLOAT, Rect: rect}
+	for py := rect.Min.Y; py < rect.Max.Y; py++ {
+		for px := rect.Min.X; px < rect.Max.X; px++ {
+			y.Float = append(y.Float, value(px, py))
+		}
+	}
+	src := &Image{Header: make(Header), Rect: rect, Channels: []*Channel{y}}
+	display := image.Rect(0, 0, 8, 6)
+	h := make(Header)
+	h.SetDisplayWindow(display)
+	path := encodeTemp(t, src, &Options{Header: h})
+	defer os.RemoveAll(filepath.Dir(path))
+
+	m, err := DecodeWithOptions(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds() != rect {
+		t.Fatalf("bounds: got %v, want %v", m.Bounds(), rect)
+	}
+	c := m.Channel("Y")
+	for _, p := range []image.Point{rect.Min, {5, 3}, {-4, 3}, {5, -2}} {
+		if got, want := c.FloatAt(p.X, p.Y), value(p.X, p.Y); got != want {
+			t.Fatalf("pixel at %v: got %v, want %v", p, got, want)
+		}
+	}
+
+	m, err = DecodeWithOptions(path, &DecodeOptions{DisplayWindow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds() != display {
+		t.Fatalf("bounds: got %v, want %v", m.Bounds(), display)
+	}
+	c = m.Channel("Y")
+	for py := display.Min.Y; py < display.Max.Y; py++ {
+		for px := display.Min.X; px < display.Max.X; px++ {
+			want := float32(0)
+			if (image.Point{px, py}).In(rect) {
+				want = value(px, py)
+			}
+			if got := c.FloatAt(px, py); got != want {
+				t.Fatalf("pixel at (%d, %d): got %v, want %v", px, py, got, want)
+			}
+		}
+	}
+}
+
+func TestReframeSubsampled(t *testing.T) {
+	rect := image.Rect(0, 0, 4, 4)
+	ry := &Channel{Name: "RY", Type: HALF, XSampling: 2, YSampling: 2, Rect: image.Rect(0, 0, 2, 2), Float: []float32{1, 2, 3, 4}}
+	m := &Image{Header: make(Header), Rect: rect, Channels: []*Channel{ry}}
+	u := m.Reframe(image.Rect(-2, 2, 4, 6))
+	c := u.Channel("RY")
+	if want := image.Rect(-1, 1, 2, 3); c.Rect != want {
+		t.Fatalf("bounds of the channel: got %v, want %v", c.Rect, want)
+	}
+	want := []float32{0, 3, 4, 0, 0, 0}
+	for i, v := range want {
+		if c.Float[i] != v {
+			t.Fatalf("pixel values: got %v, want %v", c.Float, want)
+		}
+	}
+}
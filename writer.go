@@ -0,0 +1,178 @@
+package exr
+
+import (
+	"fmt"
+	"io"
+)
+
+// Writer writes a single part scanline image without compression, lines by lines.
+// It lets a renderer write lines as soon as they are finished,
+// without keeping the whole image in memory.
+//
+// The line order decides the order of lines to write.
+// With INCREASING_Y, lines should be written from the top,
+// and with DECREASING_Y, from the bottom. With RANDOM_Y, lines could be
+// written in any order, such as in the order of finished buckets.
+// Chunks are stored in the file in the order they are written.
+type Writer struct {
+	w       io.WriteSeeker
+	e       *encoder
+	vf      VersionField
+	start   int64 // position of the magic number in w
+	offsets []uint64
+	written int    // number of written lines
+	pos     uint64 // offset of the next chunk from the magic number
+	closed  bool
+}
+
+// NewWriter writes the header of an image to w, and returns a Writer
+// that writes lines of the image.
+//
+// m describes the image to write: it's header, bounds and channels.
+// Pixel values of m aren't used, and could be nil.
+// Header and LineOrder of o are used like Encode.
+// Preview, LuminanceChroma and ACES options need the whole image, and aren't supported.
+func NewWriter(w io.WriteSeeker, m *Image, o *Options) (*Writer, error) {
+	if o == nil {
+		o = &Options{}
+	}
+	if o.Preview || o.LuminanceChroma || o.ACES {
+		return nil, UnsupportedError("preview, luminance/chroma or ACES options for Writer")
+	}
+	e := newEncoder(m.Rect)
+	e.lineOrder = o.LineOrder
+	for name, attr := range m.Header {
+		e.header[name] = attr
+	}
+	for _, name := range []string{"chunkCount", "tiles", "type"} {
+		delete(e.header, name)
+	}
+	for name, attr := range o.Header {
+		e.header[name] = attr
+	}
+	for _, c := range m.Channels {
+		e.addChannel(c)
+	}
+	vf, err := e.prepare()
+	if err != nil {
+		return nil, err
+	}
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	_, height := e.size()
+	wr := &Writer{
+		w:       w,
+		e:       e,
+		vf:      vf,
+		start:   start,
+		offsets: make([]uint64, height),
+	}
+	headerBytes := headersToBytes(vf, []Header{e.header})
+	if _, err := w.Write(versionToBytes(vf)); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(headerBytes); err != nil {
+		return nil, err
+	}
+	// The offset table is filled when the Writer is closed.
+	if _, err := w.Write(offsetsToBytes(wr.offsets)); err != nil {
+		return nil, err
+	}
+	wr.pos = uint64(8 + len(headerBytes) + 8*len(wr.offsets))
+	return wr, nil
+}
+
+// WriteLines writes lines of m to the image. Bounds of m should cover
+// the full width of the image, and it should have all channels of the image.
+// Lines should be written in the order decided by the line order,
+// and each line could be written only once.
+func (w *Writer) WriteLines(m *Image) error {
+	if w.closed {
+		return fmt.Errorf("exr: write lines to a closed Writer")
+	}
+	rect := w.e.rect()
+	if m.Rect.Empty() {
+		return nil
+	}
+	if m.Rect.Min.X != rect.Min.X || m.Rect.Max.X != rect.Max.X || !m.Rect.In(rect) {
+		return FormatError(fmt.Sprintf("lines %v are not full width lines in %v", m.Rect, rect))
+	}
+	channels := make([]*Channel, len(w.e.channels))
+	for i, c := range w.e.channels {
+		mc := m.Channel(c.Name)
+		if mc == nil {
+			return FormatError(fmt.Sprintf("missing channel %q", c.Name))
+		}
+		if mc.channel() != c.channel() {
+			return FormatError(fmt.Sprintf("channel %q has different pixel type or sampling rates", c.Name))
+		}
+		if err := validatePixels(mc, m.Rect); err != nil {
+			return err
+		}
+		channels[i] = mc
+	}
+
+	lines := make([]int, 0, m.Rect.Dy())
+	switch w.e.lineOrder {
+	case INCREASING_Y:
+		if m.Rect.Min.Y != rect.Min.Y+w.written {
+			return FormatError(fmt.Sprintf("lines should be written from the top: got line %d, want line %d", m.Rect.Min.Y, rect.Min.Y+w.written))
+		}
+		for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+			lines = append(lines, y)
+		}
+	case DECREASING_Y:
+		if m.Rect.Max.Y-1 != rect.Max.Y-1-w.written {
+			return FormatError(fmt.Sprintf("lines should be written from the bottom: got line %d, want line %d", m.Rect.Max.Y-1, rect.Max.Y-1-w.written))
+		}
+		for y := m.Rect.Max.Y - 1; y >= m.Rect.Min.Y; y-- {
+			lines = append(lines, y)
+		}
+	default:
+		for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+			if w.offsets[y-rect.Min.Y] != 0 {
+				return FormatError(fmt.Sprintf("line %d is already written", y))
+			}
+			lines = append(lines, y)
+		}
+	}
+
+	for _, y := range lines {
+		chunk := lineChunk(channels, y)
+		if _, err := w.w.Write(chunk); err != nil {
+			return err
+		}
+		w.offsets[y-rect.Min.Y] = w.pos
+		w.pos += uint64(len(chunk))
+		w.written++
+	}
+	return nil
+}
+
+// Close writes the offset table, and leaves w at the end of the image.
+// It doesn't close the underlying writer.
+//
+// When some lines aren't written, their offsets are written as 0,
+// and Close returns an error after writing the offset table.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	headerLen := len(headersToBytes(w.vf, []Header{w.e.header}))
+	if _, err := w.w.Seek(w.start+8+int64(headerLen), io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(offsetsToBytes(w.offsets)); err != nil {
+		return err
+	}
+	if _, err := w.w.Seek(w.start+int64(w.pos), io.SeekStart); err != nil {
+		return err
+	}
+	if missing := len(w.offsets) - w.written; missing > 0 {
+		return FormatError(fmt.Sprintf("%d lines are not written", missing))
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package exr
+
+import (
+	"image"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// lineOrderImage returns an image that has distinct pixel values in each line.
+func lineOrderImage(rect image.Rectangle) *Image {
+	y := &Channel{Name: "Y", Type: FLOAT, Rect: rect}
+	ry := &Channel{Name: "RY", Type: HALF, XSampling: 2, YSampling: 2, Rect: sampledRect(rect, 2, 2)}
+	for i := 0; i < rect.Dx()*rect.Dy(); i++ {
+		y.Float = append(y.Float, float32(i))
+	}
+	for i := 0; i < ry.Rect.Dx()*ry.Rect.Dy(); i++ {
+		ry.Float = append(ry.Float, float32(-i))
+	}
+	return &Image{Header: make(Header), Rect: rect, Channels: []*Channel{ry, y}}
+}
+
+// chunkOrder returns y coordinates of the chunks, in the order they are stored in the file.
+func chunkOrder(t *testing.T, path string) []int {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := newDecoder(f, fi.Size(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offsets := append([]uint64(nil), d.offsets[0]...)
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	ys := make([]int, len(offsets))
+	for i, o := range offsets {
+		c, err := d.readChunk(0, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ys[i] = c.y
+	}
+	return ys
+}
+
+// compareChannels checks got has the channels of want, with the same pixel values.
+// Float values are compared by their bits, so NaNs are the same when their bits are.
+func compareChannels(t *testing.T, got, want *Image) {
+	for _, wc := range want.Channels {
+		gc := got.Channel(wc.Name)
+		if gc == nil {
+			t.Fatalf("channel %q not found", wc.Name)
+		}
+		if gc.Rect != wc.Rect {
+			t.Fatalf("channel %q: bounds: got %v, want %v", wc.Name, gc.Rect, wc.Rect)
+		}
+		if len(gc.Float) != len(wc.Float) || len(gc.Uint) != len(wc.Uint) {
+			t.Fatalf("channel %q: got %d float and %d uint values, want %d and %d", wc.Name, len(gc.Float), len(gc.Uint), len(wc.Float), len(wc.Uint))
+		}
+		for i := range wc.Float {
+			if math.Float32bits(gc.Float[i]) != math.Float32bits(wc.Float[i]) {
+				t.Fatalf("channel %q: pixel value at %d: got %v, want %v", wc.Name, i, gc.Float[i], wc.Float[i])
+			}
+		}
+		for i := range wc.Uint {
+			if gc.Uint[i] != wc.Uint[i] {
+				t.Fatalf("channel %q: pixel value at %d: got %v, want %v", wc.Name, i, gc.Uint[i], wc.Uint[i])
+			}
+		}
+	}
+}
+
+func TestEncodeLineOrder(t *testing.T) {
+	rect := image.Rect(0, -2, 4, 4)
+	m := lineOrderImage(rect)
+	cases := []struct {
+		order lineOrder
+		want  []int
+	}{
+		{INCREASING_Y, []int{-2, -1, 0, 1, 2, 3}},
+		{DECREASING_Y, []int{3, 2, 1, 0, -1, -2}},
+		{RANDOM_Y, []int{-2, -1, 0, 1, 2, 3}},
+	}
+	for _, c := range cases {
+		path := encodeTemp(t, m, &Options{LineOrder: c.order})
+		defer os.RemoveAll(filepath.Dir(path))
+		got := chunkOrder(t, path)
+		for i := range c.want {
+			if got[i] != c.want[i] {
+				t.Fatalf("%v: chunks: got %v, want %v", c.order, got, c.want)
+			}
+		}
+		d, err := DecodeWithOptions(path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compareChannels(t, d, m)
+	}
+}
+
+func TestWriterRandomY(t *testing.T) {
+	rect := image.Rect(0, 0, 6, 8)
+	m := lineOrderImage(rect)
+	dir, err := ioutil.TempDir("", "exr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "random.exr")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := NewWriter(f, &Image{Header: make(Header), Rect: rect, Channels: m.Channels}, &Options{LineOrder: RANDOM_Y})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Write buckets of two lines in random order.
+	buckets := rand.New(rand.NewSource(1)).Perm(rect.Dy() / 2)
+	var want []int
+	for _, b := range buckets {
+		y := rect.Min.Y + 2*b
+		if err := w.WriteLines(m.Reframe(image.Rect(rect.Min.X, y, rect.Max.X, y+2))); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, y, y+1)
+	}
+	if err := w.WriteLines(m.Reframe(image.Rect(rect.Min.X, 0, rect.Max.X, 1))); err == nil {
+		t.Fatal("writing a line twice should fail")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := chunkOrder(t, path)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("chunks: got %v, want %v", got, want)
+		}
+	}
+	d, err := DecodeWithOptions(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareChannels(t, d, m)
+}
+
+func TestWriterIncreasingY(t *testing.T) {
+	rect := image.Rect(0, 0, 2, 4)
+	m := lineOrderImage(rect)
+	dir, err := ioutil.TempDir("", "exr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f, err := os.Create(filepath.Join(dir, "increasing.exr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := NewWriter(f, m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteLines(m.Reframe(image.Rect(0, 2, 2, 4))); err == nil {
+		t.Fatal("writing lines out of order should fail")
+	}
+	if err := w.WriteLines(m.Reframe(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err == nil {
+		t.Fatal("closing with missing lines should fail")
+	}
+}